@@ -0,0 +1,341 @@
+//
+// Package mkpage accesslog.go provides access logging in Common,
+// Combined, JSON lines and text formats for ws.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// LogFormatText is ws' original free form log line
+	LogFormatText = "text"
+	// LogFormatCommon is the NCSA Common Log Format
+	LogFormatCommon = "common"
+	// LogFormatCombined is the NCSA Combined Log Format (Common plus
+	// referrer and user agent)
+	LogFormatCombined = "combined"
+	// LogFormatJSON writes one JSON object per line
+	LogFormatJSON = "json"
+
+	// CLFTimeFmt is the time format used by Common and Combined logs
+	CLFTimeFmt = "02/Jan/2006:15:04:05 -0700"
+)
+
+// AccessLogEntry holds what we record about a request and response
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	Method     string    `json:"method"`
+	Host       string    `json:"host,omitempty"`
+	Path       string    `json:"path"`
+	Query      string    `json:"query,omitempty"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	// Duration is in milliseconds
+	Duration  float64 `json:"duration_ms"`
+	Referrer  string  `json:"referrer,omitempty"`
+	UserAgent string  `json:"user_agent,omitempty"`
+}
+
+// remoteHost returns the host part of a RemoteAddr
+func remoteHost(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// clfString returns "-" for an empty string so Common Log Format
+// fields are never blank.
+func clfString(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// RequestURI returns the path with the query string if present
+func (e *AccessLogEntry) RequestURI() string {
+	if e.Query != "" {
+		return e.Path + "?" + e.Query
+	}
+	return e.Path
+}
+
+// Format renders the log entry as a single line (without a trailing
+// newline) in one of the log formats.
+func (e *AccessLogEntry) Format(format string) string {
+	bytes := "-"
+	if e.Bytes > 0 {
+		bytes = fmt.Sprintf("%d", e.Bytes)
+	}
+	switch format {
+	case LogFormatCommon:
+		return fmt.Sprintf("%s - - [%s] %q %d %s",
+			clfString(remoteHost(e.RemoteAddr)), e.Time.Format(CLFTimeFmt),
+			e.Method+" "+e.RequestURI()+" "+e.Proto, e.Status, bytes)
+	case LogFormatCombined:
+		return fmt.Sprintf("%s - - [%s] %q %d %s %q %q",
+			clfString(remoteHost(e.RemoteAddr)), e.Time.Format(CLFTimeFmt),
+			e.Method+" "+e.RequestURI()+" "+e.Proto, e.Status, bytes,
+			clfString(e.Referrer), clfString(e.UserAgent))
+	case LogFormatJSON:
+		src, _ := json.Marshal(e)
+		return string(src)
+	default:
+		s := fmt.Sprintf("Request: %s Path: %s RemoteAddr: %s UserAgent: %s", e.Method, e.Path, e.RemoteAddr, e.UserAgent)
+		if e.Query != "" {
+			s += fmt.Sprintf(" Query: %s", e.Query)
+		}
+		s += fmt.Sprintf(" Status: %d, %s Bytes: %d Duration: %.3fms", e.Status, http.StatusText(e.Status), e.Bytes, e.Duration)
+		if e.Referrer != "" {
+			s += fmt.Sprintf(" Referrer: %s", e.Referrer)
+		}
+		return s
+	}
+}
+
+// IsLogFormat returns true if format is a supported log format
+func IsLogFormat(format string) bool {
+	switch format {
+	case LogFormatText, LogFormatCommon, LogFormatCombined, LogFormatJSON:
+		return true
+	}
+	return false
+}
+
+// AccessLogger writes an AccessLogEntry for each response
+type AccessLogger struct {
+	// Format is one of text, common, combined or json
+	Format string
+	// Out is where log lines are written, if nil the standard
+	// logger is used.
+	Out io.Writer
+
+	mu sync.Mutex
+}
+
+// NewAccessLogger returns a new *AccessLogger or error if the format
+// is not supported.
+func NewAccessLogger(format string, out io.Writer) (*AccessLogger, error) {
+	if format == "" {
+		format = LogFormatText
+	}
+	if IsLogFormat(format) == false {
+		return nil, fmt.Errorf("Unsupported log format %q, expected text, common, combined or json", format)
+	}
+	return &AccessLogger{Format: format, Out: out}, nil
+}
+
+// Log writes an entry
+func (al *AccessLogger) Log(e *AccessLogEntry) {
+	line := e.Format(al.Format)
+	if al.Out == nil {
+		if al.Format == LogFormatText {
+			log.Print(line)
+		} else {
+			// Structured formats carry their own time stamp
+			fmt.Fprintln(log.Writer(), line)
+		}
+		return
+	}
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if al.Format == LogFormatText {
+		line = e.Time.Format("2006/01/02 15:04:05 ") + line
+	}
+	fmt.Fprintln(al.Out, line)
+}
+
+// Handler accepts an http.Handler and returns a http.Handler that
+// records the status, bytes written, duration and referrer of each
+// response.
+func (al *AccessLogger) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		al.Log(&AccessLogEntry{
+			Time:       start,
+			RemoteAddr: r.RemoteAddr,
+			Method:     r.Method,
+			Host:       r.Host,
+			Path:       r.URL.Path,
+			Query:      r.URL.RawQuery,
+			Proto:      r.Proto,
+			Status:     rec.status,
+			Bytes:      rec.bytes,
+			Duration:   float64(time.Since(start).Microseconds()) / 1000.0,
+			Referrer:   r.Referer(),
+			UserAgent:  r.UserAgent(),
+		})
+	})
+}
+
+// responseRecorder captures the status and bytes written
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// WriteHeader records the status
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the bytes written
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(p)
+	rec.bytes += int64(n)
+	return n, err
+}
+
+// Flush passes flushes on so streamed responses still work
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack lets WebSocket upgrades through the logger
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := rec.ResponseWriter.(http.Hijacker); ok {
+		if rec.status == 0 {
+			rec.status = http.StatusSwitchingProtocols
+		}
+		return h.Hijack()
+	}
+	return nil, nil, fmt.Errorf("%T does not support Hijack", rec.ResponseWriter)
+}
+
+// Unwrap returns the original http.ResponseWriter
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// RotatingFile is an io.Writer that rotates the file when it reaches
+// MaxSize bytes keeping MaxBackups old files (e.g. access.log.1,
+// access.log.2).
+type RotatingFile struct {
+	Name       string
+	MaxSize    int64
+	MaxBackups int
+
+	mu   sync.Mutex
+	fp   *os.File
+	size int64
+}
+
+// OpenRotatingFile opens (appending to) a log file
+func OpenRotatingFile(name string, maxSize int64, maxBackups int) (*RotatingFile, error) {
+	rf := &RotatingFile{Name: name, MaxSize: maxSize, MaxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// open opens the log file for appending
+func (rf *RotatingFile) open() error {
+	fp, err := os.OpenFile(rf.Name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0664)
+	if err != nil {
+		return fmt.Errorf("Opening %q, %s", rf.Name, err)
+	}
+	info, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		return err
+	}
+	rf.fp, rf.size = fp, info.Size()
+	return nil
+}
+
+// rotate shifts name.N-1 to name.N, name to name.1 and reopens name.
+// If the rotation fails name is reopened so logging carries on.
+func (rf *RotatingFile) rotate() error {
+	err := rf.fp.Close()
+	if err == nil && rf.MaxBackups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", rf.Name, rf.MaxBackups))
+		for i := rf.MaxBackups - 1; i > 0; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", rf.Name, i), fmt.Sprintf("%s.%d", rf.Name, i+1))
+		}
+		err = os.Rename(rf.Name, rf.Name+".1")
+	} else if err == nil {
+		err = os.Truncate(rf.Name, 0)
+	}
+	if e := rf.open(); e != nil && err == nil {
+		err = e
+	}
+	if err != nil {
+		return fmt.Errorf("Rotating %q, %s", rf.Name, err)
+	}
+	return nil
+}
+
+// Write writes p to the file rotating first if needed. If rotating
+// fails p is still written and the rotation error returned.
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	var rotateErr error
+	if rf.MaxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.MaxSize {
+		rotateErr = rf.rotate()
+	}
+	n, err := rf.fp.Write(p)
+	rf.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// Close closes the log file
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.fp.Close()
+}
+
+// AccessLogFormats lists the supported log formats for help text
+func AccessLogFormats() string {
+	return strings.Join([]string{LogFormatText, LogFormatCommon, LogFormatCombined, LogFormatJSON}, ", ")
+}
@@ -0,0 +1,150 @@
+//
+// accesslog_test.go test routines for accesslog.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccessLogEntry(t *testing.T) {
+	tm, _ := time.Parse(time.RFC3339, "2021-10-10T13:55:36-07:00")
+	e := &AccessLogEntry{
+		Time:       tm,
+		RemoteAddr: "127.0.0.1:51234",
+		Method:     "GET",
+		Path:       "/apache_pb.gif",
+		Query:      "v=1",
+		Proto:      "HTTP/1.0",
+		Status:     200,
+		Bytes:      2326,
+		Referrer:   "http://www.example.com/start.html",
+		UserAgent:  "Mozilla/4.08",
+	}
+	expected := `127.0.0.1 - - [10/Oct/2021:13:55:36 -0700] "GET /apache_pb.gif?v=1 HTTP/1.0" 200 2326`
+	if s := e.Format(LogFormatCommon); s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+	expected += ` "http://www.example.com/start.html" "Mozilla/4.08"`
+	if s := e.Format(LogFormatCombined); s != expected {
+		t.Errorf("expected %q, got %q", expected, s)
+	}
+	e2 := new(AccessLogEntry)
+	if err := json.Unmarshal([]byte(e.Format(LogFormatJSON)), &e2); err != nil {
+		t.Errorf("expected JSON line, %s", err)
+	} else if e2.Status != e.Status || e2.Bytes != e.Bytes || e2.Referrer != e.Referrer {
+		t.Errorf("expected %+v, got %+v", e, e2)
+	}
+	if s := e.Format(LogFormatText); strings.HasPrefix(s, "Request: GET Path: /apache_pb.gif") == false || strings.Contains(s, "Status: 200") == false {
+		t.Errorf("unexpected text log line %q", s)
+	}
+	if _, err := NewAccessLogger("apache", nil); err == nil {
+		t.Errorf("expected an error for unsupported log format")
+	}
+}
+
+func TestAccessLogger(t *testing.T) {
+	buf := new(bytes.Buffer)
+	al, err := NewAccessLogger(LogFormatJSON, buf)
+	if err != nil {
+		t.Errorf("NewAccessLogger() failed, %s", err)
+		t.FailNow()
+	}
+	handler := al.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	req := httptest.NewRequest("GET", "/missing.html", nil)
+	req.Header.Set("Referer", "http://example.org/links.html")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	e := new(AccessLogEntry)
+	if err := json.Unmarshal(buf.Bytes(), &e); err != nil {
+		t.Errorf("expected a JSON log line, %s, %q", err, buf.String())
+		t.FailNow()
+	}
+	if e.Status != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", e.Status)
+	}
+	if e.Bytes == 0 {
+		t.Errorf("expected bytes written to be recorded")
+	}
+	if e.Referrer != "http://example.org/links.html" {
+		t.Errorf("expected referrer, got %q", e.Referrer)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dName := path.Join("test", "logs")
+	os.RemoveAll(dName)
+	os.MkdirAll(dName, 0777)
+	fName := path.Join(dName, "access.log")
+	rf, err := OpenRotatingFile(fName, 100, 2)
+	if err != nil {
+		t.Errorf("OpenRotatingFile() failed, %s", err)
+		t.FailNow()
+	}
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(rf, "%02d %s\n", i, strings.Repeat("x", 36))
+	}
+	rf.Close()
+	for _, name := range []string{fName, fName + ".1", fName + ".2"} {
+		if info, err := os.Stat(name); err != nil {
+			t.Errorf("expected %q, %s", name, err)
+		} else if info.Size() > 100 {
+			t.Errorf("expected %q to be at most 100 bytes, got %d", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(fName + ".3"); err == nil {
+		t.Errorf("expected only two backups")
+	}
+	src, _ := ioutil.ReadFile(fName)
+	if strings.HasPrefix(string(src), "08 ") == false {
+		t.Errorf("expected newest lines in %q, got %q", fName, src)
+	}
+
+	// A failed rotation keeps writing to the log
+	fName = path.Join(dName, "blocked.log")
+	os.MkdirAll(path.Join(fName+".1", "keep"), 0777)
+	rf, err = OpenRotatingFile(fName, 10, 1)
+	if err != nil {
+		t.Errorf("OpenRotatingFile() failed, %s", err)
+		t.FailNow()
+	}
+	fmt.Fprintf(rf, "first line\n")
+	if _, err := fmt.Fprintf(rf, "second line\n"); err == nil {
+		t.Errorf("expected the rotation error")
+	}
+	if _, err := fmt.Fprintf(rf, "third line\n"); err == nil {
+		t.Errorf("expected the rotation error again")
+	}
+	rf.Close()
+	src, _ = ioutil.ReadFile(fName)
+	if string(src) != "first line\nsecond line\nthird line\n" {
+		t.Errorf("expected every line in %q, got %q", fName, src)
+	}
+}
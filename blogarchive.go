@@ -0,0 +1,208 @@
+//
+// Package mkpage blogarchive.go builds the year, month and day archive pages
+// for a blog.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"fmt"
+	"path"
+)
+
+const (
+	// ArchiveYear is the level of a year archive, e.g. blog/2021/
+	ArchiveYear = "year"
+	// ArchiveMonth is the level of a month archive, e.g. blog/2021/03/
+	ArchiveMonth = "month"
+	// ArchiveDay is the level of a day archive, e.g. blog/2021/03/15/
+	ArchiveDay = "day"
+)
+
+// ArchiveLink points to another archive page
+type ArchiveLink struct {
+	Label string `json:"label"`
+	Href  string `json:"href"`
+}
+
+// BlogArchive holds the posts for a year, month or day of a blog.
+// Posts are listed newest first like blog.json.
+type BlogArchive struct {
+	// Dir is the archive's directory, e.g. blog/2021/03
+	Dir   string                   `json:"-"`
+	Level string                   `json:"level"`
+	Label string                   `json:"label"`
+	Year  string                   `json:"year"`
+	Month string                   `json:"month,omitempty"`
+	Day   string                   `json:"day,omitempty"`
+	Posts []map[string]interface{} `json:"posts"`
+	// Prev is the older period, Next the newer one.
+	Prev *ArchiveLink `json:"prev,omitempty"`
+	Next *ArchiveLink `json:"next,omitempty"`
+
+	posts []*datedPost
+}
+
+// linkArchives sets the Prev and Next links between archives of the
+// same level, archives are ordered newest first.
+func linkArchives(archives []*BlogArchive) {
+	for i, archive := range archives {
+		if i > 0 {
+			newer := archives[i-1]
+			archive.Next = &ArchiveLink{Label: newer.Label, Href: relHref(archive.Dir, newer.Dir) + "/"}
+		}
+		if i < (len(archives) - 1) {
+			older := archives[i+1]
+			archive.Prev = &ArchiveLink{Label: older.Label, Href: relHref(archive.Dir, older.Dir) + "/"}
+		}
+	}
+}
+
+// Archives returns the year, month and day archives of the blog under
+// prefix. Only posts that can be rendered are listed.
+func (meta *BlogMeta) Archives(prefix string) ([]*BlogArchive, []*BlogArchive, []*BlogArchive) {
+	years, months, days := []*BlogArchive{}, []*BlogArchive{}, []*BlogArchive{}
+	var year, month, day *BlogArchive
+	for _, dp := range meta.datedPosts() {
+		if year == nil || year.Year != dp.yr {
+			year = &BlogArchive{
+				Dir:   path.Join(prefix, dp.yr),
+				Level: ArchiveYear,
+				Label: dp.yr,
+				Year:  dp.yr,
+			}
+			years = append(years, year)
+		}
+		if month == nil || month.Year != dp.yr || month.Month != dp.mn {
+			month = &BlogArchive{
+				Dir:   path.Join(prefix, dp.yr, dp.mn),
+				Level: ArchiveMonth,
+				Label: fmt.Sprintf("%s-%s", dp.yr, dp.mn),
+				Year:  dp.yr,
+				Month: dp.mn,
+			}
+			months = append(months, month)
+		}
+		if day == nil || day.Year != dp.yr || day.Month != dp.mn || day.Day != dp.dy {
+			day = &BlogArchive{
+				Dir:   path.Join(prefix, dp.yr, dp.mn, dp.dy),
+				Level: ArchiveDay,
+				Label: fmt.Sprintf("%s-%s-%s", dp.yr, dp.mn, dp.dy),
+				Year:  dp.yr,
+				Month: dp.mn,
+				Day:   dp.dy,
+			}
+			days = append(days, day)
+		}
+		year.posts = append(year.posts, dp)
+		month.posts = append(month.posts, dp)
+		day.posts = append(day.posts, dp)
+	}
+	for _, archives := range [][]*BlogArchive{years, months, days} {
+		for _, archive := range archives {
+			archive.Posts = meta.postsData(archive.Dir, archive.posts)
+		}
+		linkArchives(archives)
+	}
+	return years, months, days
+}
+
+// ArchivePages returns the BlogPages for rendering an archive's
+// index.html with template, paginated when PageSize is set. The
+// page's posts are available as "posts", the previous and next
+// periods as "prev" and "next", the page as "pagination", the archive
+// itself as "archive" and the blog metadata as "blog".
+func (meta *BlogMeta) ArchivePages(archive *BlogArchive, template string) ([]*BlogPage, error) {
+	pages := []*BlogPage{}
+	for _, lp := range meta.paginate(archive.Dir, archive.posts) {
+		page := &BlogPage{
+			Name:     path.Join(lp.dir, "index.html"),
+			Template: template,
+			KeyValues: map[string]string{
+				"title": TextPrefix + archive.Label,
+			},
+		}
+		pageArchive := *archive
+		pageArchive.Posts = meta.postsData(lp.dir, lp.posts)
+		values := map[string]interface{}{
+			"archive":    &pageArchive,
+			"posts":      pageArchive.Posts,
+			"pagination": lp.pagination,
+			"blog":       meta.blogInfo(),
+		}
+		if archive.Prev != nil {
+			pageArchive.Prev = &ArchiveLink{Label: archive.Prev.Label, Href: rebaseHref(archive.Dir, lp.dir, archive.Prev.Href)}
+			values["prev"] = pageArchive.Prev
+		}
+		if archive.Next != nil {
+			pageArchive.Next = &ArchiveLink{Label: archive.Next.Label, Href: rebaseHref(archive.Dir, lp.dir, archive.Next.Href)}
+			values["next"] = pageArchive.Next
+		}
+		for key, val := range values {
+			src, err := jsonValue(val)
+			if err != nil {
+				return nil, err
+			}
+			page.KeyValues[key] = src
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// archivePages returns the pages for each archive level that has a
+// template set in blog.json
+func (meta *BlogMeta) archivePages(prefix string) ([]*BlogPage, error) {
+	pages := []*BlogPage{}
+	years, months, days := meta.Archives(prefix)
+	for _, level := range []struct {
+		template string
+		archives []*BlogArchive
+	}{
+		{meta.YearTmpl, years},
+		{meta.MonthTmpl, months},
+		{meta.DayTmpl, days},
+	} {
+		if level.template == "" {
+			continue
+		}
+		for _, archive := range level.archives {
+			archivePages, err := meta.ArchivePages(archive, level.template)
+			if err != nil {
+				return nil, err
+			}
+			pages = append(pages, archivePages...)
+		}
+	}
+	return pages, nil
+}
+
+// archiveData returns an index.json for each archive
+func (meta *BlogMeta) archiveData(prefix string) []*BlogData {
+	data := []*BlogData{}
+	years, months, days := meta.Archives(prefix)
+	for _, archives := range [][]*BlogArchive{years, months, days} {
+		for _, archive := range archives {
+			data = append(data, &BlogData{
+				Name: path.Join(archive.Dir, "index.json"),
+				Data: archive,
+			})
+		}
+	}
+	return data
+}
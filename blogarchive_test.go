@@ -0,0 +1,96 @@
+//
+// blogarchive_test.go test routines for blogarchive.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"path"
+	"testing"
+)
+
+func TestArchives(t *testing.T) {
+	meta := new(BlogMeta)
+	newPost := func(ymd string, slug string) *PostObj {
+		return &PostObj{
+			Slug:     slug,
+			Document: path.Join("blog", ymd, slug+".md"),
+			Title:    slug,
+		}
+	}
+	meta.Years = []*YearObj{
+		&YearObj{Year: "2021", Months: []*MonthObj{
+			&MonthObj{Month: "03", Days: []*DayObj{
+				&DayObj{Day: "15", Posts: []*PostObj{newPost("2021/03/15", "c")}},
+				&DayObj{Day: "01", Posts: []*PostObj{newPost("2021/03/01", "b")}},
+			}},
+		}},
+		&YearObj{Year: "2020", Months: []*MonthObj{
+			&MonthObj{Month: "12", Days: []*DayObj{
+				&DayObj{Day: "31", Posts: []*PostObj{newPost("2020/12/31", "a")}},
+			}},
+		}},
+	}
+	years, months, days := meta.Archives("blog")
+	if len(years) != 2 || len(months) != 2 || len(days) != 3 {
+		t.Errorf("expected 2 years, 2 months, 3 days, got %d, %d, %d", len(years), len(months), len(days))
+		t.FailNow()
+	}
+	if years[0].Label != "2021" || len(years[0].Posts) != 2 {
+		t.Errorf("unexpected year archive %+v", years[0])
+	}
+	if years[0].Next != nil || years[0].Prev == nil || years[0].Prev.Href != "../2020/" {
+		t.Errorf("unexpected year links %+v, %+v", years[0].Prev, years[0].Next)
+	}
+	if years[1].Next == nil || years[1].Next.Label != "2021" || years[1].Prev != nil {
+		t.Errorf("unexpected year links %+v, %+v", years[1].Prev, years[1].Next)
+	}
+	if months[1].Label != "2020-12" || months[1].Next.Href != "../../2021/03/" {
+		t.Errorf("unexpected month archive %+v", months[1])
+	}
+	day := days[1]
+	if day.Label != "2021-03-01" || day.Prev.Label != "2020-12-31" || day.Next.Label != "2021-03-15" {
+		t.Errorf("unexpected day archive %+v", day)
+	}
+	if day.Posts[0]["href"] != "b.html" {
+		t.Errorf("unexpected post href %q", day.Posts[0]["href"])
+	}
+	if day.Posts[0]["date"] != "2021-03-01" {
+		t.Errorf("expected date from path, got %q", day.Posts[0]["date"])
+	}
+	if years[0].Posts[1]["href"] != "03/01/b.html" {
+		t.Errorf("unexpected year post href %q", years[0].Posts[1]["href"])
+	}
+
+	// Only archive levels with templates are rendered
+	meta.MonthTmpl = "month.tmpl"
+	pages, err := meta.Pages("blog")
+	if err != nil {
+		t.Errorf("Pages() failed, %s", err)
+		t.FailNow()
+	}
+	if len(pages) != 2 || pages[0].Name != "blog/2021/03/index.html" || pages[0].Template != "month.tmpl" {
+		t.Errorf("unexpected archive pages %+v", pages)
+	}
+	if len(meta.DataFiles("blog")) != 0 {
+		t.Errorf("expected no data files without ArchiveJSON")
+	}
+	meta.ArchiveJSON = true
+	if data := meta.DataFiles("blog"); len(data) != 7 || data[0].Name != "blog/2021/index.json" {
+		t.Errorf("unexpected data files %+v", data)
+	}
+}
@@ -0,0 +1,135 @@
+//
+// Package mkpage blogcheck.go checks a blog.json against the blog's
+// YYYY/MM/DD folders, e.g. for missing documents and duplicate slugs.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	// IssueMissing is a post whose document isn't found
+	IssueMissing = "missing"
+	// IssueUnindexed is a post document in a YYYY/MM/DD folder that
+	// isn't in blog.json
+	IssueUnindexed = "unindexed"
+	// IssueDuplicate is a post whose slug is used by another post
+	IssueDuplicate = "duplicate"
+	// IssueInvalidDate is a post or folder whose date can't be parsed
+	IssueInvalidDate = "invalid-date"
+	// IssueDateMismatch is a post whose front matter date isn't the
+	// date of its folder
+	IssueDateMismatch = "date-mismatch"
+)
+
+// BlogIssue is a problem found by Check
+type BlogIssue struct {
+	Issue    string `json:"issue"`
+	Document string `json:"document"`
+	Message  string `json:"message,omitempty"`
+}
+
+// String returns the BlogIssue as a line of text
+func (issue *BlogIssue) String() string {
+	if issue.Message != "" {
+		return fmt.Sprintf("%-13s %s, %s", issue.Issue, issue.Document, issue.Message)
+	}
+	return fmt.Sprintf("%-13s %s", issue.Issue, issue.Document)
+}
+
+// Check reports the problems with the posts in blog.json and the
+// YYYY/MM/DD folders under prefix. Posts are checked in blog.json
+// order followed by the unindexed documents in date order.
+func (meta *BlogMeta) Check(prefix string) []*BlogIssue {
+	issues := []*BlogIssue{}
+	report := func(issue string, document string, msg string, args ...interface{}) {
+		issues = append(issues, &BlogIssue{
+			Issue:    issue,
+			Document: document,
+			Message:  fmt.Sprintf(msg, args...),
+		})
+	}
+	indexed := map[string]bool{}
+	slugs := map[string]string{}
+	for _, yr := range meta.Years {
+		for _, mn := range yr.Months {
+			for _, dy := range mn.Days {
+				ymd := []string{yr.Year, mn.Month, dy.Day}
+				folder := strings.Join(ymd, "-")
+				if isValidYMD(ymd) == false {
+					report(IssueInvalidDate, path.Join(yr.Year, mn.Month, dy.Day), "not a date")
+				}
+				for _, post := range dy.Posts {
+					indexed[post.Document] = true
+					if doc, ok := slugs[post.Slug]; ok {
+						report(IssueDuplicate, post.Document, "slug %q is used by %s", post.Slug, doc)
+					} else {
+						slugs[post.Slug] = post.Document
+					}
+					for _, field := range [][]string{{"date", post.Created}, {"updated", post.Updated}, {"expires", post.Expires}} {
+						if field[1] == "" {
+							continue
+						}
+						if _, err := ParsePostDate(field[1]); err != nil {
+							report(IssueInvalidDate, post.Document, "%s %q", field[0], field[1])
+						}
+					}
+					if _, err := os.Stat(post.Document); os.IsNotExist(err) {
+						report(IssueMissing, post.Document, "")
+						continue
+					}
+					if isPostDocument(post.Document) == false {
+						continue
+					}
+					obj, err := readFrontMatter(post.Document)
+					if err != nil {
+						continue
+					}
+					date, _ := asString(obj["date"])
+					if date == "" {
+						continue
+					}
+					if dt, err := calcYMD(date); err != nil {
+						report(IssueInvalidDate, post.Document, "front matter date %q", date)
+					} else if strings.Join(dt, "-") != folder {
+						report(IssueDateMismatch, post.Document, "front matter date %q, folder %s", date, folder)
+					}
+				}
+			}
+		}
+	}
+	for _, ymd := range datedFolders(prefix, "") {
+		folder := path.Join(prefix, ymd[0], ymd[1], ymd[2])
+		for _, fName := range postDocuments(folder) {
+			if indexed[fName] {
+				continue
+			}
+			if isValidYMD(ymd) {
+				report(IssueUnindexed, fName, "")
+			} else {
+				report(IssueInvalidDate, fName, "folder %s is not a date", strings.Join(ymd, "/"))
+			}
+		}
+	}
+	return issues
+}
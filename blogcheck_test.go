@@ -0,0 +1,99 @@
+//
+// blogcheck_test.go test routines for blogcheck.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	prefix := path.Join("test", "check")
+	os.RemoveAll(prefix)
+	os.MkdirAll(prefix, 0777)
+	meta := new(BlogMeta)
+	for _, item := range []struct {
+		name, date string
+	}{
+		{"hello.md", "2021-03-15"},
+		{"script.fountain", "2021-03-15"},
+		{"hello.md", "2021-03-14"},
+		{"gone.md", "2021-03-14"},
+		{"moved.md", "2021-03-13"},
+	} {
+		fName := path.Join("test", item.name)
+		src := "---\ntitle: " + item.name + "\n---\n\nHello\n"
+		if err := ioutil.WriteFile(fName, []byte(src), 0666); err != nil {
+			t.Errorf("Can't create %q, %s", fName, err)
+			t.FailNow()
+		}
+		if err := meta.BlogIt(prefix, fName, item.date); err != nil {
+			t.Errorf("BlogIt(%q, %q, %q) failed, %s", prefix, fName, item.date, err)
+			t.FailNow()
+		}
+	}
+	if issues := meta.Check(prefix); len(issues) != 1 || issues[0].Issue != IssueDuplicate {
+		t.Errorf("expected only the duplicate hello slug, got %+v", issues)
+	}
+
+	// Break the blog
+	os.Remove(path.Join(prefix, "2021", "03", "14", "gone.md"))
+	ioutil.WriteFile(path.Join(prefix, "2021", "03", "13", "moved.md"), []byte("---\ndate: 2021-03-10\n---\n\nMoved\n"), 0666)
+	ioutil.WriteFile(path.Join(prefix, "2021", "03", "15", "notes.spmd"), []byte("Notes\n"), 0666)
+	ioutil.WriteFile(path.Join(prefix, "2021", "03", "15", "photo.jpg"), []byte(""), 0666)
+	os.MkdirAll(path.Join(prefix, "2021", "02", "30"), 0777)
+	ioutil.WriteFile(path.Join(prefix, "2021", "02", "30", "typo.md"), []byte("Typo\n"), 0666)
+	if post, _, err := meta.FindPost("script"); err == nil {
+		post.Expires = "next week"
+	}
+
+	issues := meta.Check(prefix)
+	kinds := []string{}
+	for _, issue := range issues {
+		kinds = append(kinds, issue.Issue+" "+path.Base(issue.Document))
+	}
+	expected := []string{
+		IssueInvalidDate + " script.fountain",
+		IssueMissing + " gone.md",
+		IssueDuplicate + " hello.md",
+		IssueDateMismatch + " moved.md",
+		IssueInvalidDate + " typo.md",
+		IssueUnindexed + " notes.spmd",
+	}
+	if strings.Join(kinds, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(kinds, "\n"))
+	}
+
+	// Rebuild from the folders
+	meta = new(BlogMeta)
+	if err := meta.RefreshAll(prefix); err != nil {
+		t.Errorf("RefreshAll(%q) failed, %s", prefix, err)
+		t.FailNow()
+	}
+	docs := []string{}
+	for _, dp := range meta.datedPosts() {
+		docs = append(docs, strings.TrimPrefix(dp.post.Document, prefix+"/"))
+	}
+	if strings.Join(docs, ",") != "2021/03/15/script.fountain,2021/03/15/notes.spmd,2021/03/15/hello.md,2021/03/14/hello.md,2021/03/13/moved.md" {
+		t.Errorf("expected all the post documents, got %s", strings.Join(docs, ","))
+	}
+}
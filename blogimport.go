@@ -0,0 +1,623 @@
+//
+// Package mkpage blogimport.go imports posts from Jekyll, Hugo and WordPress
+// (WXR export) blogs.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	// 3rd Party packages
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ImportedPost is a post read from a Jekyll, Hugo or WordPress blog
+type ImportedPost struct {
+	// Source is the file the post was read from
+	Source string
+	Title  string
+	// Date is a post date, see ParsePostDate
+	Date     string
+	Slug     string
+	Creators []CreatorObj
+	Keywords []string
+	Draft    bool
+	// Extra holds the other front matter, e.g. description and updated
+	Extra map[string]interface{}
+	Body  string
+	// URLs are the post's old URL paths, e.g. /2021/03/15/my-post.html
+	URLs []string
+	// Media maps the media references in Body to the files to copy
+	Media map[string]string
+}
+
+// importedFrontMatter is the normalized front matter of an imported
+// post
+type importedFrontMatter struct {
+	Title    string       `yaml:"title"`
+	Date     string       `yaml:"date"`
+	Creators []CreatorObj `yaml:"creators,omitempty"`
+	Keywords []string     `yaml:"keywords"`
+	Draft    bool         `yaml:"draft"`
+}
+
+var (
+	// jekyllName is a Jekyll post's file name, YYYY-MM-DD-SLUG.md
+	jekyllName = regexp.MustCompile(`^([0-9]{4}-[0-9]{2}-[0-9]{2})-(.+)\.(md|markdown|html)$`)
+	// jekyllBaseURL is the Liquid site.baseurl tag Jekyll posts put
+	// in front of their links
+	jekyllBaseURL = regexp.MustCompile(`\{\{\s*site\.baseurl\s*\}\}`)
+	// mediaRefs are Markdown links and images and HTML src and href
+	// attributes
+	mediaRefs = []*regexp.Regexp{
+		regexp.MustCompile(`\]\(\s*<?([^)\s>]+)`),
+		regexp.MustCompile(`(?:src|href)\s*=\s*"([^"]+)"`),
+		regexp.MustCompile(`(?:src|href)\s*=\s*'([^']+)'`),
+	}
+)
+
+// splitImportFrontMatter returns a post's front matter and body, it
+// adds TOML front matter (between +++ lines) as used by Hugo to those
+// read by SplitFrontMatter.
+func splitImportFrontMatter(src []byte) (map[string]interface{}, string, error) {
+	obj := map[string]interface{}{}
+	src = bytes.ReplaceAll(src, []byte("\r\n"), []byte("\n"))
+	if bytes.HasPrefix(src, []byte("+++\n")) {
+		parts := bytes.SplitN(bytes.TrimPrefix(src, []byte("+++\n")), []byte("\n+++\n"), 2)
+		if _, err := toml.Decode(string(parts[0]), &obj); err != nil {
+			return nil, "", err
+		}
+		if len(parts) > 1 {
+			return obj, string(parts[1]), nil
+		}
+		return obj, "", nil
+	}
+	fmType, fmSrc, body := SplitFrontMatter(src)
+	if len(fmSrc) > 0 {
+		if err := UnmarshalFrontMatter(fmType, fmSrc, &obj); err != nil {
+			return nil, "", err
+		}
+	}
+	return obj, string(body), nil
+}
+
+// newImportedPost returns a post from its front matter and body, tags
+// and categories become keywords.
+func newImportedPost(source string, obj map[string]interface{}, body string) *ImportedPost {
+	post := new(PostObj)
+	post.setFrontMatter(obj)
+	imported := &ImportedPost{
+		Source:   source,
+		Title:    post.Title,
+		Date:     post.Created,
+		Creators: post.Creators,
+		Keywords: post.Keywords,
+		Draft:    post.Draft,
+		Extra:    map[string]interface{}{},
+		Body:     body,
+		Media:    map[string]string{},
+	}
+	for _, key := range []string{"tags", "categories"} {
+		keywords := asStrings(post.Extra[key])
+		if s, ok := post.Extra[key].(string); ok {
+			// NOTE: Jekyll allows a space separated list
+			keywords = strings.Fields(s)
+		}
+		for _, keyword := range keywords {
+			imported.addKeyword(keyword)
+		}
+	}
+	if published, ok := post.Extra["published"]; ok && asBool(published) == false {
+		imported.Draft = true
+	}
+	imported.Slug, _ = asString(post.Extra["slug"])
+	// NOTE: the rest of the front matter is kept as is, including
+	// the fields PostObj has such as description and updated.
+	for key, val := range obj {
+		switch key {
+		case "title", "date", "creators", "authors", "author", "keywords", "draft",
+			"tags", "categories", "published", "slug", "permalink", "url", "aliases", "layout", "publishDate":
+		default:
+			imported.Extra[key] = asJSONValue(val)
+		}
+	}
+	if imported.Date == "" {
+		imported.Date, _ = asString(obj["publishDate"])
+	}
+	if imported.Creators == nil {
+		imported.Creators = []CreatorObj{}
+	}
+	return imported
+}
+
+// addKeyword adds a keyword to the post if it doesn't have it
+func (post *ImportedPost) addKeyword(keyword string) {
+	keyword = strings.TrimSpace(keyword)
+	if keyword == "" {
+		return
+	}
+	for _, kw := range post.Keywords {
+		if strings.EqualFold(kw, keyword) {
+			return
+		}
+	}
+	post.Keywords = append(post.Keywords, keyword)
+}
+
+// findMedia returns the local files referenced in body, references
+// are looked for in each of dirs. Links to other posts and other
+// sites are skipped.
+func findMedia(body string, dirs []string) map[string]string {
+	media := map[string]string{}
+	for _, re := range mediaRefs {
+		for _, m := range re.FindAllStringSubmatch(body, -1) {
+			ref := m[1]
+			if strings.Contains(ref, "://") || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "mailto:") {
+				continue
+			}
+			p := ref
+			if i := strings.IndexAny(p, "?#"); i >= 0 {
+				p = p[0:i]
+			}
+			p, _ = url.PathUnescape(p)
+			if p == "" || isPostDocument(p) || strings.HasSuffix(p, ".html") {
+				continue
+			}
+			for _, dName := range dirs {
+				fName := filepath.Join(dName, filepath.FromSlash(p))
+				if info, err := os.Stat(fName); err == nil && info.IsDir() == false {
+					media[ref] = fName
+					break
+				}
+			}
+		}
+	}
+	return media
+}
+
+// ReadJekyll reads the posts of a Jekyll site or its _posts folder.
+// Posts are named YYYY-MM-DD-SLUG.md and their old URLs are from
+// their permalink or Jekyll's default, /CATEGORIES/YYYY/MM/DD/SLUG.html.
+// Media are looked for next to the post and in the site.
+func ReadJekyll(dName string) ([]*ImportedPost, error) {
+	postsDir := dName
+	if info, err := os.Stat(filepath.Join(dName, "_posts")); err == nil && info.IsDir() {
+		postsDir = filepath.Join(dName, "_posts")
+	}
+	siteDir := filepath.Dir(postsDir)
+	posts := []*ImportedPost{}
+	err := filepath.Walk(postsDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		m := jekyllName.FindStringSubmatch(info.Name())
+		if info.IsDir() || m == nil {
+			return nil
+		}
+		src, err := ioutil.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("Reading %q, %s", p, err)
+		}
+		obj, body, err := splitImportFrontMatter(src)
+		if err != nil {
+			return fmt.Errorf("Front matter %q, %s", p, err)
+		}
+		post := newImportedPost(p, obj, body)
+		if post.Date == "" {
+			post.Date = m[1]
+		}
+		if post.Slug == "" {
+			post.Slug = m[2]
+		}
+		if permalink, _ := asString(obj["permalink"]); permalink != "" {
+			post.URLs = append(post.URLs, permalink)
+		} else if ymd, err := calcYMD(post.Date); err == nil {
+			parts := []string{"/"}
+			categories := asStrings(obj["categories"])
+			if s, ok := obj["categories"].(string); ok {
+				categories = strings.Fields(s)
+			}
+			for _, category := range categories {
+				parts = append(parts, Slugify(category))
+			}
+			parts = append(parts, ymd[0], ymd[1], ymd[2], m[2]+".html")
+			post.URLs = append(post.URLs, path.Join(parts...))
+		}
+		post.Body = jekyllBaseURL.ReplaceAllString(post.Body, "")
+		post.Media = findMedia(post.Body, []string{filepath.Dir(p), siteDir})
+		posts = append(posts, post)
+		return nil
+	})
+	return posts, err
+}
+
+// ReadHugo reads the posts of a Hugo site (its content/posts) or a
+// content section folder. Front matter can be YAML, TOML or JSON,
+// page bundles (SLUG/index.md) are supported. Old URLs are the post's
+// url and aliases or /SECTION/SLUG/. Media are looked for next to the
+// post and in the site's static folder.
+func ReadHugo(dName string) ([]*ImportedPost, error) {
+	postsDir := dName
+	if info, err := os.Stat(filepath.Join(dName, "content", "posts")); err == nil && info.IsDir() {
+		postsDir = filepath.Join(dName, "content", "posts")
+	}
+	section := filepath.Base(postsDir)
+	siteDir := filepath.Dir(postsDir)
+	if filepath.Base(siteDir) == "content" {
+		siteDir = filepath.Dir(siteDir)
+	}
+	posts := []*ImportedPost{}
+	err := filepath.Walk(postsDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		if info.IsDir() || (ext != ".md" && ext != ".markdown") || strings.HasPrefix(info.Name(), "_index.") {
+			return nil
+		}
+		src, err := ioutil.ReadFile(p)
+		if err != nil {
+			return fmt.Errorf("Reading %q, %s", p, err)
+		}
+		obj, body, err := splitImportFrontMatter(src)
+		if err != nil {
+			return fmt.Errorf("Front matter %q, %s", p, err)
+		}
+		post := newImportedPost(p, obj, body)
+		if post.Date == "" {
+			return fmt.Errorf("%q is missing a date", p)
+		}
+		if post.Slug == "" {
+			post.Slug = strings.TrimSuffix(info.Name(), filepath.Ext(info.Name()))
+			if post.Slug == "index" {
+				post.Slug = filepath.Base(filepath.Dir(p))
+			}
+		}
+		if u, _ := asString(obj["url"]); u != "" {
+			post.URLs = append(post.URLs, u)
+		} else {
+			post.URLs = append(post.URLs, "/"+section+"/"+post.Slug+"/")
+		}
+		post.URLs = append(post.URLs, asStrings(obj["aliases"])...)
+		post.Media = findMedia(body, []string{filepath.Dir(p), filepath.Join(siteDir, "static"), siteDir})
+		posts = append(posts, post)
+		return nil
+	})
+	return posts, err
+}
+
+// wxr is the part of a WordPress export (WXR) that is imported
+type wxr struct {
+	Authors []struct {
+		Login string `xml:"author_login"`
+		Email string `xml:"author_email"`
+		Name  string `xml:"author_display_name"`
+	} `xml:"channel>author"`
+	Items []struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+		Content     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+		Excerpt     string `xml:"http://wordpress.org/export/1.2/excerpt/ encoded"`
+		PostID      string `xml:"post_id"`
+		PostName    string `xml:"post_name"`
+		PostDate    string `xml:"post_date"`
+		PostDateGMT string `xml:"post_date_gmt"`
+		Status      string `xml:"status"`
+		PostType    string `xml:"post_type"`
+		Categories  []struct {
+			Domain string `xml:"domain,attr"`
+			Name   string `xml:",chardata"`
+		} `xml:"category"`
+	} `xml:"channel>item"`
+}
+
+// wordpressDate returns a post date from WordPress' local and GMT
+// post dates, the timezone is the difference between them.
+func wordpressDate(local string, gmt string) string {
+	const wpDateFmt = "2006-01-02 15:04:05"
+	lt, err := time.Parse(wpDateFmt, strings.TrimSpace(local))
+	if err != nil || lt.Year() < 1 {
+		return time.Now().Format(DateFmt)
+	}
+	if gt, err := time.Parse(wpDateFmt, strings.TrimSpace(gmt)); err == nil && gt.Year() > 1 {
+		offset := int(lt.Sub(gt).Seconds())
+		lt = time.Date(lt.Year(), lt.Month(), lt.Day(), lt.Hour(), lt.Minute(), lt.Second(), 0, time.FixedZone("", offset))
+	}
+	return formatPostDate(lt)
+}
+
+// ReadWordPress reads the posts of a WordPress export (WXR). Pages,
+// attachments and trashed posts are skipped and posts that aren't
+// published are drafts. Old URLs are the post's link. Media in
+// wp-content/uploads are copied from uploads, a local copy of the
+// site's uploads folder, when it is set. The excerpt becomes the
+// description.
+func ReadWordPress(fName string, uploads string) ([]*ImportedPost, error) {
+	src, err := ioutil.ReadFile(fName)
+	if err != nil {
+		return nil, fmt.Errorf("Reading %q, %s", fName, err)
+	}
+	export := new(wxr)
+	if err := xml.Unmarshal(src, export); err != nil {
+		return nil, fmt.Errorf("Unmarshaling %q, %s", fName, err)
+	}
+	authors := map[string]CreatorObj{}
+	for _, author := range export.Authors {
+		authors[author.Login] = CreatorObj{Name: author.Name, Email: author.Email}
+	}
+	posts := []*ImportedPost{}
+	for _, item := range export.Items {
+		if item.PostType != "post" || item.Status == "trash" || item.Status == "auto-draft" {
+			continue
+		}
+		post := &ImportedPost{
+			Source:   fName,
+			Title:    strings.TrimSpace(item.Title),
+			Date:     wordpressDate(item.PostDate, item.PostDateGMT),
+			Creators: []CreatorObj{},
+			Keywords: []string{},
+			Draft:    item.Status != "publish" && item.Status != "future",
+			Extra:    map[string]interface{}{},
+			Body:     item.Content,
+			Media:    map[string]string{},
+		}
+		if excerpt := strings.TrimSpace(item.Excerpt); excerpt != "" {
+			post.Extra["description"] = excerpt
+		}
+		if name, err := url.PathUnescape(item.PostName); err == nil {
+			post.Slug = Slugify(name)
+		}
+		if post.Slug == "" {
+			post.Slug = Slugify(post.Title)
+		}
+		if post.Slug == "" {
+			post.Slug = "post-" + item.PostID
+		}
+		if creator, ok := authors[item.Creator]; ok {
+			post.Creators = append(post.Creators, creator)
+		} else if item.Creator != "" {
+			post.Creators = append(post.Creators, CreatorObj{Name: item.Creator})
+		}
+		for _, category := range item.Categories {
+			if name := strings.TrimSpace(category.Name); name != "Uncategorized" {
+				post.addKeyword(name)
+			}
+		}
+		if u, err := url.Parse(item.Link); err == nil && strings.Trim(u.Path, "/") != "" {
+			post.URLs = append(post.URLs, u.Path)
+		}
+		if uploads != "" {
+			for _, re := range mediaRefs {
+				for _, m := range re.FindAllStringSubmatch(post.Body, -1) {
+					ref := m[1]
+					i := strings.Index(ref, "/wp-content/uploads/")
+					if i < 0 {
+						continue
+					}
+					p, _ := url.PathUnescape(strings.SplitN(ref[i+len("/wp-content/uploads/"):], "?", 2)[0])
+					media := filepath.Join(uploads, filepath.FromSlash(p))
+					if info, err := os.Stat(media); err == nil && info.IsDir() == false {
+						post.Media[ref] = media
+					}
+				}
+			}
+		}
+		posts = append(posts, post)
+	}
+	return posts, nil
+}
+
+// ReadImport reads the posts of a WordPress export (a .xml file), a
+// Jekyll site or _posts folder or a Hugo site or content folder.
+// uploads is the local copy of a WordPress site's uploads folder.
+func ReadImport(source string, uploads string) ([]*ImportedPost, error) {
+	if strings.ToLower(filepath.Ext(source)) == ".xml" {
+		return ReadWordPress(source, uploads)
+	}
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() == false {
+		return nil, fmt.Errorf("%q isn't a WordPress export (.xml) or a Jekyll or Hugo folder", source)
+	}
+	if filepath.Base(source) == "_posts" {
+		return ReadJekyll(source)
+	}
+	if _, err := os.Stat(filepath.Join(source, "_posts")); err == nil {
+		return ReadJekyll(source)
+	}
+	return ReadHugo(source)
+}
+
+// document returns the post as a Markdown document with normalized
+// front matter.
+func (post *ImportedPost) document(body string) ([]byte, error) {
+	fm := &importedFrontMatter{
+		Title:    post.Title,
+		Date:     post.Date,
+		Creators: post.Creators,
+		Keywords: post.Keywords,
+		Draft:    post.Draft,
+	}
+	src, err := yaml.Marshal(fm)
+	if err != nil {
+		return nil, err
+	}
+	if len(post.Extra) > 0 {
+		extra, err := yaml.Marshal(post.Extra)
+		if err != nil {
+			return nil, err
+		}
+		src = append(src, extra...)
+	}
+	return []byte(fmt.Sprintf("---\n%s---\n\n%s", src, strings.TrimLeft(body, "\n"))), nil
+}
+
+// importMediaName returns the name media file fName is copied to in
+// dPath. A different file already using the name, in dPath or earlier
+// in the import (copied maps names to their source), gets a numbered
+// name, e.g. photo-2.jpg.
+func importMediaName(dPath string, fName string, copied map[string]string) string {
+	base := filepath.Base(fName)
+	ext := path.Ext(base)
+	for i := 1; ; i++ {
+		name := path.Join(dPath, base)
+		if i > 1 {
+			name = path.Join(dPath, fmt.Sprintf("%s-%d%s", strings.TrimSuffix(base, ext), i, ext))
+		}
+		if src, ok := copied[name]; ok {
+			if src == fName {
+				return name
+			}
+			continue
+		}
+		if target, err := ioutil.ReadFile(name); err == nil {
+			if src, err := ioutil.ReadFile(fName); err == nil && bytes.Equal(src, target) {
+				return name
+			}
+			continue
+		}
+		return name
+	}
+}
+
+// copyFile copies fName to targetName
+func copyFile(fName string, targetName string) error {
+	src, err := ioutil.ReadFile(fName)
+	if err != nil {
+		return fmt.Errorf("Reading %q, %s", fName, err)
+	}
+	if err := ioutil.WriteFile(targetName, src, 0666); err != nil {
+		return fmt.Errorf("Writing %q, %s", targetName, err)
+	}
+	return nil
+}
+
+// rewriteMediaRefs replaces the media references in body's links,
+// images and src and href attributes with their names. Text outside of
+// them is left alone.
+func rewriteMediaRefs(body string, names map[string]string) string {
+	for _, re := range mediaRefs {
+		body = re.ReplaceAllStringFunc(body, func(m string) string {
+			loc := re.FindStringSubmatchIndex(m)
+			if name, ok := names[m[loc[2]:loc[3]]]; ok {
+				return m[0:loc[2]] + name + m[loc[3]:]
+			}
+			return m
+		})
+	}
+	return body
+}
+
+// Import writes posts into prefix's YYYY/MM/DD folders as Markdown
+// documents with normalized front matter (title, date, creators,
+// keywords and draft), copies their media and adds them to the blog.
+// Nothing is written if a post's document already exists or two posts
+// have the same slug and date. Media files with the same name are
+// numbered, e.g. photo-2.jpg. It returns the redirects from the posts'
+// old URLs to their permalinks.
+func (meta *BlogMeta) Import(prefix string, posts []*ImportedPost) ([][]string, error) {
+	redirects := [][]string{}
+	docNames := map[string]string{}
+	for _, post := range posts {
+		post.Slug = Slugify(post.Slug)
+		if post.Slug == "" {
+			return redirects, fmt.Errorf("%s, %q is missing a slug", post.Source, post.Title)
+		}
+		ymd, err := calcYMD(post.Date)
+		if err != nil {
+			return redirects, fmt.Errorf("%s, %s", post.Source, err)
+		}
+		dPath, err := calcPath(prefix, ymd)
+		if err != nil {
+			return redirects, err
+		}
+		fName := path.Join(dPath, post.Slug+".md")
+		if source, ok := docNames[fName]; ok {
+			return redirects, fmt.Errorf("%s and %s are both imported as %q", source, post.Source, fName)
+		}
+		if _, err := os.Stat(fName); err == nil {
+			return redirects, fmt.Errorf("%s, %q already exists", post.Source, fName)
+		}
+		docNames[fName] = post.Source
+	}
+	copied := map[string]string{}
+	for _, post := range posts {
+		ymd, _ := calcYMD(post.Date)
+		dPath, _ := calcPath(prefix, ymd)
+		os.MkdirAll(dPath, 0777)
+		refs := []string{}
+		for ref := range post.Media {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+		names := map[string]string{}
+		for _, ref := range refs {
+			media := post.Media[ref]
+			mName := importMediaName(dPath, media, copied)
+			if _, ok := copied[mName]; ok == false {
+				// NOTE: BlogAsset keeps the file's name, numbered
+				// names are copied here.
+				if path.Base(mName) == filepath.Base(media) {
+					if err := meta.BlogAsset(prefix, media, post.Date); err != nil {
+						return redirects, fmt.Errorf("%s, %s", post.Source, err)
+					}
+				} else if err := copyFile(media, mName); err != nil {
+					return redirects, fmt.Errorf("%s, %s", post.Source, err)
+				}
+				copied[mName] = media
+			}
+			names[ref] = "/" + mName
+		}
+		body := rewriteMediaRefs(post.Body, names)
+		src, err := post.document(body)
+		if err != nil {
+			return redirects, fmt.Errorf("%s, %s", post.Source, err)
+		}
+		fName := path.Join(dPath, post.Slug+".md")
+		if err := ioutil.WriteFile(fName, src, 0666); err != nil {
+			return redirects, fmt.Errorf("Writing %q, %s", fName, err)
+		}
+		if err := meta.BlogIt(prefix, fName, post.Date); err != nil {
+			return redirects, fmt.Errorf("%s, %s", post.Source, err)
+		}
+		dy := meta.year(ymd[0]).month(ymd[1]).day(ymd[2])
+		permalink := meta.PostPermalink(dy.Posts[dy.postIndex(post.Slug)])
+		for _, u := range post.URLs {
+			if u != "" && u != permalink {
+				redirects = append(redirects, []string{u, permalink})
+			}
+		}
+	}
+	return redirects, nil
+}
@@ -0,0 +1,289 @@
+// blogimport_test.go test routines for blogimport.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+package mkpage
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes test fixtures, the map is file name to content
+func writeFiles(t *testing.T, files map[string]string) {
+	for fName, src := range files {
+		os.MkdirAll(path.Dir(fName), 0777)
+		if err := ioutil.WriteFile(fName, []byte(src), 0666); err != nil {
+			t.Errorf("Can't create %q, %s", fName, err)
+			t.FailNow()
+		}
+	}
+}
+
+func TestImport(t *testing.T) {
+	dName := path.Join("test", "import")
+	os.RemoveAll(dName)
+	jekyll := path.Join(dName, "jekyll")
+	hugo := path.Join(dName, "hugo")
+	wordpress := path.Join(dName, "wordpress.xml")
+	uploads := path.Join(dName, "uploads")
+	writeFiles(t, map[string]string{
+		path.Join(jekyll, "_posts", "2021-03-15-hello-jekyll.md"): `---
+layout: post
+title: "Hello: Jekyll"
+author: Jane Doe
+categories: news events
+tags: [go]
+description: A first post
+updated: 2021-03-20
+---
+
+![Cover]({{ site.baseurl }}/assets/cover.png)
+
+See [the report](/assets/report.pdf) and [other post](/2021/01/01/other.html).
+`,
+		path.Join(jekyll, "assets", "cover.png"):         "PNG",
+		path.Join(jekyll, "assets", "report.pdf"):        "PDF",
+		path.Join(jekyll, "_posts", "notes.txt"):         "Not a post",
+		path.Join(hugo, "content", "posts", "_index.md"): "+++\ntitle = \"Posts\"\n+++\n",
+		path.Join(hugo, "content", "posts", "toml-post.md"): `+++
+title = "TOML post"
+date = 2021-04-01T09:30:00-07:00
+draft = true
+tags = ["go", "hugo"]
+aliases = ["/old/toml-post/"]
+updated = 2021-04-05T08:00:00-07:00
+image = "/images/photo.jpg"
++++
+
+![Photo](/images/photo.jpg)
+`,
+		path.Join(hugo, "static", "images", "photo.jpg"): "JPG",
+		path.Join(hugo, "content", "posts", "bundle", "index.md"): `---
+title: Bundle post
+date: 2021-04-02
+slug: my-bundle
+---
+
+![Chart](chart.svg)
+`,
+		path.Join(hugo, "content", "posts", "bundle", "chart.svg"): "SVG",
+		path.Join(uploads, "2021", "05", "map.jpg"):                "JPG",
+		wordpress: `<?xml version="1.0" encoding="UTF-8" ?>
+<rss version="2.0"
+	xmlns:excerpt="http://wordpress.org/export/1.2/excerpt/"
+	xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:dc="http://purl.org/dc/elements/1.1/"
+	xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+	<title>Old Blog</title>
+	<wp:author><wp:author_login><![CDATA[jdoe]]></wp:author_login><wp:author_email><![CDATA[jdoe@example.edu]]></wp:author_email><wp:author_display_name><![CDATA[Jane Doe]]></wp:author_display_name></wp:author>
+	<item>
+		<title>Hello WordPress</title>
+		<link>https://old.example.edu/2021/05/01/hello-wordpress/</link>
+		<dc:creator><![CDATA[jdoe]]></dc:creator>
+		<content:encoded><![CDATA[<p>A map <img src="https://old.example.edu/wp-content/uploads/2021/05/map.jpg" /></p>]]></content:encoded>
+		<excerpt:encoded><![CDATA[An excerpt]]></excerpt:encoded>
+		<wp:post_id>7</wp:post_id>
+		<wp:post_date><![CDATA[2021-05-01 10:00:00]]></wp:post_date>
+		<wp:post_date_gmt><![CDATA[2021-05-01 17:00:00]]></wp:post_date_gmt>
+		<wp:post_name><![CDATA[hello-wordpress]]></wp:post_name>
+		<wp:status><![CDATA[publish]]></wp:status>
+		<wp:post_type><![CDATA[post]]></wp:post_type>
+		<category domain="category" nicename="uncategorized"><![CDATA[Uncategorized]]></category>
+		<category domain="post_tag" nicename="maps"><![CDATA[Maps]]></category>
+	</item>
+	<item>
+		<title>About</title>
+		<link>https://old.example.edu/about/</link>
+		<wp:post_type><![CDATA[page]]></wp:post_type>
+		<wp:status><![CDATA[publish]]></wp:status>
+	</item>
+	<item>
+		<title>Unfinished</title>
+		<link>https://old.example.edu/?p=9</link>
+		<wp:post_id>9</wp:post_id>
+		<wp:post_date><![CDATA[0000-00-00 00:00:00]]></wp:post_date>
+		<wp:status><![CDATA[draft]]></wp:status>
+		<wp:post_type><![CDATA[post]]></wp:post_type>
+	</item>
+</channel>
+</rss>
+`,
+	})
+
+	prefix := path.Join(dName, "blog")
+	meta := new(BlogMeta)
+	for _, source := range []string{jekyll, path.Join(hugo, "content", "posts"), wordpress} {
+		posts, err := ReadImport(source, uploads)
+		if err != nil {
+			t.Errorf("ReadImport(%q) failed, %s", source, err)
+			t.FailNow()
+		}
+		redirects, err := meta.Import(prefix, posts)
+		if err != nil {
+			t.Errorf("Import(%q) failed, %s", source, err)
+			t.FailNow()
+		}
+		rows := []string{}
+		for _, row := range redirects {
+			rows = append(rows, strings.Join(row, " "))
+		}
+		expected := map[string]string{
+			jekyll: "/news/events/2021/03/15/hello-jekyll.html /" + prefix + "/2021/03/15/hello-jekyll.html",
+			path.Join(hugo, "content", "posts"): strings.Join([]string{
+				"/posts/my-bundle/ /" + prefix + "/2021/04/02/my-bundle.html",
+				"/posts/toml-post/ /" + prefix + "/2021/04/01/toml-post.html",
+				"/old/toml-post/ /" + prefix + "/2021/04/01/toml-post.html",
+			}, "\n"),
+			wordpress: "/2021/05/01/hello-wordpress/ /" + prefix + "/2021/05/01/hello-wordpress.html",
+		}[source]
+		if strings.Join(rows, "\n") != expected {
+			t.Errorf("expected redirects for %q\n%s\ngot\n%s", source, expected, strings.Join(rows, "\n"))
+		}
+	}
+
+	post, ymd, err := meta.FindPost("hello-jekyll")
+	if err != nil {
+		t.Errorf("expected the Jekyll post, %s", err)
+		t.FailNow()
+	}
+	if post.Title != "Hello: Jekyll" || len(post.Creators) != 1 || post.Creators[0].Name != "Jane Doe" || strings.Join(post.Keywords, ",") != "go,news,events" || post.Draft {
+		t.Errorf("expected normalized front matter, got %+v", post)
+	}
+	if post.Description != "A first post" || post.Updated != "2021-03-20" {
+		t.Errorf("expected the description and updated to be kept, got %q, %q", post.Description, post.Updated)
+	}
+	if _, ok := post.Extra["layout"]; ok {
+		t.Errorf("expected layout to be dropped, got %+v", post.Extra)
+	}
+	src, _ := ioutil.ReadFile(post.Document)
+	dPath := path.Join(prefix, strings.Join(ymd, "/"))
+	for _, fName := range []string{"cover.png", "report.pdf"} {
+		if _, err := os.Stat(path.Join(dPath, fName)); err != nil {
+			t.Errorf("expected %s to be copied, %s", fName, err)
+		}
+		if strings.Contains(string(src), "/"+path.Join(dPath, fName)) == false {
+			t.Errorf("expected the link to %s to be updated, got\n%s", fName, src)
+		}
+	}
+	if strings.Contains(string(src), "](/2021/01/01/other.html)") == false {
+		t.Errorf("expected links to posts to be left, got\n%s", src)
+	}
+
+	post, _, _ = meta.FindPost("toml-post")
+	if post == nil || post.Created != "2021-04-01T09:30:00-07:00" || post.Draft == false || post.Extra["image"] != "/images/photo.jpg" || strings.Join(post.Keywords, ",") != "go,hugo" {
+		t.Errorf("expected the TOML front matter, got %+v", post)
+	}
+	if post != nil && post.Updated != "2021-04-05T08:00:00-07:00" {
+		t.Errorf("expected the TOML updated to be kept, got %q", post.Updated)
+	}
+	if _, err := os.Stat(path.Join(prefix, "2021", "04", "01", "photo.jpg")); err != nil {
+		t.Errorf("expected photo.jpg to be copied, %s", err)
+	}
+	if _, err := os.Stat(path.Join(prefix, "2021", "04", "02", "chart.svg")); err != nil {
+		t.Errorf("expected the bundle's chart.svg to be copied, %s", err)
+	}
+
+	post, _, _ = meta.FindPost("hello-wordpress")
+	if post == nil || post.Created != "2021-05-01T10:00:00-07:00" || post.Creators[0].Email != "jdoe@example.edu" || strings.Join(post.Keywords, ",") != "Maps" || post.Description != "An excerpt" || post.Draft {
+		t.Errorf("expected the WordPress post, got %+v", post)
+	}
+	src, _ = ioutil.ReadFile(post.Document)
+	if strings.Contains(string(src), `src="/`+path.Join(prefix, "2021", "05", "01", "map.jpg")+`"`) == false {
+		t.Errorf("expected the upload to be copied, got\n%s", src)
+	}
+	if post, _, err := meta.FindPost("unfinished"); err != nil || post.Draft == false {
+		t.Errorf("expected the unfinished post as a draft, %+v, %v", post, err)
+	}
+	if _, _, err := meta.FindPost("about"); err == nil {
+		t.Errorf("expected pages to be skipped")
+	}
+	if issues := meta.Check(prefix); len(issues) != 0 {
+		t.Errorf("expected no issues, got %+v", issues[0])
+	}
+
+	// Importing again must not overwrite posts
+	jekyllPost, _, _ := meta.FindPost("hello-jekyll")
+	ioutil.WriteFile(jekyllPost.Document, []byte("---\ntitle: Edited\ndate: 2021-03-15\n---\n\nEdited\n"), 0666)
+	posts, err := ReadImport(jekyll, "")
+	if err != nil {
+		t.Errorf("ReadImport(%q) failed, %s", jekyll, err)
+		t.FailNow()
+	}
+	if _, err := meta.Import(prefix, posts); err == nil || strings.Contains(err.Error(), "already exists") == false {
+		t.Errorf("expected importing again to be refused, got %v", err)
+	}
+	if src, _ := ioutil.ReadFile(jekyllPost.Document); strings.Contains(string(src), "Edited") == false {
+		t.Errorf("expected the edited post to be left, got\n%s", src)
+	}
+
+	// Posts with the same slug and date are refused, media with the
+	// same name from different folders get their own names
+	clash := path.Join(dName, "clash")
+	writeFiles(t, map[string]string{
+		path.Join(clash, "same", "a", "index.md"):     "---\ntitle: A\nslug: same\ndate: 2021-06-01\n---\n\n![A](a.png)\n",
+		path.Join(clash, "same", "a", "a.png"):        "A",
+		path.Join(clash, "same", "b", "index.md"):     "---\ntitle: B\nslug: same\ndate: 2021-06-01\n---\n\n![B](b.png)\n",
+		path.Join(clash, "same", "b", "b.png"):        "B",
+		path.Join(clash, "media", "one", "index.md"):  "---\ntitle: One\ndate: 2021-06-02\n---\n\n![One](photo.jpg)\n\nSee myphoto.jpg, `photo.jpg` is text.\n",
+		path.Join(clash, "media", "one", "photo.jpg"): "C",
+		path.Join(clash, "media", "two", "index.md"):  "---\ntitle: Two\ndate: 2021-06-02\n---\n\n![Two](photo.jpg)\n",
+		path.Join(clash, "media", "two", "photo.jpg"): "D",
+	})
+	posts, err = ReadImport(path.Join(clash, "same"), "")
+	if err != nil {
+		t.Errorf("ReadImport failed, %s", err)
+		t.FailNow()
+	}
+	if _, err := meta.Import(prefix, posts); err == nil || strings.Contains(err.Error(), "both imported as") == false {
+		t.Errorf("expected posts with the same slug and date to be refused, got %v", err)
+	}
+	if _, err := os.Stat(path.Join(prefix, "2021", "06", "01")); err == nil {
+		t.Errorf("expected nothing to be written for a refused import")
+	}
+	posts, err = ReadImport(path.Join(clash, "media"), "")
+	if err != nil {
+		t.Errorf("ReadImport failed, %s", err)
+		t.FailNow()
+	}
+	if _, err := meta.Import(prefix, posts); err != nil {
+		t.Errorf("Import failed, %s", err)
+		t.FailNow()
+	}
+	dPath = path.Join(prefix, "2021", "06", "02")
+	for slug, expected := range map[string]string{"one": "photo.jpg", "two": "photo-2.jpg"} {
+		post, _, err := meta.FindPost(slug)
+		if err != nil {
+			t.Errorf("expected %q, %s", slug, err)
+			continue
+		}
+		src, _ := ioutil.ReadFile(post.Document)
+		if strings.Contains(string(src), "](/"+path.Join(dPath, expected)+")") == false {
+			t.Errorf("expected %q to link to %s, got\n%s", slug, expected, src)
+		}
+		if slug == "one" && strings.Contains(string(src), "See myphoto.jpg, `photo.jpg` is text.") == false {
+			t.Errorf("expected only links to be updated, got\n%s", src)
+		}
+	}
+	for fName, expected := range map[string]string{"photo.jpg": "C", "photo-2.jpg": "D"} {
+		if src, _ := ioutil.ReadFile(path.Join(dPath, fName)); string(src) != expected {
+			t.Errorf("expected %s to hold %q, got %q", fName, expected, src)
+		}
+	}
+}
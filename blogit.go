@@ -26,17 +26,30 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
 
 const (
 	DateFmt = "2006-01-02"
+	// TimestampFmt is the format of a post date with a time of day
+	// and timezone, e.g. 2021-03-15T14:30:00-07:00
+	TimestampFmt = time.RFC3339
 )
 
 type CreatorObj struct {
-	ORCID string `json:"orcid,omitempty"`
-	Name  string `json:"name,omitempty"`
+	// ID is the person's id in the blog's people file
+	ID    string `json:"id,omitempty" yaml:"id,omitempty"`
+	ORCID string `json:"orcid,omitempty" yaml:"orcid,omitempty"`
+	Name  string `json:"name,omitempty" yaml:"name,omitempty"`
+	// ROR is the ROR id of the person's affiliation
+	ROR         string `json:"ror,omitempty" yaml:"ror,omitempty"`
+	Affiliation string `json:"affiliation,omitempty" yaml:"affiliation,omitempty"`
+	Email       string `json:"email,omitempty" yaml:"email,omitempty"`
+	// URL is the person's profile page
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
 }
 
 type PostObj struct {
@@ -58,6 +71,9 @@ type PostObj struct {
 	Creators    []CreatorObj `json:"creators,omitempty"`
 	Created     string       `json:"date,omitempty"`
 	Updated     string       `json:"updated,omitempty"`
+	Expires     string       `json:"expires,omitempty"`
+	// Extra holds the front matter fields not listed above, e.g. image
+	Extra map[string]interface{} `json:"extra,omitempty"`
 }
 
 type DayObj struct {
@@ -76,28 +92,86 @@ type YearObj struct {
 }
 
 type BlogMeta struct {
-	Name        string     `json:"name,omitempty"`
-	Quip        string     `json:"quip,omitempty"`
-	Description string     `json:"description,omitempty"`
-	BaseURL     string     `json:"url,omitempty"`
-	Copyright   string     `json:"copyright,omitempty"`
-	License     string     `json:"license,omitempty"`
-	Language    string     `json:"language,omitempty"`
-	Started     string     `json:"started,omitempty"`
-	Ended       string     `json:"ended,omitempty"`
-	Updated     string     `json:"updated,omitempty"`
-	IndexTmpl   string     `json:"index_tmpl,omitempty"`
-	PostTmpl    string     `json:"post_tmpl,omitempty"`
-	Years       []*YearObj `json:"years"`
+	Name          string     `json:"name,omitempty"`
+	Quip          string     `json:"quip,omitempty"`
+	Description   string     `json:"description,omitempty"`
+	BaseURL       string     `json:"url,omitempty"`
+	Copyright     string     `json:"copyright,omitempty"`
+	License       string     `json:"license,omitempty"`
+	Language      string     `json:"language,omitempty"`
+	Started       string     `json:"started,omitempty"`
+	Ended         string     `json:"ended,omitempty"`
+	Updated       string     `json:"updated,omitempty"`
+	IndexTmpl     string     `json:"index_tmpl,omitempty"`
+	PostTmpl      string     `json:"post_tmpl,omitempty"`
+	YearTmpl      string     `json:"year_tmpl,omitempty"`
+	MonthTmpl     string     `json:"month_tmpl,omitempty"`
+	DayTmpl       string     `json:"day_tmpl,omitempty"`
+	ArchiveJSON   bool       `json:"archive_json,omitempty"`
+	TaxonomyTmpl  string     `json:"taxonomy_tmpl,omitempty"`
+	KeywordTmpl   string     `json:"keyword_tmpl,omitempty"`
+	CategoryTmpl  string     `json:"category_tmpl,omitempty"`
+	SeriesTmpl    string     `json:"series_tmpl,omitempty"`
+	TaxonomyJSON  bool       `json:"taxonomy_json,omitempty"`
+	PageSize      int        `json:"page_size,omitempty"`
+	PagePattern   string     `json:"page_pattern,omitempty"`
+	Permalink     string     `json:"permalink,omitempty"`
+	Backups       int        `json:"backups,omitempty"`
+	AuthorTmpl    string     `json:"author_tmpl,omitempty"`
+	People        string     `json:"people,omitempty"`
+	DefaultAuthor string     `json:"default_author,omitempty"`
+	PostSkeleton  string     `json:"post_skeleton,omitempty"`
+	DraftsDir     string     `json:"drafts_dir,omitempty"`
+	Years         []*YearObj `json:"years"`
+
+	// Drafts includes draft posts when rendering and in feeds, e.g. to
+	// preview them
+	Drafts bool `json:"-"`
+	// Future includes posts dated after today
+	Future bool `json:"-"`
+
+	// people holds the people file by id once read
+	people map[string]*CreatorObj
+	// dName is the directory of the blog meta document, People is
+	// relative to it
+	dName string
 }
 
 //
 // Support funcs
 //
 
+// ParsePostDate parses a post date, either a date (YYYY-MM-DD, in
+// local time) or a timestamp (e.g. 2021-03-15T14:30:00-07:00 or
+// 2021-03-15 14:30:00 -0700).
+func ParsePostDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case len(s) == len(DateFmt):
+		return time.ParseInLocation(DateFmt, s, time.Local)
+	case strings.Contains(s, "T"):
+		return time.Parse(TimestampFmt, s)
+	}
+	return NormalizeDate(s)
+}
+
+// formatPostDate formats a front matter date, a date is kept as a
+// date unless it has a time of day.
+func formatPostDate(t time.Time) string {
+	if t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0 {
+		return t.Format(DateFmt)
+	}
+	return t.Format(TimestampFmt)
+}
+
+// calcYMD returns the year, month and day of a post date, a
+// timestamp's date is in its own timezone.
 func calcYMD(dateString string) ([]string, error) {
-	ymd := strings.SplitN(dateString, "-", 3)
-	return ymd, nil
+	dt, err := ParsePostDate(dateString)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid date %q, %s", dateString, err)
+	}
+	return []string{dt.Format("2006"), dt.Format("01"), dt.Format("02")}, nil
 }
 
 func calcPath(prefix string, ymd []string) (string, error) {
@@ -108,27 +182,187 @@ func calcPath(prefix string, ymd []string) (string, error) {
 	return dPath, nil
 }
 
+// unpackCreator returns a creator from a name or a map as decoded from
+// JSON, YAML or TOML front matter.
+func unpackCreator(obj interface{}) (CreatorObj, bool) {
+	creator := CreatorObj{}
+	switch obj.(type) {
+	case string:
+		creator.Name = obj.(string)
+	case map[string]string:
+		m := obj.(map[string]string)
+		creator.Name, creator.ORCID = m["name"], m["orcid"]
+	case map[string]interface{}, map[interface{}]interface{}:
+		m := asJSONValue(obj).(map[string]interface{})
+		for key, field := range map[string]*string{
+			"id":          &creator.ID,
+			"name":        &creator.Name,
+			"orcid":       &creator.ORCID,
+			"ror":         &creator.ROR,
+			"affiliation": &creator.Affiliation,
+			"email":       &creator.Email,
+			"url":         &creator.URL,
+		} {
+			*field, _ = asString(m[key])
+		}
+	default:
+		return creator, false
+	}
+	return creator, creator != CreatorObj{}
+}
+
 func unpackCreators(objects []interface{}) []CreatorObj {
 	creators := []CreatorObj{}
 	for _, obj := range objects {
-		switch obj.(type) {
-		case string:
-			creator := CreatorObj{}
-			creator.Name = obj.(string)
+		if creator, ok := unpackCreator(obj); ok {
 			creators = append(creators, creator)
-		case map[string]string:
-			m := obj.(map[string]string)
-			creator := CreatorObj{}
-			if name, ok := m["name"]; ok {
-				creator.Name = name
+		}
+	}
+	return creators
+}
+
+// asString returns a front matter value as a string, e.g. a series
+// number decoded as an int or a date decoded as a time.Time.
+func asString(val interface{}) (string, bool) {
+	switch val.(type) {
+	case string:
+		return val.(string), true
+	case int, int64, uint64:
+		return fmt.Sprintf("%d", val), true
+	case float64:
+		return strconv.FormatFloat(val.(float64), 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(val.(bool)), true
+	case time.Time:
+		return formatPostDate(val.(time.Time)), true
+	case fmt.Stringer:
+		return val.(fmt.Stringer).String(), true
+	}
+	return "", false
+}
+
+// asStrings returns a front matter list as a list of strings, a single
+// value is a list of one.
+func asStrings(val interface{}) []string {
+	list := []string{}
+	switch val.(type) {
+	case []string:
+		list = append(list, val.([]string)...)
+	case []interface{}:
+		for _, item := range val.([]interface{}) {
+			if s, ok := asString(item); ok {
+				list = append(list, s)
 			}
-			if orcid, ok := m["orcid"]; ok {
-				creator.ORCID = orcid
+		}
+	default:
+		if s, ok := asString(val); ok && s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// asBool returns a front matter value as a bool, e.g. "draft: yes"
+func asBool(val interface{}) bool {
+	switch val.(type) {
+	case bool:
+		return val.(bool)
+	case string:
+		switch strings.ToLower(strings.TrimSpace(val.(string))) {
+		case "true", "yes", "on", "1":
+			return true
+		}
+	}
+	return false
+}
+
+// asJSONValue converts a decoded front matter value so it can be
+// stored in blog.json, e.g. YAML maps with interface{} keys and dates.
+func asJSONValue(val interface{}) interface{} {
+	switch val.(type) {
+	case time.Time:
+		return formatPostDate(val.(time.Time))
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range val.(map[interface{}]interface{}) {
+			m[fmt.Sprintf("%v", k)] = asJSONValue(v)
+		}
+		return m
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range val.(map[string]interface{}) {
+			m[k] = asJSONValue(v)
+		}
+		return m
+	case []interface{}:
+		list := []interface{}{}
+		for _, v := range val.([]interface{}) {
+			list = append(list, asJSONValue(v))
+		}
+		return list
+	case fmt.Stringer:
+		return val.(fmt.Stringer).String()
+	}
+	return val
+}
+
+// setFrontMatter sets the post's fields from its front matter, fields
+// PostObj doesn't have are kept in Extra.
+func (post *PostObj) setFrontMatter(obj map[string]interface{}) {
+	for key, val := range obj {
+		s, _ := asString(val)
+		switch key {
+		case "title":
+			post.Title = s
+		case "subtitle":
+			post.SubTitle = s
+		case "byline":
+			post.Byline = s
+		case "series":
+			post.Series = s
+		case "number":
+			post.Number = s
+		case "subject":
+			post.Subject = s
+		case "keywords":
+			post.Keywords = asStrings(val)
+		case "abstract":
+			post.Abstract = s
+		case "description":
+			post.Description = s
+		case "category":
+			post.Category = s
+		case "lang":
+			post.Lang = s
+		case "direction":
+			post.Direction = s
+		case "draft":
+			post.Draft = asBool(val)
+		case "creators", "authors", "author":
+			// NOTE: authors are usually people ids, e.g. "authors: [rsdoiel]"
+			switch val.(type) {
+			case []interface{}:
+				post.Creators = append(post.Creators, unpackCreators(val.([]interface{}))...)
+			default:
+				post.Creators = append(post.Creators, unpackCreators([]interface{}{val})...)
 			}
-			creators = append(creators, creator)
+		case "date":
+			if s != "" {
+				post.Created = s
+			}
+		case "updated":
+			if s != "" {
+				post.Updated = s
+			}
+		case "expires":
+			post.Expires = s
+		default:
+			if post.Extra == nil {
+				post.Extra = map[string]interface{}{}
+			}
+			post.Extra[key] = asJSONValue(val)
 		}
 	}
-	return creators
 }
 
 //
@@ -186,21 +420,86 @@ func (meta BlogMeta) yearIndex(year string) int {
 	return yearIndex
 }
 
-// updatePosts will create a new post if necessary and insert in to the
-// post list.
-func (dy *DayObj) updatePosts(ymd []string, targetName string) error {
-
-	// Read in front matter from targetName
-	src, err := ioutil.ReadFile(targetName)
+// readFrontMatter returns the front matter of a post's document, it is
+// empty if the document doesn't have any.
+func readFrontMatter(fName string) (map[string]interface{}, error) {
+	src, err := ioutil.ReadFile(fName)
 	if err != nil {
-		return fmt.Errorf("Failed to read post %q, %s", targetName, err)
+		return nil, fmt.Errorf("Failed to read post %q, %s", fName, err)
 	}
 	obj := map[string]interface{}{}
 	fmType, src, _ := SplitFrontMatter(src)
 	if len(src) > 0 {
 		if err := UnmarshalFrontMatter(fmType, src, &obj); err != nil {
-			return fmt.Errorf("Failed to unmarshal front matter %q, %s", targetName, err)
+			return nil, fmt.Errorf("Failed to unmarshal front matter %q, %s", fName, err)
+		}
+	}
+	return obj, nil
+}
+
+// setPostDate sets the date in a post document's front matter, other
+// front matter is left as is. A Markdown document without front matter
+// gets a YAML block holding the date, other documents without front
+// matter are left alone.
+func setPostDate(fName string, dateString string) error {
+	src, err := ioutil.ReadFile(fName)
+	if err != nil {
+		return fmt.Errorf("Failed to read post %q, %s", fName, err)
+	}
+	fmType, fmSrc, body := SplitFrontMatter(src)
+	switch fmType {
+	case FrontMatterIsYAML:
+		lines := strings.Split(strings.TrimSuffix(strings.TrimPrefix(string(fmSrc), "---\n"), "\n---\n"), "\n")
+		found := false
+		for i, line := range lines {
+			if strings.HasPrefix(line, "date:") {
+				lines[i], found = fmt.Sprintf("date: %q", dateString), true
+				break
+			}
+		}
+		if found == false {
+			lines = append([]string{fmt.Sprintf("date: %q", dateString)}, lines...)
+		}
+		src = []byte(fmt.Sprintf("---\n%s\n---\n%s", strings.Join(lines, "\n"), body))
+	case FrontMatterIsJSON:
+		obj := map[string]interface{}{}
+		if err := json.Unmarshal(fmSrc, &obj); err != nil {
+			return fmt.Errorf("Failed to unmarshal front matter %q, %s", fName, err)
+		}
+		obj["date"] = dateString
+		fmSrc, err = json.MarshalIndent(obj, "", "    ")
+		if err != nil {
+			return err
+		}
+		src = []byte(fmt.Sprintf("%s\n%s", fmSrc, body))
+	case FrontMatterIsPandocMetadata:
+		// % title, % authors then % date
+		lines := strings.Split(string(fmSrc), "\n")
+		for i, n := 0, 0; i < len(lines); i++ {
+			if strings.HasPrefix(lines[i], "% ") {
+				if n++; n == 3 {
+					lines[i] = "% " + dateString
+				}
+			}
+		}
+		src = []byte(strings.Join(lines, "\n") + string(body))
+	default:
+		if hasExt(path.Ext(fName), []string{".md", ".markdown"}) == false {
+			return nil
 		}
+		src = []byte(fmt.Sprintf("---\ndate: %q\n---\n\n%s", dateString, src))
+	}
+	return ioutil.WriteFile(fName, src, 0666)
+}
+
+// updatePosts will create a new post if necessary and insert in to the
+// post list.
+func (dy *DayObj) updatePosts(ymd []string, targetName string) error {
+
+	// Read in front matter from targetName
+	obj, err := readFrontMatter(targetName)
+	if err != nil {
+		return err
 	}
 	// Create a new PostObj
 	today := time.Now().Format(DateFmt)
@@ -210,192 +509,118 @@ func (dy *DayObj) updatePosts(ymd []string, targetName string) error {
 	post.Updated = today
 	post.Created = created
 	post.Slug = strings.TrimSuffix(path.Base(targetName), filepath.Ext(targetName))
-	if title, ok := obj["title"]; ok {
-		post.Title = title.(string)
-	}
-	if subtitle, ok := obj["subtitle"]; ok {
-		post.SubTitle = subtitle.(string)
-	}
-	if byline, ok := obj["byline"]; ok {
-		post.Byline = byline.(string)
-	}
-	if series, ok := obj["series"]; ok {
-		post.Series = series.(string)
-	}
-	if number, ok := obj["number"]; ok {
-		switch number.(type) {
-		case int:
-			post.Number = fmt.Sprintf("%d", number.(int))
-		case string:
-			post.Number = number.(string)
-		}
-	}
-	if subject, ok := obj["subject"]; ok {
-		post.Subject = subject.(string)
-	}
-	if objects, ok := obj["keywords"]; ok {
-		switch objects.(type) {
-		case []string:
-			keywords := objects.([]string)
-			for _, kw := range keywords {
-				post.Keywords = append(post.Keywords, kw)
-			}
-		}
-	}
-	if abstract, ok := obj["abstract"]; ok {
-		post.Abstract = abstract.(string)
-	}
-	if description, ok := obj["description"]; ok {
-		post.Description = description.(string)
-	}
-	if category, ok := obj["category"]; ok {
-		post.Category = category.(string)
-	}
-	if lang, ok := obj["lang"]; ok {
-		post.Lang = lang.(string)
-	}
-	if direction, ok := obj["direction"]; ok {
-		post.Direction = direction.(string)
-	}
-	if draft, ok := obj["draft"]; ok {
-		post.Draft = draft.(bool)
-	} else {
-		post.Draft = false
-	}
-	if creators, ok := obj["creators"]; ok {
-		post.Creators = unpackCreators(creators.([]interface{}))
-	}
-	if dt, ok := obj["date"]; ok {
-		switch dt.(type) {
-		case string:
-			post.Created = dt.(string)
-		case time.Time:
-			t := dt.(time.Time)
-			post.Created = t.Format("2006-01-02")
-		}
-	}
-	if updated, ok := obj["updated"]; ok {
-		switch updated.(type) {
-		case string:
-			post.Updated = updated.(string)
-		case time.Time:
-			t := updated.(time.Time)
-			post.Updated = t.Format("2006-01-02")
-		}
-	}
+	post.setFrontMatter(obj)
 
 	i := dy.postIndex(post.Slug)
 	if i < 0 {
-		// Add a post
-		post.Created = today
+		// Add a post, it keeps its date (from the front matter or
+		// path) so posts dated later can be held until then.
 		posts := dy.Posts[0:]
 		dy.Posts = append([]*PostObj{post}, posts...)
 	} else {
 		// Update a post
 		dy.Posts[i] = post
 	}
+	dy.sortPosts()
 	return nil
 }
 
-// updateDays will create a new day and insert in order
-// before passing the post data to UpdatePost()
-func (mn *MonthObj) updateDays(ymd []string, targetName string) error {
+// sortPosts orders a day's posts by their time, newest first. Posts
+// with the same time (e.g. only a date) keep their order.
+func (dy *DayObj) sortPosts() {
+	times := map[*PostObj]time.Time{}
+	for _, post := range dy.Posts {
+		times[post], _ = ParsePostDate(post.Created)
+	}
+	sort.SliceStable(dy.Posts, func(i, j int) bool {
+		return times[dy.Posts[i]].After(times[dy.Posts[j]])
+	})
+}
+
+// day returns the month's day, creating and inserting it in
+// descending order if needed.
+func (mn *MonthObj) day(day string) *DayObj {
+	if i := mn.dayIndex(day); i >= 0 {
+		return mn.Days[i]
+	}
 	dy := new(DayObj)
-	dy.Day = ymd[2]
-	i := mn.dayIndex(dy.Day)
-	if i < 0 {
-		if len(mn.Days) == 0 {
-			mn.Days = append(mn.Days, dy)
-			i = 0
-		} else {
-			for j, obj := range mn.Days {
-				if dy.Day > obj.Day {
-					i = j
-					if i == 0 {
-						mn.Days = append([]*DayObj{dy}, mn.Days...)
-					} else {
-						days := mn.Days[0 : j-1]
-						days = append(days, dy)
-						mn.Days = append(days, mn.Days[j:]...)
-					}
-					break
-				}
-			}
-			if i < 0 {
-				mn.Days = append(mn.Days, dy)
-				i = len(mn.Days) - 1
-			}
+	dy.Day = day
+	i := len(mn.Days)
+	for j, obj := range mn.Days {
+		if dy.Day > obj.Day {
+			i = j
+			break
 		}
 	}
-	return mn.Days[i].updatePosts(ymd, targetName)
+	mn.Days = append(mn.Days[0:i], append([]*DayObj{dy}, mn.Days[i:]...)...)
+	return dy
 }
 
-// updateMonths will create/update month
-// before passing the post data to UpdateDays()
-func (yr *YearObj) updateMonths(ymd []string, targetName string) error {
+// month returns the year's month, creating and inserting it in
+// descending order if needed.
+func (yr *YearObj) month(month string) *MonthObj {
+	if i := yr.monthIndex(month); i >= 0 {
+		return yr.Months[i]
+	}
 	mn := new(MonthObj)
-	mn.Month = ymd[1]
-	i := yr.monthIndex(mn.Month)
-	if i < 0 {
-		if len(yr.Months) == 0 {
-			yr.Months = append(yr.Months, mn)
-			i = 0
-		} else {
-			for j, obj := range yr.Months {
-				if mn.Month > obj.Month {
-					i = j
-					if i == 0 {
-						yr.Months = append([]*MonthObj{mn}, yr.Months...)
-					} else {
-						months := yr.Months[0 : j-1]
-						months = append(months, mn)
-						yr.Months = append(months, yr.Months[j:]...)
-					}
-					break
-				}
-			}
-			if i < 0 {
-				yr.Months = append(yr.Months, mn)
-				i = len(yr.Months) - 1
-			}
+	mn.Month = month
+	i := len(yr.Months)
+	for j, obj := range yr.Months {
+		if mn.Month > obj.Month {
+			i = j
+			break
 		}
 	}
-	return yr.Months[i].updateDays(ymd, targetName)
+	yr.Months = append(yr.Months[0:i], append([]*MonthObj{mn}, yr.Months[i:]...)...)
+	return mn
+}
+
+// year returns the blog's year, creating and inserting it in
+// descending order if needed.
+func (meta *BlogMeta) year(year string) *YearObj {
+	if i := meta.yearIndex(year); i >= 0 {
+		return meta.Years[i]
+	}
+	yr := new(YearObj)
+	yr.Year = year
+	i := len(meta.Years)
+	for j, obj := range meta.Years {
+		if yr.Year > obj.Year {
+			i = j
+			break
+		}
+	}
+	meta.Years = append(meta.Years[0:i], append([]*YearObj{yr}, meta.Years[i:]...)...)
+	return yr
+}
+
+// updateDays will create a new day and insert in order
+// before passing the post data to UpdatePost()
+func (mn *MonthObj) updateDays(ymd []string, targetName string) error {
+	return mn.day(ymd[2]).updatePosts(ymd, targetName)
+}
+
+// updateMonths will create/update month
+// before passing the post data to UpdateDays()
+func (yr *YearObj) updateMonths(ymd []string, targetName string) error {
+	return yr.month(ymd[1]).updateDays(ymd, targetName)
 }
 
 // updateYears will create/update year in `meta.Years`
 // before passing the post data to UpdateMonths()
 func (meta *BlogMeta) updateYears(ymd []string, targetName string) error {
-	yr := new(YearObj)
-	yr.Year = ymd[0]
-	i := meta.yearIndex(yr.Year)
-	if i < 0 {
-		if len(meta.Years) == 0 {
-			meta.Years = append(meta.Years, yr)
-			i = 0
-		} else {
-			for j, obj := range meta.Years {
-				if yr.Year > obj.Year {
-					i = j
-					if i == 0 {
-						meta.Years = append([]*YearObj{yr}, meta.Years...)
-					} else {
-						years := meta.Years[0 : j-1]
-						years = append(years, yr)
-						meta.Years = append(years, meta.Years[j:]...)
-					}
-					break
-				}
-			}
-			if i < 0 {
-				// We need to append the year, it's earlier than
-				// known years.
-				meta.Years = append(meta.Years, yr)
-				i = len(meta.Years) - 1
-			}
+	if err := meta.year(ymd[0]).updateMonths(ymd, targetName); err != nil {
+		return err
+	}
+	// Fill in the post's creators from the people file
+	dy := meta.year(ymd[0]).month(ymd[1]).day(ymd[2])
+	slug := strings.TrimSuffix(path.Base(targetName), filepath.Ext(targetName))
+	if i := dy.postIndex(slug); i >= 0 {
+		if err := meta.resolveCreators(dy.Posts[i]); err != nil {
+			return fmt.Errorf("%s, %s", targetName, err)
 		}
 	}
-	return meta.Years[i].updateMonths(ymd, targetName)
+	return nil
 }
 
 // BlogAsset copies a asset file to the directory as a blog post
@@ -426,6 +651,10 @@ func (meta *BlogMeta) BlogAsset(prefix string, fName string, dateString string)
 	in, err = os.Open(fName)
 	if err != nil {
 		return err
+	} else if isSameFile(fName, path.Join(dPath, path.Base(fName))) {
+		// NOTE: The document is already in place, e.g. a new post
+		in.Close()
+		targetName = path.Join(dPath, path.Base(fName))
 	} else {
 		os.MkdirAll(dPath, 0777)
 		targetName = path.Join(dPath, path.Base(fName))
@@ -476,6 +705,10 @@ func (meta *BlogMeta) BlogIt(prefix string, fName string, dateString string) err
 	in, err = os.Open(fName)
 	if err != nil {
 		return err
+	} else if isSameFile(fName, path.Join(dPath, path.Base(fName))) {
+		// NOTE: The document is already in place, e.g. a new post
+		in.Close()
+		targetName = path.Join(dPath, path.Base(fName))
 	} else {
 		os.MkdirAll(dPath, 0777)
 		targetName = path.Join(dPath, path.Base(fName))
@@ -492,18 +725,43 @@ func (meta *BlogMeta) BlogIt(prefix string, fName string, dateString string) err
 
 	// NOTE: Updated is always today.
 	meta.Updated = time.Now().Format(DateFmt)
-	return meta.updateYears(ymd, targetName)
+	if err := meta.updateYears(ymd, targetName); err != nil {
+		return err
+	}
+	// A timestamp is kept as the post date unless the front matter
+	// has one, it is written to the front matter so refreshing the
+	// blog keeps it.
+	if len(dateString) > len(DateFmt) {
+		dy := meta.year(ymd[0]).month(ymd[1]).day(ymd[2])
+		slug := strings.TrimSuffix(path.Base(targetName), filepath.Ext(targetName))
+		if i := dy.postIndex(slug); i >= 0 && dy.Posts[i].Created == strings.Join(ymd, "-") {
+			if err := setPostDate(targetName, dateString); err != nil {
+				return err
+			}
+			dy.Posts[i].Created = dateString
+			dy.sortPosts()
+		}
+	}
+	return nil
 }
 
-// Save writes a JSON blog meta document
+// Save writes a JSON blog meta document. It is written to a temp file
+// and renamed so an interrupted save leaves the old document. If
+// Backups is set the previous documents are kept as fName.1, fName.2,
+// etc.
 func (meta *BlogMeta) Save(fName string) error {
+	meta.dName = filepath.Dir(fName)
 	meta.Updated = time.Now().Format(DateFmt)
 	src, err := json.MarshalIndent(meta, "", "    ")
 	if err != nil {
 		return fmt.Errorf("Marshaling %q, %s", fName, err)
 	}
-	err = ioutil.WriteFile(fName, src, 0666)
-	if err != nil {
+	if meta.Backups > 0 {
+		if err := rotateBackups(fName, meta.Backups); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(fName, src, 0666); err != nil {
 		return fmt.Errorf("Writing %q, %s", fName, err)
 	}
 	return nil
@@ -520,6 +778,7 @@ func LoadBlogMeta(fName string, meta *BlogMeta) error {
 			return fmt.Errorf("Unmarshing %q, %s", fName, err)
 		}
 	}
+	meta.dName = filepath.Dir(fName)
 	return nil
 }
 
@@ -533,49 +792,112 @@ func hasExt(ext string, targetExts []string) bool {
 	return false
 }
 
-// RefreshFromPath crawls the dircetory tree and rebuilds
-// the `blog.json` file based on what is found. It takes a
-// File extension to target (e.g. .md for Markdown) and
-// analyzes the path for YYYY/MM/DD and transforms the
-// information found into an entry in `blog.json`.
-func (meta *BlogMeta) RefreshFromPath(prefix string, year string) error {
-	var (
-		ymd []string
-	)
-	targetExts := []string{
-		".md",
-		".rst",
-		".textile",
-		".jira",
-		".txt",
-	}
-	months := map[string]int{
-		"01": 31, "02": 29, "03": 31, "04": 30,
-		"05": 31, "06": 30, "07": 31, "08": 31,
-		"09": 30, "10": 31, "11": 30, "12": 31,
-	}
-	ymd = append(ymd, year, "", "")
-	for month, cnt := range months {
-		ymd[1] = month
-		for day := 1; day <= cnt; day++ {
-			ymd[2] = fmt.Sprintf("%02d", day)
-			// CalcPath and find files.
-			folder := path.Join(prefix, ymd[0], ymd[1], ymd[2])
-			// Scan the fold for files ending in ext,
-			files, err := ioutil.ReadDir(folder)
-			if err == nil {
-				// for each file with matching extension run updateYear(ymd, targetName)
-				for _, file := range files {
-					targetName := path.Join(prefix, ymd[0], ymd[1], ymd[2], file.Name())
-					ext := filepath.Ext(targetName)
-					if hasExt(ext, targetExts) {
-						if err := meta.updateYears(ymd, targetName); err != nil {
-							return err
-						}
-					}
+// subDirs returns the names of the directories in dName in sorted
+// order, e.g. the months of a year.
+func subDirs(dName string) []string {
+	names := []string{}
+	if dName == "" {
+		dName = "."
+	}
+	files, err := ioutil.ReadDir(dName)
+	if err != nil {
+		return names
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			names = append(names, file.Name())
+		}
+	}
+	return names
+}
+
+// isDigits returns true if s is n digits long, e.g. a month folder
+func isDigits(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// datedFolders returns the YYYY/MM/DD folders under prefix in
+// ascending order as year, month and day. If year is empty all
+// years are returned. The folder names may not be a valid date,
+// e.g. 2021/02/30.
+func datedFolders(prefix string, year string) [][]string {
+	folders := [][]string{}
+	years := []string{year}
+	if year == "" {
+		years = subDirs(prefix)
+	}
+	for _, yr := range years {
+		if isDigits(yr, 4) == false {
+			continue
+		}
+		for _, mn := range subDirs(path.Join(prefix, yr)) {
+			if isDigits(mn, 2) == false {
+				continue
+			}
+			for _, dy := range subDirs(path.Join(prefix, yr, mn)) {
+				if isDigits(dy, 2) {
+					folders = append(folders, []string{yr, mn, dy})
 				}
 			}
 		}
 	}
+	return folders
+}
+
+// postDocuments returns the post documents (see isPostDocument) in
+// folder in name order.
+func postDocuments(folder string) []string {
+	names := []string{}
+	files, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return names
+	}
+	for _, file := range files {
+		if file.IsDir() == false && isPostDocument(file.Name()) {
+			names = append(names, path.Join(folder, file.Name()))
+		}
+	}
+	return names
+}
+
+// isValidYMD returns true if the year, month and day are a date
+func isValidYMD(ymd []string) bool {
+	_, err := time.Parse(DateFmt, strings.Join(ymd, "-"))
+	return err == nil
+}
+
+// RefreshFromPath crawls the dircetory tree for a year and
+// updates `blog.json` based on what is found. It analyzes
+// the path for YYYY/MM/DD and adds the post documents (see
+// isPostDocument) found as entries in `blog.json`. Folders are
+// crawled in date order and files in name order.
+func (meta *BlogMeta) RefreshFromPath(prefix string, year string) error {
+	for _, ymd := range datedFolders(prefix, year) {
+		if isValidYMD(ymd) == false {
+			continue
+		}
+		folder := path.Join(prefix, ymd[0], ymd[1], ymd[2])
+		for _, targetName := range postDocuments(folder) {
+			if err := meta.updateYears(ymd, targetName); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
+
+// RefreshAll rebuilds the posts in `blog.json` from all the
+// YYYY/MM/DD folders under prefix. Posts whose documents are
+// no longer there are dropped.
+func (meta *BlogMeta) RefreshAll(prefix string) error {
+	meta.Years = []*YearObj{}
+	return meta.RefreshFromPath(prefix, "")
+}
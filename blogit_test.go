@@ -25,6 +25,9 @@ import (
 	"path"
 	"strings"
 	"testing"
+
+	// Caltech Library packages
+	"github.com/caltechlibrary/rss2"
 )
 
 func TestPrivateFuncs(t *testing.T) {
@@ -133,3 +136,168 @@ func TestRefreshFromPath(t *testing.T) {
 	}
 	meta.Save(blogJSON)
 }
+
+func TestPostTimestamps(t *testing.T) {
+	ymd, err := calcYMD("2021-03-15T23:30:00-07:00")
+	if err != nil || strings.Join(ymd, "-") != "2021-03-15" {
+		t.Errorf("expected 2021-03-15 in the timestamp's timezone, got %+v, %s", ymd, err)
+	}
+	if _, err := calcYMD("2021/03/15"); err == nil {
+		t.Errorf("expected an error for an invalid date")
+	}
+
+	prefix := path.Join("test", "timestamps")
+	os.RemoveAll(prefix)
+	os.MkdirAll(prefix, 0777)
+	meta := new(BlogMeta)
+	for _, item := range []struct {
+		slug, date, frontMatter string
+	}{
+		{"morning", "2021-03-15T09:00:00-07:00", ""},
+		{"evening", "2021-03-15", "date: 2021-03-15T18:45:00-07:00\n"},
+		{"noon", "2021-03-15T12:00:00-07:00", ""},
+		{"undated", "2021-03-15", ""},
+	} {
+		fName := path.Join("test", item.slug+".md")
+		src := fmt.Sprintf("---\ntitle: %s\n%s---\n\nHello\n", item.slug, item.frontMatter)
+		if err := ioutil.WriteFile(fName, []byte(src), 0666); err != nil {
+			t.Errorf("Can't create %q, %s", fName, err)
+			t.FailNow()
+		}
+		if err := meta.BlogIt(prefix, fName, item.date); err != nil {
+			t.Errorf("BlogIt(%q, %q, %q) failed, %s", prefix, fName, item.date, err)
+			t.FailNow()
+		}
+	}
+	dy := meta.Years[0].Months[0].Days[0]
+	slugs := []string{}
+	for _, post := range dy.Posts {
+		slugs = append(slugs, post.Slug)
+	}
+	if strings.Join(slugs, ",") != "evening,noon,morning,undated" {
+		t.Errorf("expected posts ordered by time, got %s", strings.Join(slugs, ","))
+	}
+	if dy.Posts[0].Created != "2021-03-15T18:45:00-07:00" || dy.Posts[1].Created != "2021-03-15T12:00:00-07:00" || dy.Posts[3].Created != "2021-03-15" {
+		t.Errorf("expected timestamps preserved, got %q, %q, %q", dy.Posts[0].Created, dy.Posts[1].Created, dy.Posts[3].Created)
+	}
+
+	// Timestamps given on the command line are written to the post
+	// so refreshing keeps them
+	if obj, err := readFrontMatter(path.Join(prefix, "2021", "03", "15", "morning.md")); err != nil || obj["date"] != "2021-03-15T09:00:00-07:00" {
+		t.Errorf("expected the timestamp in the front matter, got %+v, %v", obj, err)
+	}
+	refreshed := new(BlogMeta)
+	if err := refreshed.RefreshAll(prefix); err != nil {
+		t.Errorf("RefreshAll(%q) failed, %s", prefix, err)
+	}
+	if post, _, err := refreshed.FindPost("morning"); err != nil || post.Created != "2021-03-15T09:00:00-07:00" {
+		t.Errorf("expected the timestamp kept after refreshing, %+v, %v", post, err)
+	}
+
+	// Moving keeps the time of day
+	if _, err := meta.MovePost(prefix, "noon", "2021-03-20"); err != nil {
+		t.Errorf("MovePost() failed, %s", err)
+	}
+	if post, _, err := meta.FindPost("noon"); err != nil || post.Created != "2021-03-20T12:00:00-07:00" {
+		t.Errorf("expected the moved post to keep its time, %+v, %s", post, err)
+	}
+
+	feed := new(rss2.RSS2)
+	for _, post := range dy.Posts {
+		post.Description = post.Slug
+	}
+	if err := BlogMetaToRSS(meta, feed); err != nil {
+		t.Errorf("BlogMetaToRSS() failed, %s", err)
+		t.FailNow()
+	}
+	if len(feed.ItemList) != 4 || feed.ItemList[1].PubDate != "Mon, 15 Mar 2021 18:45:00 -0700" {
+		t.Errorf("expected a precise pubDate, got %+v", feed.ItemList)
+	}
+}
+
+func TestFrontMatterExtra(t *testing.T) {
+	prefix := path.Join("test", "extra")
+	os.RemoveAll(prefix)
+	os.MkdirAll(prefix, 0777)
+	meta := new(BlogMeta)
+	for _, item := range []struct {
+		slug, src string
+	}{
+		{"yaml-post", `---
+title: YAML post
+number: 2
+keywords: [go, blogs]
+creators:
+  - name: Jane Doe
+    orcid: 0000-0000-0000-0001
+  - John Doe
+draft: "yes"
+image: /media/cover.png
+location:
+  city: Pasadena
+event_date: 2021-04-01
+---
+
+Hello
+`},
+		{"json-post", `{
+    "title": "JSON post",
+    "keywords": ["go"],
+    "creators": [{"name": "Jane Doe"}],
+    "image": "/media/json.png",
+    "rating": 4.5
+}
+
+Hello
+`},
+	} {
+		fName := path.Join("test", item.slug+".md")
+		if err := ioutil.WriteFile(fName, []byte(item.src), 0666); err != nil {
+			t.Errorf("Can't create %q, %s", fName, err)
+			t.FailNow()
+		}
+		if err := meta.BlogIt(prefix, fName, "2021-03-15"); err != nil {
+			t.Errorf("BlogIt(%q, %q) failed, %s", prefix, fName, err)
+			t.FailNow()
+		}
+	}
+	post, _, err := meta.FindPost("yaml-post")
+	if err != nil {
+		t.Errorf("FindPost() failed, %s", err)
+		t.FailNow()
+	}
+	if post.Number != "2" || strings.Join(post.Keywords, ",") != "go,blogs" || post.Draft == false {
+		t.Errorf("expected number, keywords and draft, got %+v", post)
+	}
+	if len(post.Creators) != 2 || post.Creators[0].ORCID != "0000-0000-0000-0001" || post.Creators[1].Name != "John Doe" {
+		t.Errorf("expected two creators, got %+v", post.Creators)
+	}
+	if post.Extra["image"] != "/media/cover.png" || post.Extra["event_date"] != "2021-04-01" {
+		t.Errorf("expected image and event_date in extra, got %+v", post.Extra)
+	}
+	if _, ok := post.Extra["title"]; ok {
+		t.Errorf("expected title to not be in extra, got %+v", post.Extra)
+	}
+	if location, ok := post.Extra["location"].(map[string]interface{}); ok == false || location["city"] != "Pasadena" {
+		t.Errorf("expected location in extra, got %+v", post.Extra["location"])
+	}
+
+	// Extra survives a round trip through blog.json
+	fName := path.Join(prefix, "blog.json")
+	if err := meta.Save(fName); err != nil {
+		t.Errorf("Save(%q) failed, %s", fName, err)
+		t.FailNow()
+	}
+	meta = new(BlogMeta)
+	if err := LoadBlogMeta(fName, meta); err != nil {
+		t.Errorf("LoadBlogMeta(%q) failed, %s", fName, err)
+		t.FailNow()
+	}
+	post, _, err = meta.FindPost("json-post")
+	if err != nil || post.Extra["image"] != "/media/json.png" || post.Extra["rating"] != 4.5 {
+		t.Errorf("expected extra from blog.json, got %+v, %s", post, err)
+	}
+	if len(post.Creators) != 1 || post.Creators[0].Name != "Jane Doe" || len(post.Keywords) != 1 {
+		t.Errorf("expected creators and keywords from JSON front matter, got %+v", post)
+	}
+}
@@ -0,0 +1,297 @@
+//
+// Package mkpage blogmove.go removes blog posts and moves them to a new date,
+// pruning the Years/Months/Days tree and generating redirects.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FindPost returns the post for slug and its year, month and day. The
+// slug can be prefixed by the post's date (e.g. 2021-03-15/my-post)
+// when the same slug is used on more than one day.
+func (meta *BlogMeta) FindPost(slug string) (*PostObj, []string, error) {
+	var (
+		found *PostObj
+		ymd   []string
+		dates []string
+	)
+	date := ""
+	if i := strings.LastIndex(slug, "/"); i >= 0 {
+		date, slug = slug[0:i], slug[i+1:]
+	}
+	for _, yr := range meta.Years {
+		for _, mn := range yr.Months {
+			for _, dy := range mn.Days {
+				d := strings.Join([]string{yr.Year, mn.Month, dy.Day}, "-")
+				if date != "" && date != d {
+					continue
+				}
+				if i := dy.postIndex(slug); i >= 0 {
+					found, ymd = dy.Posts[i], []string{yr.Year, mn.Month, dy.Day}
+					dates = append(dates, d)
+				}
+			}
+		}
+	}
+	switch len(dates) {
+	case 0:
+		return nil, nil, fmt.Errorf("Can't find post %q", slug)
+	case 1:
+		return found, ymd, nil
+	}
+	return nil, nil, fmt.Errorf("%q is posted on %s, use DATE/SLUG (e.g. %s/%s)", slug, strings.Join(dates, ", "), dates[0], slug)
+}
+
+// prune removes the days without posts, months without days and years
+// without months.
+func (meta *BlogMeta) prune() {
+	years := []*YearObj{}
+	for _, yr := range meta.Years {
+		months := []*MonthObj{}
+		for _, mn := range yr.Months {
+			days := []*DayObj{}
+			for _, dy := range mn.Days {
+				if len(dy.Posts) > 0 {
+					days = append(days, dy)
+				}
+			}
+			if mn.Days = days; len(days) > 0 {
+				months = append(months, mn)
+			}
+		}
+		if yr.Months = months; len(months) > 0 {
+			years = append(years, yr)
+		}
+	}
+	meta.Years = years
+}
+
+// unlinkPost removes a post from the tree and prunes empty nodes
+func (meta *BlogMeta) unlinkPost(post *PostObj, ymd []string) {
+	dy := meta.year(ymd[0]).month(ymd[1]).day(ymd[2])
+	posts := []*PostObj{}
+	for _, p := range dy.Posts {
+		if p != post {
+			posts = append(posts, p)
+		}
+	}
+	dy.Posts = posts
+	meta.prune()
+}
+
+// postFiles returns the files in a post's directory named for its
+// slug, e.g. my-post.md, my-post.html and my-post.mp3, and the page
+// rendered at its permalink (see PostPageName).
+func (meta *BlogMeta) postFiles(post *PostObj) ([]string, error) {
+	files, err := filepath.Glob(path.Join(path.Dir(post.Document), post.Slug+".*"))
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, fName := range files {
+		if strings.TrimSuffix(path.Base(fName), path.Ext(fName)) == post.Slug {
+			names = append(names, filepath.ToSlash(fName))
+		}
+	}
+	page := meta.PostPageName(post)
+	if info, err := os.Stat(page); err == nil && info.IsDir() == false {
+		for _, fName := range names {
+			if path.Clean(fName) == path.Clean(page) {
+				return names, nil
+			}
+		}
+		names = append(names, page)
+	}
+	return names, nil
+}
+
+// removePageDir removes the directory of a page rendered at a pretty
+// permalink (e.g. blog/2021/03/my-post/index.html) once it is empty
+func (meta *BlogMeta) removePageDir(post *PostObj) {
+	if strings.HasSuffix(meta.PostPermalink(post), "/") {
+		// NOTE: Remove fails if anything is left in the directory
+		os.Remove(path.Dir(meta.PostPageName(post)))
+	}
+}
+
+// RemovePost removes a post from the blog and deletes its files, it
+// returns the files removed.
+func (meta *BlogMeta) RemovePost(slug string) ([]string, error) {
+	post, ymd, err := meta.FindPost(slug)
+	if err != nil {
+		return nil, err
+	}
+	files, err := meta.postFiles(post)
+	if err != nil {
+		return nil, err
+	}
+	for _, fName := range files {
+		if err := os.Remove(fName); err != nil {
+			return nil, fmt.Errorf("Removing %q, %s", fName, err)
+		}
+	}
+	meta.removePageDir(post)
+	meta.unlinkPost(post, ymd)
+	return files, nil
+}
+
+// movedDate returns the date of a post moved to dateString, a post with
+// a timestamp keeps its time of day when moved to a date.
+func movedDate(created string, dateString string) string {
+	if len(dateString) != len(DateFmt) || len(created) <= len(DateFmt) {
+		return dateString
+	}
+	old, err := ParsePostDate(created)
+	if err != nil {
+		return dateString
+	}
+	dt, err := time.Parse(DateFmt, dateString)
+	if err != nil {
+		return dateString
+	}
+	hr, min, sec := old.Clock()
+	return time.Date(dt.Year(), dt.Month(), dt.Day(), hr, min, sec, 0, old.Location()).Format(TimestampFmt)
+}
+
+// undoMoves moves files back to where they were, last first
+func undoMoves(moved [][]string) {
+	for i := len(moved) - 1; i >= 0; i-- {
+		os.Rename(moved[i][1], moved[i][0])
+	}
+}
+
+// MovePost moves a post and its files to the path for dateString under
+// prefix and updates its date, including the date in its front matter.
+// If a file can't be moved the files already moved are moved back. It
+// returns the old to new name of each file moved.
+func (meta *BlogMeta) MovePost(prefix string, slug string, dateString string) ([][]string, error) {
+	post, ymd, err := meta.FindPost(slug)
+	if err != nil {
+		return nil, err
+	}
+	newYMD, err := calcYMD(dateString)
+	if err != nil {
+		return nil, err
+	}
+	dPath, err := calcPath(prefix, newYMD)
+	if err != nil {
+		return nil, err
+	}
+	if p, _, _ := meta.FindPost(strings.Join(newYMD, "-") + "/" + post.Slug); p != nil {
+		return nil, fmt.Errorf("%q is already posted on %s", post.Slug, dateString)
+	}
+	files, err := meta.postFiles(post)
+	if err != nil {
+		return nil, err
+	}
+	movedPost := *post
+	movedPost.Document = path.Join(dPath, path.Base(post.Document))
+	movedPost.Created = movedDate(post.Created, dateString)
+	page := meta.PostPageName(post)
+	os.MkdirAll(dPath, 0777)
+	moved := [][]string{}
+	for _, fName := range files {
+		target := path.Join(dPath, path.Base(fName))
+		if fName == page && path.Dir(page) != path.Dir(post.Document) {
+			target = meta.PostPageName(&movedPost)
+			os.MkdirAll(path.Dir(target), 0777)
+		}
+		if err := os.Rename(fName, target); err != nil {
+			undoMoves(moved)
+			return nil, fmt.Errorf("Moving %q to %q, %s", fName, target, err)
+		}
+		moved = append(moved, []string{fName, target})
+	}
+	// Keep the front matter date in step so -check and -refresh agree
+	if obj, err := readFrontMatter(movedPost.Document); err != nil {
+		undoMoves(moved)
+		return nil, err
+	} else if _, ok := obj["date"]; ok || len(movedPost.Created) > len(DateFmt) {
+		if err := setPostDate(movedPost.Document, movedPost.Created); err != nil {
+			undoMoves(moved)
+			return nil, err
+		}
+	}
+	meta.removePageDir(post)
+	meta.unlinkPost(post, ymd)
+	post.Document, post.Created = movedPost.Document, movedPost.Created
+	dy := meta.year(newYMD[0]).month(newYMD[1]).day(newYMD[2])
+	dy.Posts = append([]*PostObj{post}, dy.Posts...)
+	dy.sortPosts()
+	return moved, nil
+}
+
+// MoveRedirects returns the target,destination redirects (URL paths)
+// for the posts moved by MovePost, from the post's old permalink to
+// its new one. Other HTML files moved are redirected by their path
+// relative to the working directory.
+func (meta *BlogMeta) MoveRedirects(moved [][]string) [][]string {
+	redirects := [][]string{}
+	seen := map[string]bool{}
+	for _, names := range moved {
+		target, destination := "/"+names[0], "/"+names[1]
+		if isPostDocument(names[0]) {
+			slug := strings.TrimSuffix(path.Base(names[0]), path.Ext(names[0]))
+			target = meta.PostPermalink(&PostObj{Slug: slug, Document: names[0]})
+			destination = meta.PostPermalink(&PostObj{Slug: slug, Document: names[1]})
+		} else if path.Ext(names[0]) != ".html" {
+			continue
+		} else if path.Base(names[0]) == "index.html" && path.Base(names[1]) == "index.html" {
+			// NOTE: pages at pretty permalinks redirect by directory
+			target, destination = path.Dir(target)+"/", path.Dir(destination)+"/"
+		}
+		if seen[target] == false && target != destination {
+			redirects = append(redirects, []string{target, destination})
+			seen[target] = true
+		}
+	}
+	return redirects
+}
+
+// WriteRedirectStubs writes a meta refresh page for each redirect from
+// MoveRedirects pointing to the new location, it returns the stubs
+// written.
+func WriteRedirectStubs(redirects [][]string) ([]string, error) {
+	stubs := []string{}
+	for _, row := range redirects {
+		target := strings.TrimPrefix(row[0], "/")
+		destination := strings.TrimPrefix(row[1], "/")
+		if strings.HasSuffix(target, "/") {
+			target += "index.html"
+			os.MkdirAll(path.Dir(target), 0777)
+		}
+		href := relHref(path.Dir(target), destination)
+		if strings.HasSuffix(destination, "/") {
+			href += "/"
+		}
+		if err := ioutil.WriteFile(target, RedirectStub(href), 0666); err != nil {
+			return stubs, fmt.Errorf("Writing %q, %s", target, err)
+		}
+		stubs = append(stubs, target)
+	}
+	return stubs, nil
+}
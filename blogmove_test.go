@@ -0,0 +1,217 @@
+//
+// blogmove_test.go test routines for blogmove.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestMovePost(t *testing.T) {
+	prefix := path.Join("test", "moves")
+	os.RemoveAll(prefix)
+	os.MkdirAll(prefix, 0777)
+	meta := new(BlogMeta)
+	for i, date := range []string{"2021-07-01", "2021-07-01", "2021-06-30"} {
+		fName := path.Join("test", fmt.Sprintf("post-%d.md", i))
+		if err := ioutil.WriteFile(fName, []byte(fmt.Sprintf("---\ntitle: Post %d\n---\n\nHello\n", i)), 0666); err != nil {
+			t.Errorf("Can't create %q, %s", fName, err)
+			t.FailNow()
+		}
+		if err := meta.BlogIt(prefix, fName, date); err != nil {
+			t.Errorf("BlogIt(%q, %q, %q) failed, %s", prefix, fName, date, err)
+			t.FailNow()
+		}
+	}
+	// A rendered page and an asset move with the post
+	ioutil.WriteFile(path.Join(prefix, "2021", "07", "01", "post-0.html"), []byte("<p>Hello</p>"), 0666)
+	ioutil.WriteFile(path.Join(prefix, "2021", "07", "01", "post-0.mp3"), []byte(""), 0666)
+
+	if _, _, err := meta.FindPost("no-such-post"); err == nil {
+		t.Errorf("expected an error for a missing post")
+	}
+	moved, err := meta.MovePost(prefix, "post-0", "2021-08-02")
+	if err != nil {
+		t.Errorf("MovePost() failed, %s", err)
+		t.FailNow()
+	}
+	if len(moved) != 3 {
+		t.Errorf("expected 3 files moved, got %+v", moved)
+	}
+	post, ymd, err := meta.FindPost("2021-08-02/post-0")
+	if err != nil {
+		t.Errorf("expected to find the moved post, %s", err)
+		t.FailNow()
+	}
+	if strings.Join(ymd, "-") != "2021-08-02" || post.Created != "2021-08-02" || post.Document != path.Join(prefix, "2021", "08", "02", "post-0.md") {
+		t.Errorf("unexpected moved post %+v, %+v", post, ymd)
+	}
+	if _, err := os.Stat(post.Document); err != nil {
+		t.Errorf("expected %q, %s", post.Document, err)
+	}
+	if len(meta.Years) != 1 || len(meta.Years[0].Months) != 3 || meta.Years[0].Months[0].Month != "08" {
+		t.Errorf("expected months 08, 07 and 06, got %+v", meta.Years[0].Months)
+	}
+
+	redirects := meta.MoveRedirects(moved)
+	if len(redirects) != 1 || redirects[0][0] != "/test/moves/2021/07/01/post-0.html" || redirects[0][1] != "/test/moves/2021/08/02/post-0.html" {
+		t.Errorf("unexpected redirects %+v", redirects)
+	}
+	csvName := path.Join(prefix, "redirects.csv")
+	for i := 0; i < 2; i++ {
+		if err := AppendRedirectsCSV(csvName, redirects); err != nil {
+			t.Errorf("AppendRedirectsCSV() failed, %s", err)
+			t.FailNow()
+		}
+	}
+	if src, _ := ioutil.ReadFile(csvName); strings.Count(string(src), "\n") != 2 {
+		t.Errorf("expected two rows appended, got %s", src)
+	}
+	rmap, err := ReadRedirectsCSV(csvName)
+	if err != nil || rmap["/test/moves/2021/07/01/post-0.html"] != "/test/moves/2021/08/02/post-0.html" {
+		t.Errorf("expected to read back redirects, %+v, %s", rmap, err)
+	}
+	stubs, err := WriteRedirectStubs(redirects)
+	if err != nil || len(stubs) != 1 {
+		t.Errorf("WriteRedirectStubs() failed, %+v, %s", stubs, err)
+	}
+	if src, _ := ioutil.ReadFile(stubs[0]); strings.Contains(string(src), `url=../../08/02/post-0.html`) == false {
+		t.Errorf("unexpected stub %s", src)
+	}
+
+	// Removing the last post of a month prunes the month
+	files, err := meta.RemovePost("post-2")
+	if err != nil || len(files) != 1 {
+		t.Errorf("RemovePost() failed, %+v, %s", files, err)
+	}
+	if len(meta.Years[0].Months) != 2 {
+		t.Errorf("expected month 06 to be pruned, got %+v", meta.Years[0].Months)
+	}
+	if _, err := meta.RemovePost("post-2"); err == nil {
+		t.Errorf("expected an error removing post-2 twice")
+	}
+
+	// Moving a post updates its front matter date, keeping the time
+	prefix = path.Join("test", "moves-dated")
+	os.RemoveAll(prefix)
+	meta = new(BlogMeta)
+	for _, item := range []struct{ name, date string }{
+		{"dated.md", "2021-03-15"},
+		{"timed.md", "2021-03-15T09:30:00-07:00"},
+	} {
+		fName := path.Join("test", item.name)
+		ioutil.WriteFile(fName, []byte("---\ntitle: Dated\ndate: "+item.date+"\n---\n\nHello\n"), 0666)
+		if err := meta.BlogIt(prefix, fName, item.date); err != nil {
+			t.Errorf("BlogIt(%q) failed, %s", fName, err)
+			t.FailNow()
+		}
+	}
+	for _, slug := range []string{"dated", "timed"} {
+		if _, err := meta.MovePost(prefix, slug, "2021-04-01"); err != nil {
+			t.Errorf("MovePost(%q) failed, %s", slug, err)
+		}
+	}
+	if issues := meta.Check(prefix); len(issues) != 0 {
+		t.Errorf("expected no issues after moving, got %+v", issues)
+	}
+	src, _ := ioutil.ReadFile(path.Join(prefix, "2021", "04", "01", "timed.md"))
+	if string(src) != "---\ntitle: Dated\ndate: \"2021-04-01T09:30:00-07:00\"\n---\n\nHello\n" {
+		t.Errorf("expected the front matter date to be updated, got %q", src)
+	}
+	meta = new(BlogMeta)
+	if err := meta.RefreshAll(prefix); err != nil {
+		t.Errorf("RefreshAll(%q) failed, %s", prefix, err)
+	}
+	for slug, created := range map[string]string{"dated": "2021-04-01", "timed": "2021-04-01T09:30:00-07:00"} {
+		if post, ymd, err := meta.FindPost(slug); err != nil || post.Created != created || strings.Join(ymd, "-") != "2021-04-01" {
+			t.Errorf("expected %s on %s after refreshing, got %+v, %+v, %v", slug, created, post, ymd, err)
+		}
+	}
+
+	// Pages at pretty permalinks move and are removed with their post
+	prefix = path.Join("test", "moves-pretty")
+	os.RemoveAll(prefix)
+	meta = new(BlogMeta)
+	meta.Permalink = "/:prefix/:year/:month/:slug/"
+	for _, name := range []string{"pretty", "gone"} {
+		fName := path.Join("test", name+".md")
+		ioutil.WriteFile(fName, []byte("---\ntitle: Pretty\n---\n\nHello\n"), 0666)
+		if err := meta.BlogIt(prefix, fName, "2021-03-15"); err != nil {
+			t.Errorf("BlogIt(%q) failed, %s", fName, err)
+			t.FailNow()
+		}
+		post, _, _ := meta.FindPost(name)
+		os.MkdirAll(path.Dir(meta.PostPageName(post)), 0777)
+		ioutil.WriteFile(meta.PostPageName(post), []byte("<p>Hello</p>"), 0666)
+	}
+	files, err = meta.RemovePost("gone")
+	if err != nil || len(files) != 2 {
+		t.Errorf("expected the post and its page removed, got %+v, %v", files, err)
+	}
+	if _, err := os.Stat(path.Join(prefix, "2021", "03", "gone")); err == nil {
+		t.Errorf("expected the page's directory to be removed")
+	}
+	moved, err = meta.MovePost(prefix, "pretty", "2021-04-01")
+	if err != nil {
+		t.Errorf("MovePost() failed, %s", err)
+		t.FailNow()
+	}
+	page := path.Join(prefix, "2021", "04", "pretty", "index.html")
+	if _, err := os.Stat(page); err != nil {
+		t.Errorf("expected the page to move to %q, %s", page, err)
+	}
+	if _, err := os.Stat(path.Join(prefix, "2021", "03", "pretty")); err == nil {
+		t.Errorf("expected the old page's directory to be removed")
+	}
+	redirects = meta.MoveRedirects(moved)
+	if len(redirects) != 1 || redirects[0][0] != "/"+prefix+"/2021/03/pretty/" || redirects[0][1] != "/"+prefix+"/2021/04/pretty/" {
+		t.Errorf("unexpected redirects %+v", redirects)
+	}
+
+	// A move that fails part way puts the files back
+	prefix = path.Join("test", "moves-failed")
+	os.RemoveAll(prefix)
+	meta = new(BlogMeta)
+	fName := path.Join("test", "stuck.md")
+	ioutil.WriteFile(fName, []byte("---\ntitle: Stuck\n---\n\nHello\n"), 0666)
+	if err := meta.BlogIt(prefix, fName, "2021-03-15"); err != nil {
+		t.Errorf("BlogIt(%q) failed, %s", fName, err)
+		t.FailNow()
+	}
+	dPath := path.Join(prefix, "2021", "03", "15")
+	ioutil.WriteFile(path.Join(dPath, "stuck.html"), []byte("<p>Hello</p>"), 0666)
+	ioutil.WriteFile(path.Join(dPath, "stuck.mp3"), []byte(""), 0666)
+	blocked := path.Join(prefix, "2021", "04", "01", "stuck.mp3")
+	os.MkdirAll(path.Join(blocked, "in-the-way"), 0777)
+	if _, err := meta.MovePost(prefix, "stuck", "2021-04-01"); err == nil {
+		t.Errorf("expected the move to fail")
+	}
+	for _, name := range []string{"stuck.md", "stuck.html", "stuck.mp3"} {
+		if _, err := os.Stat(path.Join(dPath, name)); err != nil {
+			t.Errorf("expected %s to be put back, %s", name, err)
+		}
+	}
+	if post, ymd, err := meta.FindPost("stuck"); err != nil || strings.Join(ymd, "-") != "2021-03-15" || post.Document != path.Join(dPath, "stuck.md") {
+		t.Errorf("expected the post to stay on 2021-03-15, got %+v, %+v, %v", post, ymd, err)
+	}
+}
@@ -0,0 +1,193 @@
+//
+// Package mkpage blognew.go starts new blog posts from a skeleton and adds
+// them to the blog once they are no longer drafts.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"text/template"
+	"time"
+)
+
+// DefaultPostSkeleton is the template for new posts when blog.json
+// doesn't set a post skeleton. It gets a PostSkeleton.
+const DefaultPostSkeleton = `---
+title: {{printf "%q" .Title}}
+date: {{.Date}}
+{{- if .Creators}}
+creators:
+{{- range .Creators}}
+{{- if .ID}}
+  - id: {{.ID}}
+{{- else}}
+  - name: {{printf "%q" .Name}}
+{{- end}}
+{{- end}}
+{{- end}}
+draft: true
+keywords: []
+---
+
+`
+
+// PostSkeleton is the data for a post skeleton template
+type PostSkeleton struct {
+	Title    string
+	Slug     string
+	Date     string
+	Creators []CreatorObj
+}
+
+// isSameFile returns true if both names are the same file
+func isSameFile(a string, b string) bool {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(aInfo, bInfo)
+}
+
+// NewPostName returns the name of a new post's Markdown document, the
+// slug of title in DraftsDir or in prefix's YYYY/MM/DD folder for
+// dateString.
+func (meta *BlogMeta) NewPostName(prefix string, title string, dateString string) (string, error) {
+	slug := Slugify(title)
+	if slug == "" {
+		return "", fmt.Errorf("Can't make a slug from %q", title)
+	}
+	if meta.DraftsDir != "" {
+		return path.Join(meta.DraftsDir, slug+".md"), nil
+	}
+	ymd, err := calcYMD(dateString)
+	if err != nil {
+		return "", err
+	}
+	dPath, err := calcPath(prefix, ymd)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dPath, slug+".md"), nil
+}
+
+// NewPost creates a draft Markdown document for title dated
+// dateString (today if empty) from PostSkeleton or
+// DefaultPostSkeleton. Its creator is DefaultAuthor. It isn't added to
+// the blog until its draft is cleared (see PublishDraft). It returns
+// the document's name.
+func (meta *BlogMeta) NewPost(prefix string, title string, dateString string) (string, error) {
+	if dateString == "" {
+		dateString = time.Now().Format(DateFmt)
+	}
+	fName, err := meta.NewPostName(prefix, title, dateString)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(fName); err == nil {
+		return "", fmt.Errorf("%q already exists", fName)
+	}
+	skeleton := DefaultPostSkeleton
+	if meta.PostSkeleton != "" {
+		src, err := ioutil.ReadFile(meta.PostSkeleton)
+		if err != nil {
+			return "", fmt.Errorf("Reading %q, %s", meta.PostSkeleton, err)
+		}
+		skeleton = string(src)
+	}
+	tmpl, err := template.New("post").Parse(skeleton)
+	if err != nil {
+		return "", fmt.Errorf("Post skeleton, %s", err)
+	}
+	data := &PostSkeleton{
+		Title:    title,
+		Slug:     Slugify(title),
+		Date:     dateString,
+		Creators: []CreatorObj{},
+	}
+	if meta.DefaultAuthor != "" {
+		person, err := meta.Person(meta.DefaultAuthor)
+		if err != nil {
+			return "", err
+		}
+		if person != nil {
+			data.Creators = append(data.Creators, CreatorObj{ID: person.ID, Name: person.Name})
+		} else {
+			data.Creators = append(data.Creators, CreatorObj{Name: meta.DefaultAuthor})
+		}
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("Post skeleton, %s", err)
+	}
+	os.MkdirAll(filepath.Dir(fName), 0777)
+	if err := ioutil.WriteFile(fName, buf.Bytes(), 0666); err != nil {
+		return "", fmt.Errorf("Writing %q, %s", fName, err)
+	}
+	return fName, nil
+}
+
+// PublishDraft adds a post started with NewPost to the blog once its
+// front matter's draft is cleared, a post in DraftsDir is moved to its
+// YYYY/MM/DD folder. It returns the post's document or an empty
+// string if it is still a draft.
+func (meta *BlogMeta) PublishDraft(prefix string, fName string) (string, error) {
+	obj, err := readFrontMatter(fName)
+	if err != nil {
+		return "", err
+	}
+	if asBool(obj["draft"]) {
+		return "", nil
+	}
+	dateString, _ := asString(obj["date"])
+	if dateString == "" {
+		return "", fmt.Errorf("%q is missing a date", fName)
+	}
+	ymd, err := calcYMD(dateString)
+	if err != nil {
+		return "", err
+	}
+	dPath, err := calcPath(prefix, ymd)
+	if err != nil {
+		return "", err
+	}
+	targetName := path.Join(dPath, path.Base(fName))
+	if isSameFile(fName, targetName) == false {
+		if _, err := os.Stat(targetName); err == nil {
+			return "", fmt.Errorf("%q already exists", targetName)
+		}
+	}
+	if err := meta.BlogIt(prefix, fName, dateString); err != nil {
+		return "", err
+	}
+	if isSameFile(fName, targetName) == false {
+		if err := os.Remove(fName); err != nil {
+			return "", err
+		}
+	}
+	return targetName, nil
+}
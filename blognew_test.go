@@ -0,0 +1,94 @@
+//
+// blognew_test.go test routines for blognew.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestNewPost(t *testing.T) {
+	prefix := path.Join("test", "new")
+	os.RemoveAll(prefix)
+	os.MkdirAll(prefix, 0777)
+	meta := new(BlogMeta)
+	meta.DefaultAuthor = "Jane Doe"
+	fName, err := meta.NewPost(prefix, "Hello: World!", "2021-07-01")
+	if err != nil || fName != path.Join(prefix, "2021", "07", "01", "hello-world.md") {
+		t.Errorf("NewPost() failed, %q, %v", fName, err)
+		t.FailNow()
+	}
+	if _, err := meta.NewPost(prefix, "Hello World", "2021-07-01"); err == nil {
+		t.Errorf("expected an error for an existing post")
+	}
+	obj, err := readFrontMatter(fName)
+	if err != nil {
+		t.Errorf("expected front matter in %q, %s", fName, err)
+		t.FailNow()
+	}
+	post := new(PostObj)
+	post.setFrontMatter(obj)
+	if post.Title != "Hello: World!" || post.Created != "2021-07-01" || post.Draft == false || len(post.Creators) != 1 || post.Creators[0].Name != "Jane Doe" {
+		t.Errorf("expected the skeleton's front matter, got %+v", post)
+	}
+	if keywords, ok := obj["keywords"].([]interface{}); ok == false || len(keywords) != 0 {
+		t.Errorf("expected empty keywords, got %+v", obj["keywords"])
+	}
+
+	// Drafts aren't added
+	if doc, err := meta.PublishDraft(prefix, fName); err != nil || doc != "" || len(meta.Years) != 0 {
+		t.Errorf("expected the draft to not be added, %q, %v", doc, err)
+	}
+	src, _ := ioutil.ReadFile(fName)
+	src = []byte(strings.Replace(string(src), "draft: true", "draft: false", 1))
+	ioutil.WriteFile(fName, src, 0666)
+	if doc, err := meta.PublishDraft(prefix, fName); err != nil || doc != fName {
+		t.Errorf("expected %q to be added, %q, %v", fName, doc, err)
+	}
+	if post, _, err := meta.FindPost("hello-world"); err != nil || post.Title != "Hello: World!" {
+		t.Errorf("expected the post in blog.json, %+v, %v", post, err)
+	}
+	if src2, _ := ioutil.ReadFile(fName); string(src2) != string(src) {
+		t.Errorf("expected %q to be left as is, got %q", fName, src2)
+	}
+
+	// Drafts folder and post skeleton
+	meta.DraftsDir = path.Join(prefix, "drafts")
+	meta.PostSkeleton = path.Join(prefix, "skeleton.md")
+	ioutil.WriteFile(meta.PostSkeleton, []byte("---\ntitle: {{printf \"%q\" .Title}}\ndate: {{.Date}}\nimage: /media/{{.Slug}}.png\ndraft: false\n---\n"), 0666)
+	fName, err = meta.NewPost(prefix, "Second Post", "2021-07-02")
+	if err != nil || fName != path.Join(prefix, "drafts", "second-post.md") {
+		t.Errorf("expected a post in the drafts folder, %q, %v", fName, err)
+		t.FailNow()
+	}
+	doc, err := meta.PublishDraft(prefix, fName)
+	if err != nil || doc != path.Join(prefix, "2021", "07", "02", "second-post.md") {
+		t.Errorf("expected the post to be moved, %q, %v", doc, err)
+	}
+	if _, err := os.Stat(fName); err == nil {
+		t.Errorf("expected %q to be removed", fName)
+	}
+	if post, _, err := meta.FindPost("second-post"); err != nil || post.Extra["image"] != "/media/second-post.png" {
+		t.Errorf("expected the skeleton's image, %+v, %v", post, err)
+	}
+}
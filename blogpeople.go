@@ -0,0 +1,165 @@
+//
+// Package mkpage blogpeople.go reads a blog's people file so post creators
+// can be given by id, e.g. "authors: [rsdoiel]".
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	// 3rd Party packages
+	"gopkg.in/yaml.v3"
+)
+
+// LoadPeople reads a people file, a JSON or YAML (.yaml, .yml) list of
+// people with their id, name, orcid, ror, affiliation, email and url.
+func LoadPeople(fName string) ([]*CreatorObj, error) {
+	src, err := ioutil.ReadFile(fName)
+	if err != nil {
+		return nil, fmt.Errorf("Reading %q, %s", fName, err)
+	}
+	people := []*CreatorObj{}
+	switch strings.ToLower(filepath.Ext(fName)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(src, &people)
+	default:
+		err = json.Unmarshal(src, &people)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshaling %q, %s", fName, err)
+	}
+	for i, person := range people {
+		if person.ID == "" {
+			return nil, fmt.Errorf("%q, person %d is missing an id", fName, i+1)
+		}
+	}
+	return people, nil
+}
+
+// SetPeople sets the people file of the blog meta document blogJSON.
+// It is kept relative to blogJSON's directory so the blog can be used
+// from any working directory.
+func (meta *BlogMeta) SetPeople(blogJSON string, fName string) {
+	meta.dName = filepath.Dir(blogJSON)
+	meta.People = filepath.ToSlash(fName)
+	if filepath.IsAbs(fName) == false {
+		if rel, err := filepath.Rel(meta.dName, fName); err == nil {
+			meta.People = filepath.ToSlash(rel)
+		}
+	}
+	meta.people = nil
+}
+
+// peopleName returns the path to the people file, it is relative to
+// the blog meta document.
+func (meta *BlogMeta) peopleName() string {
+	if filepath.IsAbs(meta.People) {
+		return meta.People
+	}
+	return filepath.Join(meta.dName, filepath.FromSlash(meta.People))
+}
+
+// Person returns the person with id from the people file, it is nil if
+// there isn't a people file or the id isn't in it.
+func (meta *BlogMeta) Person(id string) (*CreatorObj, error) {
+	if meta.People == "" {
+		return nil, nil
+	}
+	if meta.people == nil {
+		people, err := LoadPeople(meta.peopleName())
+		if err != nil {
+			return nil, err
+		}
+		meta.people = map[string]*CreatorObj{}
+		for _, person := range people {
+			meta.people[person.ID] = person
+		}
+	}
+	return meta.people[id], nil
+}
+
+// resolveCreators fills in a post's creators from the people file.
+// A creator given by id (or a name that is an id) takes the fields it
+// doesn't set from the person, an unknown id is an error.
+func (meta *BlogMeta) resolveCreators(post *PostObj) error {
+	for i, creator := range post.Creators {
+		id := creator.ID
+		if id == "" {
+			id = creator.Name
+		}
+		person, err := meta.Person(id)
+		if err != nil {
+			return err
+		}
+		if person == nil {
+			if creator.ID != "" {
+				return fmt.Errorf("Unknown person %q", creator.ID)
+			}
+			continue
+		}
+		if creator.ID == "" {
+			// The name was the person's id
+			creator.Name = ""
+		}
+		for _, field := range [][]*string{
+			{&creator.ID, &person.ID},
+			{&creator.Name, &person.Name},
+			{&creator.ORCID, &person.ORCID},
+			{&creator.ROR, &person.ROR},
+			{&creator.Affiliation, &person.Affiliation},
+			{&creator.Email, &person.Email},
+			{&creator.URL, &person.URL},
+		} {
+			if *field[0] == "" {
+				*field[0] = *field[1]
+			}
+		}
+		post.Creators[i] = creator
+	}
+	return nil
+}
+
+// ResolveCreators fills in the creators of all the posts from the
+// people file, e.g. after it is set or updated. Each post's creators
+// are read again from its front matter first so changes to the people
+// file replace the details filled in before.
+func (meta *BlogMeta) ResolveCreators() error {
+	meta.people = nil
+	for _, yr := range meta.Years {
+		for _, mn := range yr.Months {
+			for _, dy := range mn.Days {
+				for _, post := range dy.Posts {
+					if obj, err := readFrontMatter(post.Document); err == nil {
+						fm := new(PostObj)
+						fm.setFrontMatter(obj)
+						post.Creators = fm.Creators
+					}
+					if err := meta.resolveCreators(post); err != nil {
+						return fmt.Errorf("%s, %s", post.Document, err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
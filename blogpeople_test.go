@@ -0,0 +1,179 @@
+//
+// blogpeople_test.go test routines for blogpeople.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	// Caltech Library packages
+	"github.com/caltechlibrary/rss2"
+)
+
+func TestPeople(t *testing.T) {
+	prefix := path.Join("test", "people")
+	os.RemoveAll(prefix)
+	os.MkdirAll(prefix, 0777)
+	peopleYAML := path.Join(prefix, "people.yaml")
+	src := []byte(`- id: jdoe
+  name: Jane Doe
+  orcid: 0000-0000-0000-0001
+  ror: https://ror.org/05dxps055
+  affiliation: Caltech
+  email: jdoe@example.edu
+  url: https://example.edu/~jdoe
+- id: rroe
+  name: Richard Roe
+`)
+	if err := ioutil.WriteFile(peopleYAML, src, 0666); err != nil {
+		t.Errorf("Can't create %q, %s", peopleYAML, err)
+		t.FailNow()
+	}
+	people, err := LoadPeople(peopleYAML)
+	if err != nil || len(people) != 2 || people[0].ROR != "https://ror.org/05dxps055" {
+		t.Errorf("expected two people from %q, got %+v, %v", peopleYAML, people, err)
+	}
+	peopleJSON := path.Join(prefix, "people.json")
+	ioutil.WriteFile(peopleJSON, []byte(`[{"name": "No Id"}]`), 0666)
+	if _, err := LoadPeople(peopleJSON); err == nil {
+		t.Errorf("expected an error for a person without an id")
+	}
+
+	meta := new(BlogMeta)
+	meta.People = peopleYAML
+	for _, item := range []struct {
+		slug, frontMatter string
+	}{
+		{"by-id", "authors: [jdoe, rroe]\n"},
+		{"by-map", "creators:\n  - id: jdoe\n    name: Dr. Jane Doe\n  - name: Guest Writer\n"},
+	} {
+		fName := path.Join("test", item.slug+".md")
+		src := "---\ntitle: " + item.slug + "\n" + item.frontMatter + "---\n\nHello\n"
+		if err := ioutil.WriteFile(fName, []byte(src), 0666); err != nil {
+			t.Errorf("Can't create %q, %s", fName, err)
+			t.FailNow()
+		}
+		if err := meta.BlogIt(prefix, fName, "2021-03-15"); err != nil {
+			t.Errorf("BlogIt(%q, %q) failed, %s", prefix, fName, err)
+			t.FailNow()
+		}
+	}
+	post, _, _ := meta.FindPost("by-id")
+	if len(post.Creators) != 2 || post.Creators[0].Name != "Jane Doe" || post.Creators[0].ORCID != "0000-0000-0000-0001" || post.Creators[1].ID != "rroe" {
+		t.Errorf("expected creators from the people file, got %+v", post.Creators)
+	}
+	post, _, _ = meta.FindPost("by-map")
+	if len(post.Creators) != 2 || post.Creators[0].Name != "Dr. Jane Doe" || post.Creators[0].Email != "jdoe@example.edu" || post.Creators[1].Name != "Guest Writer" {
+		t.Errorf("expected front matter to take precedence, got %+v", post.Creators)
+	}
+
+	fName := path.Join("test", "unknown.md")
+	ioutil.WriteFile(fName, []byte("---\ntitle: unknown\ncreators: [{id: nobody}]\n---\n\nHello\n"), 0666)
+	if err := meta.BlogIt(prefix, fName, "2021-03-15"); err == nil {
+		t.Errorf("expected an error for an unknown person")
+	}
+	meta.RemovePost("unknown")
+
+	// Author pages
+	authors := meta.Taxonomy(prefix, TaxonomyAuthors)
+	names := []string{}
+	for _, term := range authors.Terms {
+		names = append(names, term.Slug)
+	}
+	if strings.Join(names, ",") != "dr-jane-doe,guest-writer,jane-doe,richard-roe" {
+		t.Errorf("expected an author page for each name, got %s", strings.Join(names, ","))
+	}
+	if person := authors.Terms[2].Person; person == nil || person.ORCID != "0000-0000-0000-0001" {
+		t.Errorf("expected the author's details, got %+v", person)
+	}
+	meta.AuthorTmpl = "author.tmpl"
+	pages, err := meta.taxonomyPages(prefix)
+	if err != nil || len(pages) != 4 || pages[0].Name != path.Join(prefix, "authors", "dr-jane-doe", "index.html") {
+		t.Errorf("expected 4 author pages, got %d, %v", len(pages), err)
+	}
+
+	// Feeds
+	feed := new(rss2.RSS2)
+	feed.Version = "2.0"
+	for _, name := range []string{"by-id", "by-map"} {
+		post, _, _ := meta.FindPost(name)
+		post.Description = name
+	}
+	if err := BlogMetaToRSS(meta, feed); err != nil {
+		t.Errorf("BlogMetaToRSS() failed, %s", err)
+		t.FailNow()
+	}
+	for _, item := range feed.ItemList {
+		if item.Author != "jdoe@example.edu (Jane Doe)" && item.Author != "jdoe@example.edu (Dr. Jane Doe)" {
+			t.Errorf("expected an author with an email, got %q", item.Author)
+		}
+	}
+	feed.ItemList[0].Description = "About the <item> element"
+	out, err := MarshalRSS(feed, meta.PostCreators())
+	if err != nil {
+		t.Errorf("MarshalRSS() failed, %s", err)
+		t.FailNow()
+	}
+	txt := string(out)
+	if strings.Count(txt, "<dc:creator>") != 4 || strings.Contains(txt, `xmlns:dc="http://purl.org/dc/elements/1.1/"`) == false {
+		t.Errorf("expected four dc:creator elements, got\n%s", txt)
+	}
+	if strings.Contains(txt, "<dc:creator>Richard Roe</dc:creator>") == false {
+		t.Errorf("expected Richard Roe as a dc:creator, got\n%s", txt)
+	}
+	if err := xml.Unmarshal([]byte(txt), new(rss2.RSS2)); err != nil {
+		t.Errorf("expected well formed XML, %s", err)
+	}
+
+	// The people file is relative to blog.json and changes to it reach
+	// the posts already resolved
+	blogJSON := path.Join(prefix, "blog.json")
+	meta.SetPeople(blogJSON, peopleYAML)
+	if meta.People != "people.yaml" {
+		t.Errorf("expected the people file relative to blog.json, got %q", meta.People)
+	}
+	if err := meta.Save(blogJSON); err != nil {
+		t.Errorf("Save(%q) failed, %s", blogJSON, err)
+		t.FailNow()
+	}
+	meta = new(BlogMeta)
+	if err := LoadBlogMeta(blogJSON, meta); err != nil {
+		t.Errorf("LoadBlogMeta(%q) failed, %s", blogJSON, err)
+		t.FailNow()
+	}
+	src = []byte(strings.Replace(string(src), "jdoe@example.edu", "jane.doe@example.org", 1))
+	ioutil.WriteFile(peopleYAML, src, 0666)
+	if err := meta.ResolveCreators(); err != nil {
+		t.Errorf("ResolveCreators() failed, %s", err)
+		t.FailNow()
+	}
+	post, _, _ = meta.FindPost("by-id")
+	if post.Creators[0].Email != "jane.doe@example.org" {
+		t.Errorf("expected the updated email, got %+v", post.Creators[0])
+	}
+	post, _, _ = meta.FindPost("by-map")
+	if post.Creators[0].Email != "jane.doe@example.org" || post.Creators[0].Name != "Dr. Jane Doe" {
+		t.Errorf("expected the updated email and the front matter name, got %+v", post.Creators[0])
+	}
+}
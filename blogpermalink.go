@@ -0,0 +1,103 @@
+//
+// Package mkpage blogpermalink.go computes the published URL of a blog post from
+// the permalink pattern in blog.json.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"path"
+	"strings"
+)
+
+// postYMD returns the year, month and day of a post from its date or,
+// failing that, the YYYY/MM/DD path of its document.
+func postYMD(post *PostObj) []string {
+	if post.Created != "" {
+		if ymd, err := calcYMD(post.Created); err == nil {
+			return ymd
+		}
+	}
+	parts := strings.Split(path.Dir(post.Document), "/")
+	if len(parts) >= 3 {
+		return parts[len(parts)-3:]
+	}
+	return []string{"", "", ""}
+}
+
+// PostPermalink returns the URL path of a post. Without a Permalink
+// pattern in blog.json it is the post's HTML next to its document,
+// e.g. /blog/2021/03/15/my-post.html. Patterns are site root relative
+// and can use :year, :month, :day, :slug and :prefix (the document's
+// path before YYYY/MM/DD), e.g.
+//
+//	/:prefix/:year/:month/:slug/
+//	/posts/:slug.html
+func (meta *BlogMeta) PostPermalink(post *PostObj) string {
+	if meta.Permalink == "" {
+		return "/" + PostHTMLName(post.Document)
+	}
+	ymd := postYMD(post)
+	prefix := path.Dir(post.Document)
+	for i := 0; i < 3; i++ {
+		prefix = path.Dir(prefix)
+	}
+	if prefix == "." {
+		prefix = ""
+	}
+	link := strings.NewReplacer(
+		":prefix", prefix,
+		":year", ymd[0],
+		":month", ymd[1],
+		":day", ymd[2],
+		":slug", post.Slug,
+	).Replace(meta.Permalink)
+	// Clean up doubled slashes (e.g. from an empty :prefix) keeping
+	// the trailing slash of pretty URLs.
+	cleaned := path.Clean("/" + link)
+	if strings.HasSuffix(link, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+// PostURL returns the post's permalink joined to the blog's URL
+func (meta *BlogMeta) PostURL(post *PostObj) string {
+	return strings.TrimSuffix(meta.BaseURL, "/") + meta.PostPermalink(post)
+}
+
+// PostPageName returns the file a post is rendered to, relative to the
+// site root, e.g. a permalink of /blog/2021/03/my-post/ is rendered to
+// blog/2021/03/my-post/index.html.
+func (meta *BlogMeta) PostPageName(post *PostObj) string {
+	link := meta.PostPermalink(post)
+	if strings.HasSuffix(link, "/") {
+		link += "index.html"
+	}
+	return strings.TrimPrefix(link, "/")
+}
+
+// postHref returns the link to a post relative to dName, pretty URLs
+// link to the post's directory.
+func (meta *BlogMeta) postHref(dName string, post *PostObj) string {
+	name := meta.PostPageName(post)
+	if strings.HasSuffix(meta.PostPermalink(post), "/") {
+		return relHref(dName, path.Dir(name)) + "/"
+	}
+	return relHref(dName, name)
+}
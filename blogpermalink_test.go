@@ -0,0 +1,93 @@
+//
+// blogpermalink_test.go test routines for blogpermalink.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"strings"
+	"testing"
+
+	// Caltech Library packages
+	"github.com/caltechlibrary/rss2"
+)
+
+func TestPermalink(t *testing.T) {
+	meta := new(BlogMeta)
+	meta.BaseURL = "https://news.example.edu/"
+	meta.PostTmpl = "post.tmpl"
+	meta.IndexTmpl = "index.tmpl"
+	post := &PostObj{
+		Slug:        "exhibit",
+		Title:       "Exhibit",
+		Description: "An exhibit",
+		Document:    "blog/2021/03/15/exhibit.md",
+		Created:     "2021-03-15T14:30:00-07:00",
+	}
+	meta.Years = []*YearObj{
+		&YearObj{Year: "2021", Months: []*MonthObj{&MonthObj{Month: "03", Days: []*DayObj{
+			&DayObj{Day: "15", Posts: []*PostObj{post}},
+		}}}},
+	}
+	for _, test := range []struct {
+		pattern, link, page, href string
+	}{
+		{"", "/blog/2021/03/15/exhibit.html", "blog/2021/03/15/exhibit.html", "2021/03/15/exhibit.html"},
+		{"/:prefix/:year/:month/:slug/", "/blog/2021/03/exhibit/", "blog/2021/03/exhibit/index.html", "2021/03/exhibit/"},
+		{"/posts/:slug.html", "/posts/exhibit.html", "posts/exhibit.html", "../posts/exhibit.html"},
+		{"/:year/:month/:day/:slug/index.html", "/2021/03/15/exhibit/index.html", "2021/03/15/exhibit/index.html", "../2021/03/15/exhibit/index.html"},
+	} {
+		meta.Permalink = test.pattern
+		if s := meta.PostPermalink(post); s != test.link {
+			t.Errorf("%q expected permalink %q, got %q", test.pattern, test.link, s)
+		}
+		if s := meta.PostPageName(post); s != test.page {
+			t.Errorf("%q expected page %q, got %q", test.pattern, test.page, s)
+		}
+		if s := meta.PostURL(post); s != "https://news.example.edu"+test.link {
+			t.Errorf("%q expected URL for %q, got %q", test.pattern, test.link, s)
+		}
+		pages, err := meta.Pages("blog")
+		if err != nil {
+			t.Errorf("Pages() failed, %s", err)
+			t.FailNow()
+		}
+		if len(pages) != 2 || pages[0].Name != test.page {
+			t.Errorf("%q expected post page %q, got %+v", test.pattern, test.page, pages[0])
+		}
+		if strings.Contains(pages[1].KeyValues["posts"], `"href":"`+test.href+`"`) == false {
+			t.Errorf("%q expected index href %q, got %s", test.pattern, test.href, pages[1].KeyValues["posts"])
+		}
+		feed := new(rss2.RSS2)
+		if err := BlogMetaToRSS(meta, feed); err != nil {
+			t.Errorf("BlogMetaToRSS() failed, %s", err)
+			t.FailNow()
+		}
+		if len(feed.ItemList) != 1 || feed.ItemList[0].Link != "https://news.example.edu"+test.link {
+			t.Errorf("%q expected feed link for %q, got %+v", test.pattern, test.link, feed.ItemList)
+		}
+	}
+
+	// A moved post redirects from its old permalink to its new one
+	meta.Permalink = "/:prefix/:year/:month/:slug/"
+	redirects := meta.MoveRedirects([][]string{
+		{"blog/2021/03/15/exhibit.md", "blog/2021/04/01/exhibit.md"},
+	})
+	if len(redirects) != 1 || redirects[0][0] != "/blog/2021/03/exhibit/" || redirects[0][1] != "/blog/2021/04/exhibit/" {
+		t.Errorf("unexpected redirects %+v", redirects)
+	}
+}
@@ -0,0 +1,480 @@
+//
+// Package mkpage blogrender.go renders blog posts and the blog index using
+// the post and index templates in blog.json via Pandoc.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultPagePattern is the path of a listing's pages after the
+	// first, relative to the listing, :page is the page number.
+	DefaultPagePattern = "page/:page/"
+)
+
+// BlogPage is a page rendered by blogit. KeyValues are passed to
+// MakePandoc so they follow the same conventions as mkpage (e.g.
+// "json:" and "text:" prefixes, other values are file names).
+type BlogPage struct {
+	// Name is the file to write, e.g. blog/2021/03/15/post.html
+	Name string
+	// Template is the Pandoc template to render with
+	Template string
+	// KeyValues are the template data
+	KeyValues map[string]string
+}
+
+// BlogData is a JSON document written by blogit along side the
+// rendered pages, e.g. an archive's index.json
+type BlogData struct {
+	// Name is the file to write
+	Name string
+	// Data is encoded as JSON
+	Data interface{}
+}
+
+// PostHTMLName returns the name of the HTML file rendered for a post,
+// e.g. blog/2021/03/15/post.md becomes blog/2021/03/15/post.html
+func PostHTMLName(doc string) string {
+	return strings.TrimSuffix(doc, filepath.Ext(doc)) + ".html"
+}
+
+// relHref returns the path of fName relative to the directory dName
+// using forward slashes for use in a link
+func relHref(dName string, fName string) string {
+	if rel, err := filepath.Rel(dName, fName); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return fName
+}
+
+// jsonValue encodes a value for the MakePandoc key/value map
+func jsonValue(obj interface{}) (string, error) {
+	src, err := json.Marshal(obj)
+	if err != nil {
+		return "", err
+	}
+	return JSONPrefix + string(src), nil
+}
+
+// blogInfo returns the blog level metadata without the post tree
+func (meta *BlogMeta) blogInfo() map[string]interface{} {
+	info := map[string]interface{}{}
+	for key, val := range map[string]string{
+		"name":        meta.Name,
+		"quip":        meta.Quip,
+		"description": meta.Description,
+		"url":         meta.BaseURL,
+		"copyright":   meta.Copyright,
+		"license":     meta.License,
+		"language":    meta.Language,
+		"started":     meta.Started,
+		"ended":       meta.Ended,
+		"updated":     meta.Updated,
+	} {
+		if val != "" {
+			info[key] = val
+		}
+	}
+	return info
+}
+
+// postData returns the template data for a post, it includes an
+// href to the post's page relative to dName and its permalink.
+func (meta *BlogMeta) postData(dName string, post *PostObj) map[string]interface{} {
+	data := map[string]interface{}{}
+	if src, err := json.Marshal(post); err == nil {
+		json.Unmarshal(src, &data)
+	}
+	data["href"] = meta.postHref(dName, post)
+	data["permalink"] = meta.PostPermalink(post)
+	return data
+}
+
+// datedPost is a post with the date from its path
+type datedPost struct {
+	post       *PostObj
+	yr, mn, dy string
+}
+
+// datedPosts returns the published posts that can be rendered in
+// blog.json order (newest first).
+func (meta *BlogMeta) datedPosts() []*datedPost {
+	posts := []*datedPost{}
+	for _, yr := range meta.Years {
+		for _, mn := range yr.Months {
+			for _, dy := range mn.Days {
+				for _, post := range dy.Posts {
+					if isPostDocument(post.Document) && meta.IsPublished(post) {
+						posts = append(posts, &datedPost{post, yr.Year, mn.Month, dy.Day})
+					}
+				}
+			}
+		}
+	}
+	return posts
+}
+
+// listPost returns the template data for a post in a listing, the
+// date defaults to the post's path.
+func (meta *BlogMeta) listPost(dName string, dp *datedPost) map[string]interface{} {
+	data := meta.postData(dName, dp.post)
+	if _, ok := data["date"]; ok == false {
+		data["date"] = fmt.Sprintf("%s-%s-%s", dp.yr, dp.mn, dp.dy)
+	}
+	return data
+}
+
+// postsData returns the template data for a listing of posts with
+// hrefs relative to dName.
+func (meta *BlogMeta) postsData(dName string, posts []*datedPost) []map[string]interface{} {
+	data := []map[string]interface{}{}
+	for _, dp := range posts {
+		data = append(data, meta.listPost(dName, dp))
+	}
+	return data
+}
+
+// yearsData returns the Years/Months/Days tree as template data with
+// post hrefs relative to dName. If include is not nil only those posts
+// (and the years, months and days holding them) are included.
+func (meta *BlogMeta) yearsData(dName string, include map[*PostObj]bool) []map[string]interface{} {
+	years := []map[string]interface{}{}
+	for _, yr := range meta.Years {
+		months := []map[string]interface{}{}
+		for _, mn := range yr.Months {
+			days := []map[string]interface{}{}
+			for _, dy := range mn.Days {
+				posts := []map[string]interface{}{}
+				for _, post := range dy.Posts {
+					if include == nil || include[post] {
+						posts = append(posts, meta.postData(dName, post))
+					}
+				}
+				if include == nil || len(posts) > 0 {
+					days = append(days, map[string]interface{}{"day": dy.Day, "posts": posts})
+				}
+			}
+			if include == nil || len(days) > 0 {
+				months = append(months, map[string]interface{}{"month": mn.Month, "days": days})
+			}
+		}
+		if include == nil || len(months) > 0 {
+			years = append(years, map[string]interface{}{"year": yr.Year, "months": months})
+		}
+	}
+	return years
+}
+
+// Pagination describes a page of a paginated listing. Hrefs are
+// relative to the page so they can be used for rel="prev" and
+// rel="next" links.
+type Pagination struct {
+	Page     int    `json:"page"`
+	Pages    int    `json:"pages"`
+	Total    int    `json:"total"`
+	PageSize int    `json:"page_size,omitempty"`
+	First    string `json:"first"`
+	Last     string `json:"last"`
+	Prev     string `json:"prev,omitempty"`
+	Next     string `json:"next,omitempty"`
+}
+
+// listPage is a page of a paginated listing
+type listPage struct {
+	dir        string
+	posts      []*datedPost
+	pagination *Pagination
+}
+
+// PageDir returns the directory of page n of a listing in dName using
+// PagePattern, e.g. blog/page/2. The first page is dName.
+func (meta *BlogMeta) PageDir(dName string, n int) string {
+	if n <= 1 {
+		return dName
+	}
+	pattern := meta.PagePattern
+	if pattern == "" {
+		pattern = DefaultPagePattern
+	}
+	return path.Join(dName, strings.ReplaceAll(pattern, ":page", strconv.Itoa(n)))
+}
+
+// rebaseHref returns href, relative to the directory from, relative
+// to the directory to.
+func rebaseHref(from string, to string, href string) string {
+	s := relHref(to, path.Join(from, href))
+	if strings.HasSuffix(href, "/") {
+		s += "/"
+	}
+	return s
+}
+
+// paginate splits posts into pages of PageSize, a single page is
+// returned if PageSize is not set.
+func (meta *BlogMeta) paginate(dName string, posts []*datedPost) []*listPage {
+	size := meta.PageSize
+	if size <= 0 || size > len(posts) {
+		size = len(posts)
+	}
+	total := 1
+	if size > 0 {
+		total = (len(posts) + size - 1) / size
+	}
+	first, last := meta.PageDir(dName, 1), meta.PageDir(dName, total)
+	pages := []*listPage{}
+	for i := 0; i < total; i++ {
+		n := i + 1
+		end := (i + 1) * size
+		if end > len(posts) {
+			end = len(posts)
+		}
+		lp := &listPage{
+			dir:   meta.PageDir(dName, n),
+			posts: posts[i*size : end],
+		}
+		lp.pagination = &Pagination{
+			Page:     n,
+			Pages:    total,
+			Total:    len(posts),
+			PageSize: meta.PageSize,
+			First:    relHref(lp.dir, first) + "/",
+			Last:     relHref(lp.dir, last) + "/",
+		}
+		if n > 1 {
+			lp.pagination.Prev = relHref(lp.dir, meta.PageDir(dName, n-1)) + "/"
+		}
+		if n < total {
+			lp.pagination.Next = relHref(lp.dir, meta.PageDir(dName, n+1)) + "/"
+		}
+		pages = append(pages, lp)
+	}
+	return pages
+}
+
+// PostPage returns the BlogPage for rendering a post with PostTmpl.
+// The post's document is the content, its front matter is merged in
+// by MakePandoc and the PostObj is available as "post" with the blog
+// metadata as "blog". Posts in a series also get "series_prev" and
+// "series_next".
+func (meta *BlogMeta) PostPage(post *PostObj) (*BlogPage, error) {
+	return meta.postPage(post, meta.seriesPosts())
+}
+
+func (meta *BlogMeta) postPage(post *PostObj, series map[string][]*datedPost) (*BlogPage, error) {
+	name := meta.PostPageName(post)
+	page := &BlogPage{
+		Name:      name,
+		Template:  meta.PostTmpl,
+		KeyValues: map[string]string{"content": post.Document},
+	}
+	values := map[string]interface{}{
+		"post": meta.postData(path.Dir(name), post),
+		"blog": meta.blogInfo(),
+	}
+	prev, next := meta.seriesLinks(series, post)
+	if prev != nil {
+		values["series_prev"] = prev
+	}
+	if next != nil {
+		values["series_next"] = next
+	}
+	for key, val := range values {
+		src, err := jsonValue(val)
+		if err != nil {
+			return nil, err
+		}
+		page.KeyValues[key] = src
+	}
+	return page, nil
+}
+
+// IndexPages returns the BlogPages for rendering prefix/index.html
+// with IndexTmpl, paginated when PageSize is set. The page's posts are
+// available as "posts" and as a Years/Months/Days tree as "years", the
+// page as "pagination" and the blog metadata as "blog".
+func (meta *BlogMeta) IndexPages(prefix string) ([]*BlogPage, error) {
+	pages := []*BlogPage{}
+	for _, lp := range meta.paginate(prefix, meta.datedPosts()) {
+		page := &BlogPage{
+			Name:      path.Join(lp.dir, "index.html"),
+			Template:  meta.IndexTmpl,
+			KeyValues: map[string]string{},
+		}
+		if meta.Name != "" {
+			page.KeyValues["title"] = TextPrefix + meta.Name
+		}
+		var include map[*PostObj]bool
+		if meta.PageSize > 0 {
+			include = map[*PostObj]bool{}
+			for _, dp := range lp.posts {
+				include[dp.post] = true
+			}
+		}
+		for key, val := range map[string]interface{}{
+			"posts":      meta.postsData(lp.dir, lp.posts),
+			"years":      meta.yearsData(lp.dir, include),
+			"pagination": lp.pagination,
+			"blog":       meta.blogInfo(),
+		} {
+			src, err := jsonValue(val)
+			if err != nil {
+				return nil, err
+			}
+			page.KeyValues[key] = src
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// isPostDocument returns true if the post's document is a markup
+// document we can render (e.g. not an asset)
+func isPostDocument(doc string) bool {
+	return hasExt(strings.ToLower(filepath.Ext(doc)), []string{".md", ".markdown", ".rst", ".textile", ".jira", ".txt", ".fountain", ".spmd"})
+}
+
+// Pages returns the pages to render for the blog under prefix, a page
+// for each post, the blog index, the year, month and day archives and
+// the keyword, category and series pages.
+// Pages without a template set in blog.json are skipped.
+func (meta *BlogMeta) Pages(prefix string) ([]*BlogPage, error) {
+	pages := []*BlogPage{}
+	if meta.PostTmpl != "" {
+		posts, err := meta.postPages()
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, posts...)
+	}
+	if meta.IndexTmpl != "" {
+		indexPages, err := meta.IndexPages(prefix)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, indexPages...)
+	}
+	archives, err := meta.archivePages(prefix)
+	if err != nil {
+		return nil, err
+	}
+	pages = append(pages, archives...)
+	taxonomies, err := meta.taxonomyPages(prefix)
+	if err != nil {
+		return nil, err
+	}
+	return append(pages, taxonomies...), nil
+}
+
+// DataFiles returns the JSON documents to write for the blog under
+// prefix, the archive index.json files when ArchiveJSON is set and
+// the taxonomy index.json files when TaxonomyJSON is set.
+func (meta *BlogMeta) DataFiles(prefix string) []*BlogData {
+	data := []*BlogData{}
+	if meta.ArchiveJSON {
+		data = append(data, meta.archiveData(prefix)...)
+	}
+	if meta.TaxonomyJSON {
+		data = append(data, meta.taxonomyData(prefix)...)
+	}
+	return data
+}
+
+// postPages returns a page for each published post
+func (meta *BlogMeta) postPages() ([]*BlogPage, error) {
+	pages := []*BlogPage{}
+	series := meta.seriesPosts()
+	for _, dp := range meta.datedPosts() {
+		page, err := meta.postPage(dp.post, series)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// RenderPage renders a BlogPage with MakePandoc
+func RenderPage(page *BlogPage) error {
+	buf := new(bytes.Buffer)
+	if err := MakePandoc(buf, page.Template, page.KeyValues); err != nil {
+		return fmt.Errorf("Rendering %q, %s", page.Name, err)
+	}
+	if dName := path.Dir(page.Name); dName != "" {
+		os.MkdirAll(dName, 0777)
+	}
+	if err := ioutil.WriteFile(page.Name, buf.Bytes(), 0666); err != nil {
+		return fmt.Errorf("Writing %q, %s", page.Name, err)
+	}
+	return nil
+}
+
+// WriteBlogData writes a BlogData as JSON
+func WriteBlogData(data *BlogData) error {
+	src, err := json.MarshalIndent(data.Data, "", "    ")
+	if err != nil {
+		return fmt.Errorf("Marshaling %q, %s", data.Name, err)
+	}
+	if dName := path.Dir(data.Name); dName != "" {
+		os.MkdirAll(dName, 0777)
+	}
+	if err := ioutil.WriteFile(data.Name, src, 0666); err != nil {
+		return fmt.Errorf("Writing %q, %s", data.Name, err)
+	}
+	return nil
+}
+
+// Render writes the HTML for each post (next to its document) using
+// PostTmpl, prefix/index.html using IndexTmpl, the archive pages using
+// YearTmpl, MonthTmpl and DayTmpl, the taxonomy pages using
+// TaxonomyTmpl, KeywordTmpl, CategoryTmpl, SeriesTmpl and AuthorTmpl
+// and any JSON data files.
+func (meta *BlogMeta) Render(prefix string, verbose bool) error {
+	for _, data := range meta.DataFiles(prefix) {
+		if verbose {
+			fmt.Printf("Writing %s\n", data.Name)
+		}
+		if err := WriteBlogData(data); err != nil {
+			return err
+		}
+	}
+	pages, err := meta.Pages(prefix)
+	if err != nil {
+		return err
+	}
+	for i, page := range pages {
+		if verbose {
+			fmt.Printf("Rendering (%d/%d) %s\n", i+1, len(pages), page.Name)
+		}
+		if err := RenderPage(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+//
+// blogrender_test.go test routines for blogrender.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestBlogPages(t *testing.T) {
+	if s := PostHTMLName("blog/2021/05/01/hello.md"); s != "blog/2021/05/01/hello.html" {
+		t.Errorf("expected blog/2021/05/01/hello.html, got %q", s)
+	}
+	meta := new(BlogMeta)
+	meta.Name = "Test Blog"
+	post := &PostObj{
+		Slug:     "hello",
+		Document: path.Join("blog", "2021", "05", "01", "hello.md"),
+		Title:    "Hello",
+		Created:  "2021-05-01",
+	}
+	asset := &PostObj{
+		Slug:     "hello",
+		Document: path.Join("blog", "2021", "05", "01", "hello.wav"),
+	}
+	meta.Years = []*YearObj{
+		&YearObj{Year: "2021", Months: []*MonthObj{
+			&MonthObj{Month: "05", Days: []*DayObj{
+				&DayObj{Day: "01", Posts: []*PostObj{post, asset}},
+			}},
+		}},
+	}
+
+	// No templates, nothing to render
+	pages, err := meta.Pages("blog")
+	if err != nil {
+		t.Errorf("Pages() failed, %s", err)
+		t.FailNow()
+	}
+	if len(pages) != 0 {
+		t.Errorf("expected no pages without templates, got %d", len(pages))
+	}
+
+	meta.PostTmpl = "post.tmpl"
+	meta.IndexTmpl = "index.tmpl"
+	pages, err = meta.Pages("blog")
+	if err != nil {
+		t.Errorf("Pages() failed, %s", err)
+		t.FailNow()
+	}
+	if len(pages) != 2 {
+		t.Errorf("expected a post and index page, got %d", len(pages))
+		t.FailNow()
+	}
+	page := pages[0]
+	if page.Name != "blog/2021/05/01/hello.html" || page.Template != "post.tmpl" {
+		t.Errorf("unexpected post page %+v", page)
+	}
+	if page.KeyValues["content"] != post.Document {
+		t.Errorf("expected content %q, got %q", post.Document, page.KeyValues["content"])
+	}
+	data := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(page.KeyValues["post"], JSONPrefix)), &data); err != nil {
+		t.Errorf("Unmarshing post data, %s", err)
+		t.FailNow()
+	}
+	if data["title"] != "Hello" || data["href"] != "hello.html" {
+		t.Errorf("unexpected post data %+v", data)
+	}
+
+	page = pages[1]
+	if page.Name != "blog/index.html" || page.Template != "index.tmpl" {
+		t.Errorf("unexpected index page %+v", page)
+	}
+	if page.KeyValues["title"] != TextPrefix+"Test Blog" {
+		t.Errorf("unexpected title %q", page.KeyValues["title"])
+	}
+	years := []map[string]interface{}{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(page.KeyValues["years"], JSONPrefix)), &years); err != nil {
+		t.Errorf("Unmarshing years data, %s", err)
+		t.FailNow()
+	}
+	if src, _ := json.Marshal(years); strings.Contains(string(src), `"href":"2021/05/01/hello.html"`) == false {
+		t.Errorf("expected post href relative to index, got %s", src)
+	}
+}
+
+func TestPagination(t *testing.T) {
+	meta := new(BlogMeta)
+	meta.IndexTmpl = "index.tmpl"
+	meta.YearTmpl = "year.tmpl"
+	meta.PageSize = 2
+	days := []*DayObj{}
+	for i := 5; i > 0; i-- {
+		dy := fmt.Sprintf("%02d", i)
+		days = append(days, &DayObj{Day: dy, Posts: []*PostObj{
+			&PostObj{Slug: "p" + dy, Document: path.Join("blog", "2021", "05", dy, "p"+dy+".md")},
+		}})
+	}
+	meta.Years = []*YearObj{
+		&YearObj{Year: "2021", Months: []*MonthObj{&MonthObj{Month: "05", Days: days}}},
+	}
+	if s := meta.PageDir("blog", 2); s != "blog/page/2" {
+		t.Errorf("expected blog/page/2, got %q", s)
+	}
+	pages, err := meta.Pages("blog")
+	if err != nil {
+		t.Errorf("Pages() failed, %s", err)
+		t.FailNow()
+	}
+	names := []string{}
+	for _, page := range pages {
+		names = append(names, page.Name)
+	}
+	expected := "blog/index.html,blog/page/2/index.html,blog/page/3/index.html,blog/2021/index.html,blog/2021/page/2/index.html,blog/2021/page/3/index.html"
+	if strings.Join(names, ",") != expected {
+		t.Errorf("expected %s, got %s", expected, strings.Join(names, ","))
+	}
+	pagination := new(Pagination)
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(pages[1].KeyValues["pagination"], JSONPrefix)), pagination); err != nil {
+		t.Errorf("Unmarshing pagination, %s", err)
+		t.FailNow()
+	}
+	if pagination.Page != 2 || pagination.Pages != 3 || pagination.Total != 5 ||
+		pagination.Prev != "../../" || pagination.Next != "../3/" ||
+		pagination.First != "../../" || pagination.Last != "../3/" {
+		t.Errorf("unexpected pagination %+v", pagination)
+	}
+	posts := []map[string]interface{}{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(pages[1].KeyValues["posts"], JSONPrefix)), &posts); err != nil {
+		t.Errorf("Unmarshing posts, %s", err)
+		t.FailNow()
+	}
+	if len(posts) != 2 || posts[0]["href"] != "../../2021/05/03/p03.html" {
+		t.Errorf("unexpected posts %+v", posts)
+	}
+	if strings.Contains(pages[1].KeyValues["years"], "p05") {
+		t.Errorf("expected years to only hold the page's posts, %s", pages[1].KeyValues["years"])
+	}
+
+	meta.PagePattern = ":page.d/"
+	if s := meta.PageDir("blog", 3); s != "blog/3.d" {
+		t.Errorf("expected blog/3.d, got %q", s)
+	}
+	meta.PageSize = 0
+	if pages, _ = meta.Pages("blog"); len(pages) != 2 {
+		t.Errorf("expected a single index and year page, got %d", len(pages))
+	}
+}
@@ -0,0 +1,224 @@
+//
+// Package mkpage blogsave.go keeps blog.json safe when it is saved, e.g.
+// atomic writes, a lock file and rolling backups.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var (
+	// BlogLockTimeout is how long LockBlogMeta waits for another
+	// process to release the lock.
+	BlogLockTimeout = 30 * time.Second
+
+	// staleLocks counts the stale locks renamed aside, it keeps their
+	// names unique
+	staleLocks int64
+)
+
+// writeFileAtomic writes src to a temp file next to fName and renames
+// it to fName.
+func writeFileAtomic(fName string, src []byte, perm os.FileMode) error {
+	fp, err := ioutil.TempFile(filepath.Dir(fName), "."+filepath.Base(fName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := fp.Name()
+	if _, err := fp.Write(src); err != nil {
+		fp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := fp.Sync(); err != nil {
+		fp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := fp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, fName); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// backupName returns the name of the nth backup of fName, e.g.
+// blog.json.1
+func backupName(fName string, n int) string {
+	return fmt.Sprintf("%s.%d", fName, n)
+}
+
+// rotateBackups copies fName to fName.1 after moving the older backups
+// up by one, keeping at most n.
+func rotateBackups(fName string, n int) error {
+	src, err := ioutil.ReadFile(fName)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Reading %q, %s", fName, err)
+	}
+	os.Remove(backupName(fName, n))
+	for i := n - 1; i > 0; i-- {
+		if _, err := os.Stat(backupName(fName, i)); err == nil {
+			if err := os.Rename(backupName(fName, i), backupName(fName, i+1)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := writeFileAtomic(backupName(fName, 1), src, 0666); err != nil {
+		return fmt.Errorf("Writing %q, %s", backupName(fName, 1), err)
+	}
+	return nil
+}
+
+// UndoBlogMeta restores the previous version of a blog meta document
+// from its backup (fName.1) and moves the older backups down by one.
+// The current version is replaced.
+func UndoBlogMeta(fName string) error {
+	if _, err := os.Stat(backupName(fName, 1)); err != nil {
+		return fmt.Errorf("No backup of %q to restore", fName)
+	}
+	if err := os.Rename(backupName(fName, 1), fName); err != nil {
+		return err
+	}
+	for i := 2; ; i++ {
+		if _, err := os.Stat(backupName(fName, i)); err != nil {
+			break
+		}
+		if err := os.Rename(backupName(fName, i), backupName(fName, i-1)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BlogLock is an advisory lock on a blog meta document, it is a lock
+// file (e.g. blog.json.lock) holding the process id of its owner that
+// exists while the lock is held.
+type BlogLock struct {
+	Name string
+}
+
+// processRunning returns true if a process with pid is running on
+// this machine
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		// NOTE: FindProcess fails on Windows if pid isn't running
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
+
+// staleLock returns true if lockName was left behind by a process that
+// is no longer running, e.g. one killed while holding the lock. A lock
+// file without a process id is stale once it is older than a second.
+func staleLock(lockName string) bool {
+	src, err := ioutil.ReadFile(lockName)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(src)))
+	if err != nil || pid <= 0 {
+		info, err := os.Stat(lockName)
+		return err == nil && time.Since(info.ModTime()) > time.Second
+	}
+	return processRunning(pid) == false
+}
+
+// takeOverLock removes lockName if it is stale. The lock is renamed
+// aside and checked again before it is removed, if another process
+// took it over in the meantime it is put back.
+func takeOverLock(lockName string) bool {
+	src, err := ioutil.ReadFile(lockName)
+	if err != nil || staleLock(lockName) == false {
+		return false
+	}
+	staleName := fmt.Sprintf("%s.%d.%d", lockName, os.Getpid(), atomic.AddInt64(&staleLocks, 1))
+	if err := os.Rename(lockName, staleName); err != nil {
+		return false
+	}
+	defer os.Remove(staleName)
+	if renamed, err := ioutil.ReadFile(staleName); err == nil && bytes.Equal(src, renamed) && staleLock(staleName) {
+		return true
+	}
+	// NOTE: Link fails rather than replace a lock taken meanwhile
+	os.Link(staleName, lockName)
+	return false
+}
+
+// LockBlogMeta takes the lock for fName, e.g. for the load, update
+// and save of blog.json. It waits up to BlogLockTimeout for another
+// process to release it, a lock left by a process that is no longer
+// running is taken over.
+func LockBlogMeta(fName string) (*BlogLock, error) {
+	lockName := fName + ".lock"
+	timeout := time.Now().Add(BlogLockTimeout)
+	for {
+		fp, err := os.OpenFile(lockName, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+		if err == nil {
+			fmt.Fprintf(fp, "%d\n", os.Getpid())
+			fp.Close()
+			return &BlogLock{Name: lockName}, nil
+		}
+		if os.IsExist(err) == false {
+			return nil, fmt.Errorf("Locking %q, %s", fName, err)
+		}
+		if takeOverLock(lockName) {
+			continue
+		}
+		if time.Now().After(timeout) {
+			return nil, fmt.Errorf("Timed out waiting for %q, remove it if no other blogit is running", lockName)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Unlock releases the lock
+func (lock *BlogLock) Unlock() error {
+	if lock == nil {
+		return nil
+	}
+	return os.Remove(lock.Name)
+}
@@ -0,0 +1,174 @@
+//
+// blogsave_test.go test routines for blogsave.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSaveBackups(t *testing.T) {
+	prefix := path.Join("test", "save")
+	os.RemoveAll(prefix)
+	os.MkdirAll(prefix, 0777)
+	fName := path.Join(prefix, "blog.json")
+	meta := new(BlogMeta)
+	meta.Backups = 2
+	for _, name := range []string{"one", "two", "three", "four"} {
+		meta.Name = name
+		if err := meta.Save(fName); err != nil {
+			t.Errorf("Save(%q) failed, %s", fName, err)
+			t.FailNow()
+		}
+	}
+	for fName, name := range map[string]string{fName: "four", fName + ".1": "three", fName + ".2": "two"} {
+		saved := new(BlogMeta)
+		if err := LoadBlogMeta(fName, saved); err != nil || saved.Name != name {
+			t.Errorf("expected %q in %q, got %q, %v", name, fName, saved.Name, err)
+		}
+	}
+	if _, err := os.Stat(fName + ".3"); err == nil {
+		t.Errorf("expected only two backups")
+	}
+	files, _ := ioutil.ReadDir(prefix)
+	if len(files) != 3 {
+		t.Errorf("expected no temp files left, got %d files", len(files))
+	}
+
+	for _, name := range []string{"three", "two"} {
+		if err := UndoBlogMeta(fName); err != nil {
+			t.Errorf("UndoBlogMeta(%q) failed, %s", fName, err)
+			t.FailNow()
+		}
+		saved := new(BlogMeta)
+		if err := LoadBlogMeta(fName, saved); err != nil || saved.Name != name {
+			t.Errorf("expected %q after undo, got %q, %v", name, saved.Name, err)
+		}
+	}
+	if err := UndoBlogMeta(fName); err == nil {
+		t.Errorf("expected an error without a backup")
+	}
+}
+
+func TestLockBlogMeta(t *testing.T) {
+	prefix := path.Join("test", "lock")
+	os.RemoveAll(prefix)
+	os.MkdirAll(prefix, 0777)
+	fName := path.Join(prefix, "blog.json")
+	timeout := BlogLockTimeout
+	defer func() {
+		BlogLockTimeout = timeout
+	}()
+	BlogLockTimeout = 200 * time.Millisecond
+
+	lock, err := LockBlogMeta(fName)
+	if err != nil {
+		t.Errorf("LockBlogMeta(%q) failed, %s", fName, err)
+		t.FailNow()
+	}
+	if _, err := LockBlogMeta(fName); err == nil {
+		t.Errorf("expected a timeout while the lock is held")
+	}
+	held := lock
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		held.Unlock()
+	}()
+	lock, err = LockBlogMeta(fName)
+	if err != nil {
+		t.Errorf("expected the lock once released, %s", err)
+		t.FailNow()
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Errorf("Unlock() failed, %s", err)
+	}
+
+	// Locks left by processes that exited are taken over
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Errorf("Can't run %q, %s", os.Args[0], err)
+		t.FailNow()
+	}
+	lockName := fName + ".lock"
+	ioutil.WriteFile(lockName, []byte(fmt.Sprintf("%d\n", cmd.ProcessState.Pid())), 0666)
+	if lock, err = LockBlogMeta(fName); err != nil {
+		t.Errorf("expected to take over a stale lock, %s", err)
+		t.FailNow()
+	}
+	if src, _ := ioutil.ReadFile(lockName); strings.TrimSpace(string(src)) != fmt.Sprintf("%d", os.Getpid()) {
+		t.Errorf("expected our pid in %q, got %q", lockName, src)
+	}
+	lock.Unlock()
+	ioutil.WriteFile(lockName, []byte(""), 0666)
+	old := time.Now().Add(-time.Minute)
+	os.Chtimes(lockName, old, old)
+	if lock, err = LockBlogMeta(fName); err != nil {
+		t.Errorf("expected to take over an old empty lock, %s", err)
+		t.FailNow()
+	}
+	lock.Unlock()
+
+	// Only one of several lockers takes over a stale lock
+	BlogLockTimeout = 5 * time.Second
+	var (
+		wg      sync.WaitGroup
+		holders int32
+		overlap int32
+	)
+	for round := 0; round < 10; round++ {
+		ioutil.WriteFile(lockName, []byte(fmt.Sprintf("%d\n", cmd.ProcessState.Pid())), 0666)
+		start := make(chan bool)
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				lock, err := LockBlogMeta(fName)
+				if err != nil {
+					t.Errorf("expected to take the lock, %s", err)
+					return
+				}
+				if atomic.AddInt32(&holders, 1) > 1 {
+					atomic.AddInt32(&overlap, 1)
+				}
+				time.Sleep(5 * time.Millisecond)
+				atomic.AddInt32(&holders, -1)
+				lock.Unlock()
+			}()
+		}
+		close(start)
+		wg.Wait()
+	}
+	if overlap > 0 {
+		t.Errorf("expected one holder at a time, %d lockers overlapped", overlap)
+	}
+	if matches, _ := filepath.Glob(lockName + ".*"); len(matches) > 0 {
+		t.Errorf("expected stale locks to be removed, got %v", matches)
+	}
+}
@@ -0,0 +1,161 @@
+//
+// Package mkpage blogstatus.go decides which blog posts are published, e.g. leaving
+// out drafts, posts scheduled for later and expired posts.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// PostPublished is the status of a post that is listed
+	PostPublished = "published"
+	// PostDraft is the status of a post with draft set in its front matter
+	PostDraft = "draft"
+	// PostPending is the status of a post dated in the future
+	PostPending = "pending"
+	// PostExpired is the status of a post past its expires date
+	PostExpired = "expired"
+)
+
+// parsePostDate parses a post's date, e.g. its date or expires front
+// matter. It returns when the date ends, a date without a time ends at
+// midnight of the following day.
+func parsePostDate(s string) (time.Time, time.Time, error) {
+	dt, err := ParsePostDate(s)
+	if len(strings.TrimSpace(s)) == len(DateFmt) {
+		return dt, dt.AddDate(0, 0, 1), err
+	}
+	return dt, dt, err
+}
+
+// Status returns the status of a post at now, one of PostDraft,
+// PostExpired, PostPending or PostPublished.
+func (post *PostObj) Status(now time.Time) string {
+	if post.Draft {
+		return PostDraft
+	}
+	return post.schedule(now)
+}
+
+// schedule returns PostExpired, PostPending or PostPublished for a
+// post at now based on its date and expires date.
+func (post *PostObj) schedule(now time.Time) string {
+	if post.Expires != "" {
+		if _, end, err := parsePostDate(post.Expires); err == nil && now.Before(end) == false {
+			return PostExpired
+		}
+	}
+	if post.Created != "" {
+		if start, _, err := parsePostDate(post.Created); err == nil && now.Before(start) {
+			return PostPending
+		}
+	}
+	return PostPublished
+}
+
+// IsPublished returns true if a post should be included in feeds,
+// indexes and sitemaps. Drafts are included when Drafts is set and
+// pending posts when Future is set, expired posts are never included.
+func (meta *BlogMeta) IsPublished(post *PostObj) bool {
+	if post.Draft && meta.Drafts == false {
+		return false
+	}
+	switch post.schedule(time.Now()) {
+	case PostExpired:
+		return false
+	case PostPending:
+		return meta.Future
+	}
+	return true
+}
+
+// PostStatus reports a post that isn't published
+type PostStatus struct {
+	Status   string `json:"status"`
+	Date     string `json:"date"`
+	Expires  string `json:"expires,omitempty"`
+	Document string `json:"document"`
+	Title    string `json:"title,omitempty"`
+}
+
+// String returns the PostStatus as a line of text
+func (ps *PostStatus) String() string {
+	s := fmt.Sprintf("%-9s %s %s", ps.Status, ps.Date, ps.Document)
+	if ps.Expires != "" {
+		s += fmt.Sprintf(" (expires %s)", ps.Expires)
+	}
+	if ps.Title != "" {
+		s += fmt.Sprintf(" %q", ps.Title)
+	}
+	return s
+}
+
+// Unpublished returns the draft, pending and expired posts at now in
+// blog.json order.
+func (meta *BlogMeta) Unpublished(now time.Time) []*PostStatus {
+	report := []*PostStatus{}
+	for _, yr := range meta.Years {
+		for _, mn := range yr.Months {
+			for _, dy := range mn.Days {
+				for _, post := range dy.Posts {
+					status := post.Status(now)
+					if status == PostPublished {
+						continue
+					}
+					date := post.Created
+					if date == "" {
+						date = fmt.Sprintf("%s-%s-%s", yr.Year, mn.Month, dy.Day)
+					}
+					report = append(report, &PostStatus{
+						Status:   status,
+						Date:     date,
+						Expires:  post.Expires,
+						Document: post.Document,
+						Title:    post.Title,
+					})
+				}
+			}
+		}
+	}
+	return report
+}
+
+// HiddenPages returns the pages of the posts that aren't published
+// (see PostPageName) under docroot, e.g. so sitemapper can leave them
+// out.
+func (meta *BlogMeta) HiddenPages(docroot string) []string {
+	pages := []string{}
+	for _, yr := range meta.Years {
+		for _, mn := range yr.Months {
+			for _, dy := range mn.Days {
+				for _, post := range dy.Posts {
+					if meta.IsPublished(post) == false {
+						pages = append(pages, path.Join(docroot, meta.PostPageName(post)))
+					}
+				}
+			}
+		}
+	}
+	return pages
+}
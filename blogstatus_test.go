@@ -0,0 +1,109 @@
+//
+// blogstatus_test.go test routines for blogstatus.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	// Caltech Library packages
+	"github.com/caltechlibrary/rss2"
+)
+
+func TestPostStatus(t *testing.T) {
+	now := time.Date(2021, time.March, 15, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		post     *PostObj
+		expected string
+	}{
+		{&PostObj{Created: "2021-03-15"}, PostPublished},
+		{&PostObj{Created: "2021-03-16"}, PostPending},
+		{&PostObj{Created: "2021-03-15 11:00:00 -0000"}, PostPublished},
+		{&PostObj{Created: "2021-03-15 13:00:00 -0000"}, PostPending},
+		{&PostObj{Created: "2021-03-01", Draft: true}, PostDraft},
+		{&PostObj{Created: "2021-03-01", Expires: "2021-03-15"}, PostPublished},
+		{&PostObj{Created: "2021-03-01", Expires: "2021-03-14"}, PostExpired},
+		{&PostObj{Created: "2021-03-01", Expires: "2021-03-15 11:00:00 -0000"}, PostExpired},
+	} {
+		if s := test.post.Status(now); s != test.expected {
+			t.Errorf("expected %q for %+v, got %q", test.expected, test.post, s)
+		}
+	}
+
+	newPost := func(slug string, date string) *PostObj {
+		return &PostObj{
+			Slug:     slug,
+			Title:    slug,
+			Document: path.Join("blog", "2021", "03", "15", slug+".md"),
+			Created:  date,
+		}
+	}
+	future := time.Now().AddDate(1, 0, 0).Format(DateFmt)
+	published := newPost("published", "2021-03-15")
+	draft := newPost("draft", "2021-03-15")
+	draft.Draft = true
+	pending := newPost("pending", future)
+	expired := newPost("expired", "2021-03-15")
+	expired.Expires = "2021-03-16"
+	meta := new(BlogMeta)
+	meta.IndexTmpl = "index.tmpl"
+	meta.PostTmpl = "post.tmpl"
+	meta.Years = []*YearObj{
+		&YearObj{Year: "2021", Months: []*MonthObj{&MonthObj{Month: "03", Days: []*DayObj{
+			&DayObj{Day: "15", Posts: []*PostObj{pending, draft, expired, published}},
+		}}}},
+	}
+
+	slugs := func() string {
+		s := []string{}
+		for _, dp := range meta.datedPosts() {
+			s = append(s, dp.post.Slug)
+		}
+		return strings.Join(s, ",")
+	}
+	if s := slugs(); s != "published" {
+		t.Errorf("expected only the published post, got %s", s)
+	}
+	meta.Drafts, meta.Future = true, true
+	if s := slugs(); s != "pending,draft,published" {
+		t.Errorf("expected drafts and pending posts, got %s", s)
+	}
+	meta.Drafts, meta.Future = false, false
+
+	report := meta.Unpublished(time.Now())
+	if len(report) != 3 || report[0].Status != PostPending || report[1].Status != PostDraft || report[2].Status != PostExpired {
+		t.Errorf("unexpected status report %+v", report)
+	}
+	hidden := meta.HiddenPages("htdocs")
+	if len(hidden) != 3 || hidden[0] != "htdocs/blog/2021/03/15/pending.html" {
+		t.Errorf("unexpected hidden pages %+v", hidden)
+	}
+
+	feed := new(rss2.RSS2)
+	published.Description = "Published"
+	if err := BlogMetaToRSS(meta, feed); err != nil {
+		t.Errorf("BlogMetaToRSS() failed, %s", err)
+		t.FailNow()
+	}
+	if len(feed.ItemList) != 1 || feed.ItemList[0].Title != "published" {
+		t.Errorf("expected only the published post in the feed, got %+v", feed.ItemList)
+	}
+}
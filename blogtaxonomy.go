@@ -0,0 +1,380 @@
+//
+// Package mkpage blogtaxonomy.go builds the keyword, category and series pages
+// for a blog.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// TaxonomyKeywords is the taxonomy of post keywords, e.g. blog/keywords/
+	TaxonomyKeywords = "keywords"
+	// TaxonomyCategories is the taxonomy of post categories, e.g. blog/categories/
+	TaxonomyCategories = "categories"
+	// TaxonomySeries is the taxonomy of post series, e.g. blog/series/
+	TaxonomySeries = "series"
+	// TaxonomyAuthors is the taxonomy of post creators, e.g. blog/authors/
+	TaxonomyAuthors = "authors"
+)
+
+// Slugify turns a name into a lower case, dash separated string
+// suitable for a path, e.g. "Digital Collections" becomes
+// "digital-collections".
+func Slugify(name string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && sb.Len() > 0 {
+				sb.WriteRune('-')
+			}
+			sb.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return sb.String()
+}
+
+// TaxonomyTerm is a keyword, category, series or author and its posts
+type TaxonomyTerm struct {
+	// Dir is the term's directory, e.g. blog/series/exhibits
+	Dir      string `json:"-"`
+	Taxonomy string `json:"taxonomy"`
+	Name     string `json:"name"`
+	Slug     string `json:"slug"`
+	Count    int    `json:"count"`
+	// Href is relative to the taxonomy's overview page
+	Href  string                   `json:"href"`
+	Posts []map[string]interface{} `json:"posts,omitempty"`
+	// Person is the author's details, e.g. their ORCID
+	Person *CreatorObj `json:"person,omitempty"`
+
+	posts []*datedPost
+}
+
+// BlogTaxonomy holds the terms of a taxonomy sorted by name
+type BlogTaxonomy struct {
+	// Dir is the taxonomy's directory, e.g. blog/keywords
+	Dir   string          `json:"-"`
+	Name  string          `json:"taxonomy"`
+	Terms []*TaxonomyTerm `json:"terms"`
+}
+
+// Overview returns the terms without their posts, e.g. for listing
+// terms with their counts.
+func (tx *BlogTaxonomy) Overview() []*TaxonomyTerm {
+	terms := []*TaxonomyTerm{}
+	for _, term := range tx.Terms {
+		overview := *term
+		overview.Posts = nil
+		terms = append(terms, &overview)
+	}
+	return terms
+}
+
+// seriesNumber returns a post's series number, posts without a
+// number sort after those with one.
+func seriesNumber(post *PostObj) (int, bool) {
+	i, err := strconv.Atoi(strings.TrimSpace(post.Number))
+	return i, err == nil
+}
+
+// sortSeries orders the posts in a series by Number then by date,
+// posts are in blog.json order (newest first).
+func sortSeries(posts []*datedPost) {
+	for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+		posts[i], posts[j] = posts[j], posts[i]
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		a, aOK := seriesNumber(posts[i].post)
+		b, bOK := seriesNumber(posts[j].post)
+		switch {
+		case aOK && bOK:
+			return a < b
+		case aOK:
+			return true
+		case bOK:
+			return false
+		}
+		return posts[i].post.Number < posts[j].post.Number
+	})
+}
+
+// postTerms returns the terms of a post for a taxonomy
+func postTerms(taxonomy string, post *PostObj) []string {
+	switch taxonomy {
+	case TaxonomyKeywords:
+		return post.Keywords
+	case TaxonomyCategories:
+		return []string{post.Category}
+	case TaxonomySeries:
+		return []string{post.Series}
+	case TaxonomyAuthors:
+		names := []string{}
+		for _, creator := range post.Creators {
+			names = append(names, creator.Name)
+		}
+		return names
+	}
+	return nil
+}
+
+// postCreator returns the post's creator with name
+func postCreator(post *PostObj, name string) *CreatorObj {
+	for _, creator := range post.Creators {
+		if strings.TrimSpace(creator.Name) == name {
+			person := creator
+			return &person
+		}
+	}
+	return nil
+}
+
+// seriesPosts returns the posts in each series ordered by Number
+func (meta *BlogMeta) seriesPosts() map[string][]*datedPost {
+	series := map[string][]*datedPost{}
+	for _, dp := range meta.datedPosts() {
+		if slug := Slugify(dp.post.Series); slug != "" {
+			series[slug] = append(series[slug], dp)
+		}
+	}
+	for _, posts := range series {
+		sortSeries(posts)
+	}
+	return series
+}
+
+// seriesLinks returns the previous and next posts in the post's
+// series with hrefs relative to the post.
+func (meta *BlogMeta) seriesLinks(series map[string][]*datedPost, post *PostObj) (*ArchiveLink, *ArchiveLink) {
+	var prev, next *ArchiveLink
+	posts := series[Slugify(post.Series)]
+	dName := path.Dir(meta.PostPageName(post))
+	for i, dp := range posts {
+		if dp.post != post {
+			continue
+		}
+		if i > 0 {
+			p := posts[i-1].post
+			prev = &ArchiveLink{Label: p.Title, Href: meta.postHref(dName, p)}
+		}
+		if i < (len(posts) - 1) {
+			p := posts[i+1].post
+			next = &ArchiveLink{Label: p.Title, Href: meta.postHref(dName, p)}
+		}
+		break
+	}
+	return prev, next
+}
+
+// Taxonomy returns the keywords, categories or series of the blog
+// under prefix. Terms are matched by their slug, series posts are
+// ordered by Number and other terms list posts newest first.
+func (meta *BlogMeta) Taxonomy(prefix string, taxonomy string) *BlogTaxonomy {
+	tx := &BlogTaxonomy{
+		Dir:   path.Join(prefix, taxonomy),
+		Name:  taxonomy,
+		Terms: []*TaxonomyTerm{},
+	}
+	terms := map[string]*TaxonomyTerm{}
+	for _, dp := range meta.datedPosts() {
+		for _, name := range postTerms(taxonomy, dp.post) {
+			name = strings.TrimSpace(name)
+			slug := Slugify(name)
+			if slug == "" {
+				continue
+			}
+			if _, ok := terms[slug]; ok == false {
+				terms[slug] = &TaxonomyTerm{
+					Dir:      path.Join(tx.Dir, slug),
+					Taxonomy: taxonomy,
+					Name:     name,
+					Slug:     slug,
+					Href:     slug + "/",
+				}
+				if taxonomy == TaxonomyAuthors {
+					terms[slug].Person = postCreator(dp.post, name)
+				}
+				tx.Terms = append(tx.Terms, terms[slug])
+			}
+			terms[slug].posts = append(terms[slug].posts, dp)
+		}
+	}
+	for _, term := range tx.Terms {
+		if taxonomy == TaxonomySeries {
+			sortSeries(term.posts)
+		}
+		term.Count = len(term.posts)
+		term.Posts = meta.postsData(term.Dir, term.posts)
+	}
+	sort.SliceStable(tx.Terms, func(i, j int) bool {
+		return strings.ToLower(tx.Terms[i].Name) < strings.ToLower(tx.Terms[j].Name)
+	})
+	return tx
+}
+
+// Taxonomies returns the keyword, category, series and author
+// taxonomies
+func (meta *BlogMeta) Taxonomies(prefix string) []*BlogTaxonomy {
+	return []*BlogTaxonomy{
+		meta.Taxonomy(prefix, TaxonomyKeywords),
+		meta.Taxonomy(prefix, TaxonomyCategories),
+		meta.Taxonomy(prefix, TaxonomySeries),
+		meta.Taxonomy(prefix, TaxonomyAuthors),
+	}
+}
+
+// taxonomyTmpl returns the template for the terms of a taxonomy
+func (meta *BlogMeta) taxonomyTmpl(taxonomy string) string {
+	switch taxonomy {
+	case TaxonomyKeywords:
+		return meta.KeywordTmpl
+	case TaxonomyCategories:
+		return meta.CategoryTmpl
+	case TaxonomySeries:
+		return meta.SeriesTmpl
+	case TaxonomyAuthors:
+		return meta.AuthorTmpl
+	}
+	return ""
+}
+
+// TermPages returns the BlogPages for rendering a term's index.html
+// with template, paginated when PageSize is set. The page's posts are
+// available as "posts", the term as "term", the page as "pagination"
+// and the blog metadata as "blog".
+func (meta *BlogMeta) TermPages(term *TaxonomyTerm, template string) ([]*BlogPage, error) {
+	pages := []*BlogPage{}
+	for _, lp := range meta.paginate(term.Dir, term.posts) {
+		page := &BlogPage{
+			Name:     path.Join(lp.dir, "index.html"),
+			Template: template,
+			KeyValues: map[string]string{
+				"title":    TextPrefix + term.Name,
+				"taxonomy": TextPrefix + term.Taxonomy,
+			},
+		}
+		pageTerm := *term
+		pageTerm.Href = rebaseHref(path.Dir(term.Dir), lp.dir, term.Href)
+		pageTerm.Posts = meta.postsData(lp.dir, lp.posts)
+		for key, val := range map[string]interface{}{
+			"term":       &pageTerm,
+			"posts":      pageTerm.Posts,
+			"pagination": lp.pagination,
+			"blog":       meta.blogInfo(),
+		} {
+			src, err := jsonValue(val)
+			if err != nil {
+				return nil, err
+			}
+			page.KeyValues[key] = src
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// TaxonomyPage returns the BlogPage for rendering a taxonomy's
+// overview index.html with template. The terms and their counts are
+// available as "terms" and the blog metadata as "blog".
+func (meta *BlogMeta) TaxonomyPage(tx *BlogTaxonomy, template string) (*BlogPage, error) {
+	page := &BlogPage{
+		Name:     path.Join(tx.Dir, "index.html"),
+		Template: template,
+		KeyValues: map[string]string{
+			"title":    TextPrefix + tx.Name,
+			"taxonomy": TextPrefix + tx.Name,
+		},
+	}
+	for key, val := range map[string]interface{}{
+		"terms": tx.Overview(),
+		"blog":  meta.blogInfo(),
+	} {
+		src, err := jsonValue(val)
+		if err != nil {
+			return nil, err
+		}
+		page.KeyValues[key] = src
+	}
+	return page, nil
+}
+
+// taxonomyPages returns the overview and term pages for each taxonomy
+// with templates set in blog.json
+func (meta *BlogMeta) taxonomyPages(prefix string) ([]*BlogPage, error) {
+	pages := []*BlogPage{}
+	if meta.TaxonomyTmpl == "" && meta.KeywordTmpl == "" &&
+		meta.CategoryTmpl == "" && meta.SeriesTmpl == "" &&
+		meta.AuthorTmpl == "" {
+		return pages, nil
+	}
+	for _, tx := range meta.Taxonomies(prefix) {
+		if len(tx.Terms) == 0 {
+			continue
+		}
+		if meta.TaxonomyTmpl != "" {
+			page, err := meta.TaxonomyPage(tx, meta.TaxonomyTmpl)
+			if err != nil {
+				return nil, err
+			}
+			pages = append(pages, page)
+		}
+		if template := meta.taxonomyTmpl(tx.Name); template != "" {
+			for _, term := range tx.Terms {
+				termPages, err := meta.TermPages(term, template)
+				if err != nil {
+					return nil, fmt.Errorf("%s %q, %s", tx.Name, term.Name, err)
+				}
+				pages = append(pages, termPages...)
+			}
+		}
+	}
+	return pages, nil
+}
+
+// taxonomyData returns an index.json for each taxonomy's overview and
+// terms
+func (meta *BlogMeta) taxonomyData(prefix string) []*BlogData {
+	data := []*BlogData{}
+	for _, tx := range meta.Taxonomies(prefix) {
+		if len(tx.Terms) == 0 {
+			continue
+		}
+		data = append(data, &BlogData{
+			Name: path.Join(tx.Dir, "index.json"),
+			Data: &BlogTaxonomy{Name: tx.Name, Terms: tx.Overview()},
+		})
+		for _, term := range tx.Terms {
+			data = append(data, &BlogData{
+				Name: path.Join(term.Dir, "index.json"),
+				Data: term,
+			})
+		}
+	}
+	return data
+}
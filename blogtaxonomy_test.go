@@ -0,0 +1,133 @@
+//
+// blogtaxonomy_test.go test routines for blogtaxonomy.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestTaxonomy(t *testing.T) {
+	for name, expected := range map[string]string{
+		"Digital Collections":  "digital-collections",
+		"  Exhibits! ":         "exhibits",
+		"Caltech's 125th Year": "caltech-s-125th-year",
+		"---":                  "",
+	} {
+		if s := Slugify(name); s != expected {
+			t.Errorf("Slugify(%q) expected %q, got %q", name, expected, s)
+		}
+	}
+
+	meta := new(BlogMeta)
+	newPost := func(ymd string, slug string, number string, keywords ...string) *PostObj {
+		return &PostObj{
+			Slug:     slug,
+			Document: path.Join("blog", ymd, slug+".md"),
+			Title:    slug,
+			Series:   "Exhibits",
+			Number:   number,
+			Category: "News",
+			Keywords: keywords,
+		}
+	}
+	// Newest first as in blog.json, series numbers out of date order
+	p3 := newPost("2021/03/15", "p3", "2", "Library", "maps")
+	p2 := newPost("2021/03/01", "p2", "3", "library")
+	p1 := newPost("2020/12/31", "p1", "1", "Maps")
+	meta.Years = []*YearObj{
+		&YearObj{Year: "2021", Months: []*MonthObj{
+			&MonthObj{Month: "03", Days: []*DayObj{
+				&DayObj{Day: "15", Posts: []*PostObj{p3}},
+				&DayObj{Day: "01", Posts: []*PostObj{p2}},
+			}},
+		}},
+		&YearObj{Year: "2020", Months: []*MonthObj{
+			&MonthObj{Month: "12", Days: []*DayObj{
+				&DayObj{Day: "31", Posts: []*PostObj{p1}},
+			}},
+		}},
+	}
+
+	keywords := meta.Taxonomy("blog", TaxonomyKeywords)
+	if len(keywords.Terms) != 2 {
+		t.Errorf("expected 2 keywords, got %+v", keywords.Terms)
+		t.FailNow()
+	}
+	term := keywords.Terms[0]
+	if term.Name != "Library" || term.Slug != "library" || term.Count != 2 || term.Dir != "blog/keywords/library" {
+		t.Errorf("unexpected keyword %+v", term)
+	}
+	if term.Posts[0]["href"] != "../../2021/03/15/p3.html" {
+		t.Errorf("unexpected post href %q", term.Posts[0]["href"])
+	}
+	if overview := keywords.Overview(); overview[0].Posts != nil || overview[0].Count != 2 || term.Posts == nil {
+		t.Errorf("expected overview without posts, got %+v", overview[0])
+	}
+
+	series := meta.Taxonomy("blog", TaxonomySeries)
+	if len(series.Terms) != 1 || series.Terms[0].Count != 3 {
+		t.Errorf("expected one series with 3 posts, got %+v", series.Terms)
+		t.FailNow()
+	}
+	order := []string{}
+	for _, post := range series.Terms[0].Posts {
+		order = append(order, post["slug"].(string))
+	}
+	if strings.Join(order, ",") != "p1,p3,p2" {
+		t.Errorf("expected series ordered by number, got %s", strings.Join(order, ","))
+	}
+
+	// Series links on post pages
+	page, err := meta.PostPage(p3)
+	if err != nil {
+		t.Errorf("PostPage() failed, %s", err)
+		t.FailNow()
+	}
+	if strings.Contains(page.KeyValues["series_prev"], `"href":"../../../2020/12/31/p1.html"`) == false {
+		t.Errorf("unexpected series_prev %s", page.KeyValues["series_prev"])
+	}
+	if strings.Contains(page.KeyValues["series_next"], `"href":"../01/p2.html"`) == false {
+		t.Errorf("unexpected series_next %s", page.KeyValues["series_next"])
+	}
+	if page, err = meta.PostPage(p1); err != nil || page.KeyValues["series_prev"] != "" {
+		t.Errorf("expected no series_prev for first post, %s", err)
+	}
+
+	meta.TaxonomyTmpl = "taxonomy.tmpl"
+	meta.SeriesTmpl = "series.tmpl"
+	pages, err := meta.Pages("blog")
+	if err != nil {
+		t.Errorf("Pages() failed, %s", err)
+		t.FailNow()
+	}
+	names := []string{}
+	for _, page := range pages {
+		names = append(names, page.Name)
+	}
+	expected := "blog/keywords/index.html,blog/categories/index.html,blog/series/index.html,blog/series/exhibits/index.html"
+	if strings.Join(names, ",") != expected {
+		t.Errorf("expected %s, got %s", expected, strings.Join(names, ","))
+	}
+	meta.TaxonomyJSON = true
+	if data := meta.DataFiles("blog"); len(data) != 7 {
+		t.Errorf("expected 7 data files, got %d", len(data))
+	}
+}
@@ -0,0 +1,245 @@
+//
+// Package mkpage cache.go provides MIME type, Cache-Control and ETag
+// handling for ws.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ImmutableCacheControl is the policy used for fingerprinted assets
+	ImmutableCacheControl = "public, max-age=31536000, immutable"
+)
+
+var (
+	// DefaultMimeTypes corrects or adds to Go's MIME table
+	DefaultMimeTypes = map[string]string{
+		".mjs":         "text/javascript; charset=utf-8",
+		".js":          "text/javascript; charset=utf-8",
+		".wasm":        "application/wasm",
+		".webmanifest": "application/manifest+json",
+		".md":          "text/markdown; charset=utf-8",
+		".fountain":    "text/plain; charset=utf-8",
+	}
+
+	// fingerprintRE matches names like app.3f2a9c1b.js or
+	// site-0123456789ab.css
+	fingerprintRE = regexp.MustCompile(`^.+[.\-_][0-9a-fA-F]{8,64}\.[A-Za-z0-9]+$`)
+)
+
+// CachePolicy maps a glob pattern to a Cache-Control value. Patterns
+// without a slash are matched against the file name, otherwise against
+// the URL path (e.g. "*.html", "/assets/*").
+type CachePolicy struct {
+	Pattern      string `json:"pattern"`
+	CacheControl string `json:"cache_control"`
+}
+
+// CacheConfig holds the MIME type, Cache-Control and ETag settings
+// for ws.
+type CacheConfig struct {
+	// DocRoot is used to read files when computing ETags
+	DocRoot string `json:"-"`
+	// MimeTypes maps a file extension to a MIME type
+	MimeTypes map[string]string `json:"mime_types,omitempty"`
+	// Policies are checked in order, first match wins
+	Policies []CachePolicy `json:"cache_control,omitempty"`
+	// DefaultCacheControl is used when no policy matches
+	DefaultCacheControl string `json:"default_cache_control,omitempty"`
+	// ETags turns on strong ETags computed from file content
+	ETags bool `json:"etags,omitempty"`
+	// Immutable marks fingerprinted assets as immutable
+	Immutable bool `json:"immutable,omitempty"`
+
+	// etags caches content hashes by path
+	etags sync.Map
+}
+
+// etagEntry holds a computed ETag and the file state it was
+// computed from.
+type etagEntry struct {
+	ModTime time.Time
+	Size    int64
+	ETag    string
+}
+
+// LoadCacheConfig reads a JSON document and returns a *CacheConfig
+func LoadCacheConfig(fName string) (*CacheConfig, error) {
+	src, err := ioutil.ReadFile(fName)
+	if err != nil {
+		return nil, fmt.Errorf("Reading %q, %s", fName, err)
+	}
+	cfg := new(CacheConfig)
+	if err := json.Unmarshal(src, &cfg); err != nil {
+		return nil, fmt.Errorf("Unmarshing %q, %s", fName, err)
+	}
+	return cfg, nil
+}
+
+// ForDocRoot returns a copy of the settings for another document root
+func (cfg *CacheConfig) ForDocRoot(docRoot string) *CacheConfig {
+	if cfg == nil {
+		return nil
+	}
+	return &CacheConfig{
+		DocRoot:             docRoot,
+		MimeTypes:           cfg.MimeTypes,
+		Policies:            cfg.Policies,
+		DefaultCacheControl: cfg.DefaultCacheControl,
+		ETags:               cfg.ETags,
+		Immutable:           cfg.Immutable,
+	}
+}
+
+// RegisterMimeTypes adds the extension to MIME type map to Go's
+// MIME table used by http.FileServer.
+func RegisterMimeTypes(m map[string]string) error {
+	for ext, mimeType := range m {
+		if strings.HasPrefix(ext, ".") == false {
+			ext = "." + ext
+		}
+		if err := mime.AddExtensionType(ext, mimeType); err != nil {
+			return fmt.Errorf("MIME type %q for %q, %s", mimeType, ext, err)
+		}
+	}
+	return nil
+}
+
+// IsFingerprinted returns true if the file name has a content hash
+// embedded in it (e.g. app.3f2a9c1b.js)
+func IsFingerprinted(p string) bool {
+	return fingerprintRE.MatchString(path.Base(p))
+}
+
+// CacheControlFor returns the Cache-Control value for a URL path
+func (cfg *CacheConfig) CacheControlFor(p string) string {
+	if strings.HasSuffix(p, "/") {
+		p = p + "index.html"
+	}
+	for _, policy := range cfg.Policies {
+		target := p
+		if strings.Contains(policy.Pattern, "/") == false {
+			target = path.Base(p)
+		}
+		if ok, _ := path.Match(policy.Pattern, target); ok {
+			return policy.CacheControl
+		}
+	}
+	if cfg.Immutable && IsFingerprinted(p) {
+		return ImmutableCacheControl
+	}
+	return cfg.DefaultCacheControl
+}
+
+// fileInfo returns the os.FileInfo for a URL path mapping a trailing
+// slash to index.html, it returns nil for directories and missing files.
+func (cfg *CacheConfig) fileInfo(p string) (http.File, os.FileInfo) {
+	if strings.HasSuffix(p, "/") {
+		p = p + "index.html"
+	}
+	fp, err := http.Dir(cfg.DocRoot).Open(p)
+	if err != nil {
+		return nil, nil
+	}
+	info, err := fp.Stat()
+	if err != nil || info.IsDir() {
+		fp.Close()
+		return nil, nil
+	}
+	return fp, info
+}
+
+// ETagFor returns a strong ETag based on a SHA-256 of the content
+// of p. An empty string is returned for directories or missing files.
+func (cfg *CacheConfig) ETagFor(p string) string {
+	fp, info := cfg.fileInfo(p)
+	if fp == nil {
+		return ""
+	}
+	defer fp.Close()
+	if val, ok := cfg.etags.Load(p); ok {
+		entry := val.(etagEntry)
+		if entry.Size == info.Size() && entry.ModTime.Equal(info.ModTime()) {
+			return entry.ETag
+		}
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, fp); err != nil {
+		return ""
+	}
+	etag := fmt.Sprintf("%q", fmt.Sprintf("%x", h.Sum(nil))[0:32])
+	cfg.etags.Store(p, etagEntry{
+		ModTime: info.ModTime(),
+		Size:    info.Size(),
+		ETag:    etag,
+	})
+	return etag
+}
+
+// Handler accepts an http.Handler and returns a http.Handler. It sets
+// the Content-Type, Cache-Control and ETag headers before passing the
+// request on. http.FileServer uses the ETag to answer If-None-Match and
+// the file's modification time to answer If-Modified-Since. Cache-Control
+// and ETag are only set for files that exist so a 404 is never cached
+// as immutable.
+func (cfg *CacheConfig) Handler(next http.Handler) http.Handler {
+	if cfg == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		if ext := path.Ext(r.URL.Path); ext != "" {
+			if mimeType, ok := cfg.MimeTypes[ext]; ok {
+				h.Set("Content-Type", mimeType)
+			} else if mimeType, ok := cfg.MimeTypes[strings.TrimPrefix(ext, ".")]; ok {
+				h.Set("Content-Type", mimeType)
+			}
+		}
+		if fp, _ := cfg.fileInfo(r.URL.Path); fp != nil {
+			fp.Close()
+			if cacheControl := cfg.CacheControlFor(r.URL.Path); cacheControl != "" {
+				h.Set("Cache-Control", cacheControl)
+			}
+			if cfg.ETags {
+				if etag := cfg.ETagFor(r.URL.Path); etag != "" {
+					h.Set("ETag", etag)
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,110 @@
+//
+// cache_test.go test routines for cache.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestIsFingerprinted(t *testing.T) {
+	boolTests := map[string]bool{
+		"app.js":                     false,
+		"/assets/app.3f2a9c1b.js":    true,
+		"site-0123456789ab.css":      true,
+		"2021-07-01-vacation.md":     false,
+		"/css/site.deadbeefcafe.css": true,
+	}
+	for p, expected := range boolTests {
+		if r := IsFingerprinted(p); r != expected {
+			t.Errorf("expected %t, got %t for %q", expected, r, p)
+		}
+	}
+}
+
+func TestCacheConfig(t *testing.T) {
+	htdocs := path.Join("test", "htdocs")
+	os.MkdirAll(htdocs, 0777)
+	for _, fName := range []string{"index.html", "app.3f2a9c1b.js", "mod.mjs"} {
+		if err := ioutil.WriteFile(path.Join(htdocs, fName), []byte("console.log('Hello World!');\n"), 0666); err != nil {
+			t.Errorf("Can't create %q, %s", fName, err)
+			t.FailNow()
+		}
+	}
+	cfg := &CacheConfig{
+		DocRoot:   htdocs,
+		MimeTypes: map[string]string{".mjs": "text/javascript"},
+		Policies: []CachePolicy{
+			{Pattern: "*.html", CacheControl: "no-cache"},
+		},
+		ETags:     true,
+		Immutable: true,
+	}
+	handler := cfg.Handler(http.FileServer(http.Dir(htdocs)))
+
+	req := httptest.NewRequest("GET", "/app.3f2a9c1b.js", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if cc := rec.Header().Get("Cache-Control"); cc != ImmutableCacheControl {
+		t.Errorf("expected %q, got %q", ImmutableCacheControl, cc)
+	}
+	etag := rec.Header().Get("ETag")
+	if etag == "" {
+		t.Errorf("expected an ETag")
+		t.FailNow()
+	}
+
+	// Conditional request
+	req = httptest.NewRequest("GET", "/app.3f2a9c1b.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if cc := rec.Header().Get("Cache-Control"); cc != "no-cache" {
+		t.Errorf("expected no-cache for index.html, got %q", cc)
+	}
+
+	req = httptest.NewRequest("GET", "/mod.mjs", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != "text/javascript" {
+		t.Errorf("expected text/javascript, got %q", ct)
+	}
+
+	// Missing files don't get cache headers
+	req = httptest.NewRequest("GET", "/missing.3f2a9c1b.js", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", rec.Code)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != "" {
+		t.Errorf("expected no Cache-Control for 404, got %q", cc)
+	}
+}
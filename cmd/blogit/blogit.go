@@ -22,8 +22,12 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/exec"
+	"os/signal"
 	"path"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	// Caltech Library packages
@@ -69,6 +73,16 @@ structures for things like podcasts or videocasts.
 
 Where "-p, -prefix" sets the prefix path before the YYYY/MM/DD path.
 
+The date can include a time of day and timezone. Posts on the same
+day are listed newest first and feeds use the time as the pubDate.
+A "date" in the post's front matter takes precedence.
+
+    %s my-vacation-day.md 2021-07-01T14:30:00-07:00
+
+Front matter fields blogit doesn't use, e.g. "image" or "location",
+are kept in the post's "extra" in blog.json so templates can use
+them (e.g. post.extra.image).
+
 
 If you have an existing blog paths in the form of
 PREFIX/YYYY/MM/DD you can use blogit to create/update/recreate
@@ -78,6 +92,148 @@ the blog.json file.
 
 The option "-refresh" is what indicates you want to crawl
 for blog posts for that year.
+
+Saves of blog.json are written to a temp file and renamed and a
+lock file (blog.json.lock) is held while blogit updates it, so
+concurrent runs (e.g. make -j) wait for each other. "-backups"
+keeps the previous versions as blog.json.1, blog.json.2, etc. and
+"-undo" restores the last one.
+
+    %s -prefix=blog -backups=3
+    %s -prefix=blog -undo
+
+"-new" starts a draft post, a Markdown document named for the
+title's slug in its YYYY/MM/DD folder (or the "-drafts-dir"
+folder). Its front matter comes from the "-post-skeleton"
+template (a Go text/template given .Title, .Slug, .Date and
+.Creators) or a default with the title, date, the
+"-default-author" as its creator, "draft: true" and empty
+keywords. "-edit" opens it in $EDITOR and adds it to blog.json
+if you set draft to false, otherwise "-publish" adds it later.
+
+    %s -prefix=blog -default-author=jdoe
+    %s -prefix=blog -new "My Vacation Day" 2021-07-01
+    %s -prefix=blog -new "My Vacation Day" -edit
+    %s -prefix=blog -publish blog/2021/07/01/my-vacation-day.md
+
+"-import" brings in the posts of another blog, a Jekyll site (or
+its _posts folder), a Hugo site (or its content/posts folder,
+front matter can be YAML, TOML or JSON) or a WordPress export
+(WXR .xml). Posts are written to their YYYY/MM/DD folder with
+front matter normalized to title, date, creators, keywords (from
+tags and categories) and draft. Media they reference are copied
+next to them, for WordPress from a local copy of its uploads
+folder set with "-uploads", media with the same name are numbered
+(e.g. photo-2.jpg). Nothing is imported if a post's document
+already exists. "-redirects-csv" writes redirects from the old URLs.
+
+    %s -prefix=blog -import=../old-site -redirects-csv=redirects.csv
+    %s -prefix=blog -import=wordpress.xml \
+        -uploads=wp-content/uploads -redirects-csv=redirects.csv
+
+To rebuild blog.json from all the years under the prefix use
+"-refresh-all". Posts whose documents are gone are dropped.
+
+    %s -prefix=blog -refresh-all
+
+"-check" reports posts whose documents are missing, post documents
+that aren't in blog.json, duplicate slugs, invalid dates and front
+matter dates that don't match the post's folder. It exits non-zero
+if there are any, e.g. for a CI job.
+
+    %s -prefix=blog -check
+
+If blog.json sets the post and index templates you can render
+each post's HTML next to its document and the blog's index.html
+with Pandoc.
+
+    %s -prefix=blog -post-tmpl=post.tmpl -index-tmpl=index.tmpl
+    %s -prefix=blog -render
+
+The "-render" option can also be combined with adding a post or
+refreshing the blog.
+
+    %s -prefix=blog -render my-vacation-day.md 2021-07-01
+
+By default a post is published as HTML next to its document, e.g.
+blog/2021/07/01/my-vacation-day.html. A permalink pattern sets a
+different URL (relative to the site root, like the document paths),
+it is used when rendering, in feeds (mkrss) and sitemaps. Patterns
+can use :prefix, :year, :month, :day and :slug. A pattern ending
+in "/" is rendered to an index.html.
+
+    %s -prefix=blog -permalink="/:prefix/:year/:month/:slug/"
+    %s -prefix=blog -permalink="/posts/:slug.html"
+
+Archive pages for each year, month and day (e.g. blog/2021/,
+blog/2021/07/ and blog/2021/07/01/) are rendered when their
+templates are set. Each lists its posts and links to the previous
+and next period. The "-archive-json" option also writes an
+index.json for each archive.
+
+    %s -prefix=blog -year-tmpl=year.tmpl -month-tmpl=month.tmpl \
+        -day-tmpl=day.tmpl -archive-json
+    %s -prefix=blog -render
+
+Posts are also grouped by their keywords, category and series
+(e.g. blog/keywords/, blog/categories/ and blog/series/). Each
+taxonomy gets an overview page listing its terms with post counts
+and each term gets a page listing its posts. Series list posts
+in order of their number and post pages get "series_prev" and
+"series_next" links. The "-taxonomy-json" option writes an
+index.json for each overview and term.
+
+    %s -prefix=blog -taxonomy-tmpl=taxonomy.tmpl \
+        -keyword-tmpl=keyword.tmpl -category-tmpl=category.tmpl \
+        -series-tmpl=series.tmpl -taxonomy-json
+    %s -prefix=blog -render
+
+A people file (JSON or YAML) lists the blog's authors by id with
+their name, orcid, ror (their affiliation's ROR id), affiliation,
+email and url. Posts can then give their creators by id, e.g.
+"authors: [jdoe]" or "creators: [{id: jdoe}]", and blogit fills in
+the rest. Each author gets a page in blog/authors/ (the term's
+"person" holds their details) and feeds (mkrss) include the post
+authors. The people file's path is kept relative to blog.json, run
+"-people" again after editing it to update the posts.
+
+    %s -prefix=blog -people=people.yaml -author-tmpl=author.tmpl
+
+The index, archive and taxonomy pages can be paginated. Here each
+page lists 20 posts, the second page of the blog index is
+blog/page/2/index.html. Templates get a "pagination" object with
+page, pages, total, first, last, prev and next (the hrefs are
+relative to the page, e.g. for rel="prev" and rel="next" links).
+
+    %s -prefix=blog -page-size=20 -page-pattern="page/:page/"
+
+Posts with "draft: true" in their front matter, posts dated after
+today and posts past their "expires" date are left out when
+rendering (and by mkrss and sitemapper). To preview drafts and
+posts scheduled for later,
+
+    %s -prefix=blog -drafts -future -render
+
+List the pending, draft and expired posts,
+
+    %s -prefix=blog -status
+
+Remove a post (and its files, including its page at the permalink)
+from the blog,
+
+    %s -prefix=blog -remove=my-vacation-day
+
+Move a post (and its files, including its page) to a new date,
+appending redirects from the old URL to the new one in the CSV
+file ws reads with -redirects-csv. The "-redirect-stubs" option
+leaves a page that redirects with a meta refresh in place of the
+old HTML for hosts without redirect support. If a slug is used on
+more than one day give the date too, e.g.
+-move=2021-07-01/my-vacation-day. If a file can't be moved the
+post is left where it was.
+
+    %s -prefix=blog -redirects-csv=redirects.csv \
+        -move=my-vacation-day 2021-07-04
 `
 
 	// Standard Options
@@ -90,24 +246,105 @@ for blog posts for that year.
 	generateMarkdown bool
 
 	// Application Options
-	prefixPath     string
-	docName        string
-	dateString     string
-	blogAsset      bool
-	refreshBlog    string
-	setName        string
-	setStarted     string
-	setEnded       string
-	setQuip        string
-	setDescription string
-	setBaseURL     string
-	setIndexTmpl   string
-	setPostTmpl    string
-	setCopyright   string
-	setLicense     string
-	setLanguage    string
+	prefixPath      string
+	docName         string
+	dateString      string
+	blogAsset       bool
+	renderBlog      bool
+	refreshBlog     string
+	refreshAll      bool
+	checkBlog       bool
+	setName         string
+	setStarted      string
+	setEnded        string
+	setQuip         string
+	setDescription  string
+	setBaseURL      string
+	setIndexTmpl    string
+	setPostTmpl     string
+	setYearTmpl     string
+	setMonthTmpl    string
+	setDayTmpl      string
+	archiveJSON     bool
+	setTaxonomyTmpl string
+	setKeywordTmpl  string
+	setCategoryTmpl string
+	setSeriesTmpl   string
+	taxonomyJSON    bool
+	setPageSize     int
+	setPagePattern  string
+	showDrafts      bool
+	showFuture      bool
+	showStatus      bool
+	removeSlug      string
+	moveSlug        string
+	redirectsCSV    string
+	redirectStubs   bool
+	setPermalink    string
+	setPeople       string
+	setAuthorTmpl   string
+	newTitle        string
+	editPost        bool
+	publishDraft    string
+	setAuthor       string
+	setSkeleton     string
+	setDraftsDir    string
+	importSource    string
+	importUploads   string
+	setBackups      int
+	undoBlog        bool
+	setCopyright    string
+	setLicense      string
+	setLanguage     string
+
+	// blogLock is held while blog.json is updated, blogLockMu guards
+	// it against the signal handler
+	blogLock   *mkpage.BlogLock
+	blogLockMu sync.Mutex
 )
 
+// editDocument opens fName in $EDITOR and waits for it to exit
+func editDocument(fName string) error {
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		return fmt.Errorf("EDITOR isn't set, edit %s then run with -publish", fName)
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], fName)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	return cmd.Run()
+}
+
+// releaseLock releases the lock on blog.json if it is held
+func releaseLock() {
+	blogLockMu.Lock()
+	defer blogLockMu.Unlock()
+	blogLock.Unlock()
+	blogLock = nil
+}
+
+// exit releases the lock on blog.json and exits
+func exit(code int) {
+	releaseLock()
+	os.Exit(code)
+}
+
+// render writes the post and index HTML pages for the blog, exits
+// on error.
+func render(app *cli.Cli, meta *mkpage.BlogMeta, prefixPath string) {
+	if meta.PostTmpl == "" && meta.IndexTmpl == "" && meta.YearTmpl == "" &&
+		meta.MonthTmpl == "" && meta.DayTmpl == "" && meta.ArchiveJSON == false &&
+		meta.TaxonomyTmpl == "" && meta.KeywordTmpl == "" &&
+		meta.CategoryTmpl == "" && meta.SeriesTmpl == "" && meta.AuthorTmpl == "" &&
+		meta.TaxonomyJSON == false {
+		fmt.Fprintf(app.Eout, "Missing templates, see -help for the template options\n")
+		exit(1)
+	}
+	if err := meta.Render(prefixPath, showVerbose); err != nil {
+		fmt.Fprintf(app.Eout, "%s\n", err)
+		exit(1)
+	}
+}
+
 func main() {
 	app := cli.NewCli(mkpage.Version)
 	appName := app.AppName()
@@ -118,7 +355,7 @@ func main() {
 	// Add Help docs
 	app.AddHelp("license", []byte(fmt.Sprintf(mkpage.LicenseText, appName, mkpage.Version)))
 	app.AddHelp("description", []byte(fmt.Sprintf(description)))
-	app.AddHelp("examples", []byte(fmt.Sprintf(examples, appName, appName, appName, appName, appName, appName)))
+	app.AddHelp("examples", []byte(fmt.Sprintf(examples, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName)))
 
 	// Setup Environment variables
 
@@ -133,6 +370,8 @@ func main() {
 	// Application specific options
 	app.StringVar(&prefixPath, "P,prefix", "", "Set the prefix path before YYYY/MM/DD.")
 	app.StringVar(&refreshBlog, "R,refresh", "", "Refresh blog.json for a given year")
+	app.BoolVar(&refreshAll, "refresh-all", false, "Rebuild blog.json from all the years under the prefix path")
+	app.BoolVar(&checkBlog, "check", false, "Report missing, unindexed and duplicate posts and invalid dates, exits non-zero if any are found")
 	app.StringVar(&setName, "N,name", "", "Set the blog name.")
 	app.StringVar(&setQuip, "Q,quip", "", "Set the blog quip.")
 	app.StringVar(&setCopyright, "C,copyright", "", "Set the blog copyright notice.")
@@ -144,7 +383,39 @@ func main() {
 	app.StringVar(&setBaseURL, "U,url", "", "Set blog's URL")
 	app.StringVar(&setIndexTmpl, "IT,index-tmpl", "", "Set index blog template")
 	app.StringVar(&setPostTmpl, "PT,post-tmpl", "", "Set index blog template")
+	app.StringVar(&setYearTmpl, "YT,year-tmpl", "", "Set year archive template")
+	app.StringVar(&setMonthTmpl, "MT,month-tmpl", "", "Set month archive template")
+	app.StringVar(&setDayTmpl, "DT,day-tmpl", "", "Set day archive template")
+	app.BoolVar(&archiveJSON, "archive-json", false, "Write an index.json for each year, month and day archive when rendering")
+	app.StringVar(&setTaxonomyTmpl, "TT,taxonomy-tmpl", "", "Set keywords, categories, series and authors overview template")
+	app.StringVar(&setKeywordTmpl, "KT,keyword-tmpl", "", "Set keyword page template")
+	app.StringVar(&setCategoryTmpl, "CT,category-tmpl", "", "Set category page template")
+	app.StringVar(&setSeriesTmpl, "ST,series-tmpl", "", "Set series page template")
+	app.BoolVar(&taxonomyJSON, "taxonomy-json", false, "Write an index.json for each keyword, category, series and author when rendering")
+	app.IntVar(&setPageSize, "page-size", 0, "Set the number of posts per page for the index, archive and taxonomy pages, -1 for no pagination")
+	app.StringVar(&setPagePattern, "page-pattern", "", "Set the path of pages after the first (default \""+mkpage.DefaultPagePattern+"\")")
+	app.BoolVar(&showDrafts, "drafts", false, "Include draft posts when rendering, e.g. to preview them")
+	app.BoolVar(&showFuture, "future", false, "Include posts dated in the future when rendering")
+	app.BoolVar(&showStatus, "status", false, "List the pending, draft and expired posts")
+	app.StringVar(&removeSlug, "remove", "", "Remove the post with this slug (or DATE/SLUG) and its files")
+	app.StringVar(&moveSlug, "move", "", "Move the post with this slug (or DATE/SLUG) and its files to the date given as a parameter")
+	app.StringVar(&redirectsCSV, "redirects-csv", "", "Append redirects for moved posts to this CSV file (see ws -redirects-csv)")
+	app.BoolVar(&redirectStubs, "redirect-stubs", false, "Leave a meta refresh page in place of each moved post's HTML")
+	app.StringVar(&setPermalink, "permalink", "", "Set the permalink pattern for posts, e.g. /:prefix/:year/:month/:slug/")
+	app.StringVar(&setPeople, "people", "", "Set the people file (JSON or YAML) post creators can refer to by id")
+	app.StringVar(&setAuthorTmpl, "AT,author-tmpl", "", "Set author page template")
+	app.StringVar(&newTitle, "new", "", "Start a draft post with this title for the date given as a parameter (default today)")
+	app.BoolVar(&editPost, "edit", false, "Open the new post in $EDITOR and add it to blog.json if its draft is cleared")
+	app.StringVar(&publishDraft, "publish", "", "Add a post started with -new to blog.json once its draft is cleared")
+	app.StringVar(&setAuthor, "default-author", "", "Set the creator (a person id or name) of new posts")
+	app.StringVar(&setSkeleton, "post-skeleton", "", "Set the template for new posts")
+	app.StringVar(&setDraftsDir, "drafts-dir", "", "Set the folder for new posts, by default they go in their YYYY/MM/DD folder")
+	app.StringVar(&importSource, "import", "", "Import the posts of a Jekyll site or _posts folder, a Hugo site or content folder or a WordPress export (.xml)")
+	app.StringVar(&importUploads, "uploads", "", "Set the local copy of the WordPress uploads folder (wp-content/uploads) to copy media from")
+	app.IntVar(&setBackups, "backups", 0, "Set the number of backups of blog.json to keep (blog.json.1, ...), -1 for none")
+	app.BoolVar(&undoBlog, "undo", false, "Restore blog.json from its last backup")
 	app.BoolVar(&blogAsset, "a,asset", false, "Copy asset file to the blog path for provided date (YYYY-MM-DD)")
+	app.BoolVar(&renderBlog, "render", false, "Render posts and the blog index using the post and index templates")
 
 	app.Parse()
 	args := app.Args()
@@ -185,12 +456,43 @@ func main() {
 
 	blogJSON := path.Join(prefixPath, "blog.json")
 
+	// Hold the lock on blog.json while it is loaded, updated and saved
+	if checkBlog == false && showStatus == false {
+		if prefixPath != "" {
+			os.MkdirAll(prefixPath, 0777)
+		}
+		lock, err := mkpage.LockBlogMeta(blogJSON)
+		if err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			os.Exit(1)
+		}
+		blogLock = lock
+		// Release the lock when interrupted
+		interrupted := make(chan os.Signal, 1)
+		signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-interrupted
+			fmt.Fprintf(app.Eout, "Received %s, releasing the lock on %s\n", sig, blogJSON)
+			exit(1)
+		}()
+	}
+
+	// handle option terminating case of undoBlog
+	if undoBlog {
+		if err := mkpage.UndoBlogMeta(blogJSON); err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(app.Out, "Restored the previous %q\n", blogJSON)
+		exit(0)
+	}
+
 	// See if we have data to read in.
 	if _, err := os.Stat(blogJSON); os.IsNotExist(err) {
 	} else {
 		if err := mkpage.LoadBlogMeta(blogJSON, meta); err != nil {
 			fmt.Fprintf(app.Eout, "Error reading %q, %s\n", blogJSON, err)
-			os.Exit(1)
+			exit(1)
 		}
 	}
 
@@ -225,6 +527,280 @@ func main() {
 	if setPostTmpl != "" {
 		meta.PostTmpl = setPostTmpl
 	}
+	if setYearTmpl != "" {
+		meta.YearTmpl = setYearTmpl
+	}
+	if setMonthTmpl != "" {
+		meta.MonthTmpl = setMonthTmpl
+	}
+	if setDayTmpl != "" {
+		meta.DayTmpl = setDayTmpl
+	}
+	if archiveJSON {
+		meta.ArchiveJSON = true
+	}
+	if setTaxonomyTmpl != "" {
+		meta.TaxonomyTmpl = setTaxonomyTmpl
+	}
+	if setKeywordTmpl != "" {
+		meta.KeywordTmpl = setKeywordTmpl
+	}
+	if setCategoryTmpl != "" {
+		meta.CategoryTmpl = setCategoryTmpl
+	}
+	if setSeriesTmpl != "" {
+		meta.SeriesTmpl = setSeriesTmpl
+	}
+	if taxonomyJSON {
+		meta.TaxonomyJSON = true
+	}
+	if setPageSize != 0 {
+		meta.PageSize = setPageSize
+		if setPageSize < 0 {
+			meta.PageSize = 0
+		}
+	}
+	if setPagePattern != "" {
+		meta.PagePattern = setPagePattern
+	}
+	if setPermalink != "" {
+		meta.Permalink = setPermalink
+	}
+	if setPeople != "" {
+		meta.SetPeople(blogJSON, setPeople)
+		if err := meta.ResolveCreators(); err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+	}
+	if setAuthorTmpl != "" {
+		meta.AuthorTmpl = setAuthorTmpl
+	}
+	if setAuthor != "" {
+		meta.DefaultAuthor = setAuthor
+	}
+	if setSkeleton != "" {
+		meta.PostSkeleton = setSkeleton
+	}
+	if setDraftsDir != "" {
+		meta.DraftsDir = setDraftsDir
+	}
+	if setBackups != 0 {
+		meta.Backups = setBackups
+		if setBackups < 0 {
+			meta.Backups = 0
+		}
+	}
+
+	meta.Drafts = showDrafts
+	meta.Future = showFuture
+
+	// handle option terminating case of showStatus
+	if showStatus {
+		for _, ps := range meta.Unpublished(time.Now()) {
+			fmt.Fprintf(app.Out, "%s\n", ps)
+		}
+		exit(0)
+	}
+
+	// handle option terminating case of removeSlug
+	if removeSlug != "" {
+		files, err := meta.RemovePost(removeSlug)
+		if err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		for _, fName := range files {
+			fmt.Fprintf(app.Out, "Removed %s\n", fName)
+		}
+		if err := meta.Save(blogJSON); err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		if renderBlog {
+			render(app, meta, prefixPath)
+		}
+		exit(0)
+	}
+
+	// handle option terminating case of moveSlug
+	if moveSlug != "" {
+		if len(args) != 1 {
+			fmt.Fprintf(app.Eout, "Expected a new date (YYYY-MM-DD or a timestamp) for %q\n", moveSlug)
+			exit(1)
+		}
+		if _, err := mkpage.ParsePostDate(args[0]); err != nil {
+			fmt.Fprintf(app.Eout, "Date error %q, %s\n", args[0], err)
+			exit(1)
+		}
+		moved, err := meta.MovePost(prefixPath, moveSlug, args[0])
+		for _, names := range moved {
+			fmt.Fprintf(app.Out, "Moved %s to %s\n", names[0], names[1])
+		}
+		if err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		if err := meta.Save(blogJSON); err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		redirects := meta.MoveRedirects(moved)
+		if redirectsCSV != "" {
+			if err := mkpage.AppendRedirectsCSV(redirectsCSV, redirects); err != nil {
+				fmt.Fprintf(app.Eout, "%s\n", err)
+				exit(1)
+			}
+		}
+		if redirectStubs {
+			stubs, err := mkpage.WriteRedirectStubs(redirects)
+			if err != nil {
+				fmt.Fprintf(app.Eout, "%s\n", err)
+				exit(1)
+			}
+			for _, fName := range stubs {
+				fmt.Fprintf(app.Out, "Wrote redirect %s\n", fName)
+			}
+		}
+		if renderBlog {
+			render(app, meta, prefixPath)
+		}
+		exit(0)
+	}
+
+	// handle option terminating case of newTitle
+	if newTitle != "" {
+		dateString = time.Now().Format(mkpage.DateFmt)
+		if len(args) > 0 {
+			dateString = args[0]
+			if _, err := mkpage.ParsePostDate(dateString); err != nil {
+				fmt.Fprintf(app.Eout, "Date error %q, %s\n", dateString, err)
+				exit(1)
+			}
+		}
+		fName, err := meta.NewPost(prefixPath, newTitle, dateString)
+		if err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(app.Out, "Created %s\n", fName)
+		if editPost == false {
+			exit(0)
+		}
+		// NOTE: blog.json isn't locked while the post is edited
+		releaseLock()
+		if err := editDocument(fName); err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		blogLockMu.Lock()
+		blogLock, err = mkpage.LockBlogMeta(blogJSON)
+		blogLockMu.Unlock()
+		if err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		if _, err := os.Stat(blogJSON); err == nil {
+			if err := mkpage.LoadBlogMeta(blogJSON, meta); err != nil {
+				fmt.Fprintf(app.Eout, "Error reading %q, %s\n", blogJSON, err)
+				exit(1)
+			}
+		}
+		publishDraft = fName
+	}
+
+	// handle option terminating case of publishDraft
+	if publishDraft != "" {
+		fName, err := meta.PublishDraft(prefixPath, publishDraft)
+		if err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		if fName == "" {
+			fmt.Fprintf(app.Out, "%s is a draft, run \"%s -prefix=%s -publish %s\" once draft is false\n", publishDraft, appName, prefixPath, publishDraft)
+			exit(0)
+		}
+		if err := meta.Save(blogJSON); err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(app.Out, "Added %s to %s\n", fName, blogJSON)
+		if renderBlog {
+			render(app, meta, prefixPath)
+		}
+		exit(0)
+	}
+
+	// handle option terminating case of importSource
+	if importSource != "" {
+		posts, err := mkpage.ReadImport(importSource, importUploads)
+		if err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		redirects, err := meta.Import(prefixPath, posts)
+		if err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		if err := meta.Save(blogJSON); err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		fmt.Fprintf(app.Out, "Imported %d posts from %s\n", len(posts), importSource)
+		if redirectsCSV != "" {
+			if err := mkpage.AppendRedirectsCSV(redirectsCSV, redirects); err != nil {
+				fmt.Fprintf(app.Eout, "%s\n", err)
+				exit(1)
+			}
+			fmt.Fprintf(app.Out, "Wrote %d redirects to %s\n", len(redirects), redirectsCSV)
+		}
+		if redirectStubs {
+			stubs, err := mkpage.WriteRedirectStubs(redirects)
+			if err != nil {
+				fmt.Fprintf(app.Eout, "%s\n", err)
+				exit(1)
+			}
+			for _, fName := range stubs {
+				fmt.Fprintf(app.Out, "Wrote redirect %s\n", fName)
+			}
+		}
+		if renderBlog {
+			render(app, meta, prefixPath)
+		}
+		exit(0)
+	}
+
+	// handle option terminating case of checkBlog
+	if checkBlog {
+		issues := meta.Check(prefixPath)
+		for _, issue := range issues {
+			fmt.Fprintf(app.Out, "%s\n", issue)
+		}
+		if len(issues) > 0 {
+			fmt.Fprintf(app.Eout, "%d issue(s) found in %q\n", len(issues), blogJSON)
+			exit(1)
+		}
+		exit(0)
+	}
+
+	// handle option terminating case of refreshAll
+	if refreshAll {
+		fmt.Printf("Rebuilding %q from %q\n", blogJSON, prefixPath)
+		if err := meta.RefreshAll(prefixPath); err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		if err := meta.Save(blogJSON); err != nil {
+			fmt.Fprintf(app.Eout, "%s\n", err)
+			exit(1)
+		}
+		fmt.Printf("Refresh completed.\n")
+		if renderBlog {
+			render(app, meta, prefixPath)
+		}
+		exit(0)
+	}
 
 	// handle option terminating case of refreshBlog
 	if refreshBlog != "" {
@@ -239,15 +815,18 @@ func main() {
 			fmt.Printf("Refreshing (%d/%d) %q from %q\n", i+1, len(years), blogJSON, path.Join(prefixPath, year))
 			if err := meta.RefreshFromPath(prefixPath, year); err != nil {
 				fmt.Fprintf(app.Eout, "%s\n", err)
-				os.Exit(1)
+				exit(1)
 			}
 		}
 		if err := meta.Save(blogJSON); err != nil {
 			fmt.Fprintf(app.Eout, "%s\n", err)
-			os.Exit(1)
+			exit(1)
 		}
 		fmt.Printf("Refresh completed.\n")
-		os.Exit(0)
+		if renderBlog {
+			render(app, meta, prefixPath)
+		}
+		exit(0)
 	}
 
 	// We have a standard BlogIt command, process args.
@@ -256,41 +835,58 @@ func main() {
 		docName, dateString = args[0], time.Now().Format(mkpage.DateFmt)
 	case 2:
 		docName, dateString = args[0], args[1]
-		if _, err := time.Parse(mkpage.DateFmt, dateString); err != nil {
+		if _, err := mkpage.ParsePostDate(dateString); err != nil {
 			fmt.Fprintf(app.Eout, "Date error %q, %s", dateString, err)
-			os.Exit(1)
+			exit(1)
 		}
 	default:
 		if setName != "" || setQuip != "" || setDescription != "" ||
-			setBaseURL != "" || setIndexTmpl != "" || setPostTmpl != "" {
+			setBaseURL != "" || setIndexTmpl != "" || setPostTmpl != "" ||
+			setYearTmpl != "" || setMonthTmpl != "" || setDayTmpl != "" ||
+			archiveJSON || setTaxonomyTmpl != "" || setKeywordTmpl != "" ||
+			setCategoryTmpl != "" || setSeriesTmpl != "" || taxonomyJSON ||
+			setPageSize != 0 || setPagePattern != "" || setPermalink != "" ||
+			setBackups != 0 || setPeople != "" || setAuthorTmpl != "" ||
+			setAuthor != "" || setSkeleton != "" || setDraftsDir != "" {
 			if err := meta.Save(blogJSON); err != nil {
 				fmt.Fprintf(app.Eout, "%s\n", err)
-				os.Exit(1)
+				exit(1)
 			}
 			fmt.Printf("Updated blog.json completed.\n")
-			os.Exit(0)
+			if renderBlog {
+				render(app, meta, prefixPath)
+			}
+			exit(0)
+		}
+		if renderBlog {
+			render(app, meta, prefixPath)
+			exit(0)
 		}
 		app.Usage(app.Out)
-		os.Exit(1)
+		exit(1)
 	}
 	// Handle Copy Asset terminating case
 	if blogAsset {
 		fmt.Fprintf(app.Out, "Adding asset %q to posts for %q\n", docName, dateString)
 		if err := meta.BlogAsset(prefixPath, docName, dateString); err != nil {
 			fmt.Fprintf(app.Eout, "%s\n", err)
-			os.Exit(1)
+			exit(1)
 		}
-		os.Exit(0)
+		exit(0)
 	}
 
 	// Now blog it.
 	if err := meta.BlogIt(prefixPath, docName, dateString); err != nil {
 		fmt.Fprintf(app.Eout, "%s\n", err)
-		os.Exit(1)
+		exit(1)
 	}
 	if err := meta.Save(blogJSON); err != nil {
 		fmt.Fprintf(app.Eout, "%s\n", err)
-		os.Exit(1)
+		exit(1)
+	}
+	if renderBlog {
+		render(app, meta, prefixPath)
 	}
+	releaseLock()
 	cli.ExitOnError(app.Eout, err, quiet)
 }
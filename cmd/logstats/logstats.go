@@ -0,0 +1,178 @@
+//
+// logstats reports page views, referrers and 404s from access logs
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	// Caltech Library packages
+	"github.com/caltechlibrary/cli"
+	"github.com/caltechlibrary/mkpage"
+)
+
+var (
+	description = `
+%s reads access logs written by ws (text or JSON lines) or in
+Common/Combined Log Format and reports page views per path, top
+referrers, 404s, broken inbound links (404s referred by other sites)
+and user agent classes (browser, bot, feed reader, tool, other).
+If no log files are given the log is read from standard input.
+The report is written as Markdown (suitable for processing with
+mkpage) or JSON.
+
+Page views count successful GET requests for pages (paths ending
+in "/", ".html", ".htm", ".md" or without an extension) by user
+agents other than bots.
+`
+
+	examples = `
+Report on last month's production log as Markdown,
+
+    %s -from 2021-09-01 -to 2021-09-30 \
+        -site-hosts www.example.edu access.log >stats.md
+
+Report on a ws JSON log as JSON showing the top 10 of each list,
+
+    %s -json -top 10 ws-access.log
+`
+
+	// Standard options
+	showHelp         bool
+	showVersion      bool
+	showLicense      bool
+	showExamples     bool
+	outputFName      string
+	quiet            bool
+	generateMarkdown bool
+
+	// App options
+	fromDate   string
+	toDate     string
+	siteHosts  string
+	top        int
+	jsonOutput bool
+)
+
+func main() {
+	app := cli.NewCli(mkpage.Version)
+	appName := app.AppName()
+
+	// Document additional non-option parameters
+	app.SetParams(`[LOG_FILE ...]`)
+
+	// Add Help Docs
+	app.AddHelp("license", []byte(fmt.Sprintf(mkpage.LicenseText, appName, mkpage.Version)))
+	app.AddHelp("description", []byte(fmt.Sprintf(description, appName)))
+	app.AddHelp("examples", []byte(fmt.Sprintf(examples, appName, appName)))
+
+	// Setup options
+	app.BoolVar(&showHelp, "h,help", false, "display help")
+	app.BoolVar(&showLicense, "l,license", false, "display license")
+	app.BoolVar(&showVersion, "v,version", false, "display version")
+	app.BoolVar(&showExamples, "examples", false, "display example(s)")
+	app.StringVar(&outputFName, "o,output", "", "output filename")
+	app.BoolVar(&generateMarkdown, "generate-markdown", false, "generate markdown documentation")
+	app.BoolVar(&quiet, "quiet", false, "suppress error messages")
+
+	// App specific options
+	app.StringVar(&fromDate, "from", "", "Only count requests on or after this date (YYYY-MM-DD)")
+	app.StringVar(&toDate, "to", "", "Only count requests on or before this date (YYYY-MM-DD)")
+	app.StringVar(&siteHosts, "site-hosts", "", "A comma delimited list of your site's hostnames, their referrers are internal")
+	app.IntVar(&top, "top", 25, "Limit each list to this many entries, 0 for no limit")
+	app.BoolVar(&jsonOutput, "json", false, "Write the report as JSON instead of Markdown")
+
+	app.Parse()
+	args := app.Args()
+
+	// Setup IO
+	var err error
+	app.Eout = os.Stderr
+
+	app.Out, err = cli.Create(outputFName, os.Stdout)
+	cli.ExitOnError(app.Eout, err, quiet)
+	defer cli.CloseFile(outputFName, app.Out)
+
+	if generateMarkdown {
+		app.GenerateMarkdown(app.Out)
+		os.Exit(0)
+	}
+	if showHelp || showExamples {
+		if len(args) > 0 {
+			fmt.Fprintln(app.Out, app.Help(args...))
+		} else {
+			app.Usage(app.Out)
+		}
+		os.Exit(0)
+	}
+	if showVersion {
+		fmt.Fprintln(app.Out, app.Version())
+		os.Exit(0)
+	}
+	if showLicense {
+		fmt.Fprintln(app.Out, app.License())
+		os.Exit(0)
+	}
+
+	stats := mkpage.NewLogStats()
+	stats.Top = top
+	if siteHosts != "" {
+		for _, host := range strings.Split(siteHosts, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				stats.SiteHosts = append(stats.SiteHosts, host)
+			}
+		}
+	}
+	if fromDate != "" {
+		stats.From, err = time.ParseInLocation("2006-01-02", fromDate, time.Local)
+		cli.ExitOnError(app.Eout, err, quiet)
+	}
+	if toDate != "" {
+		stats.To, err = time.ParseInLocation("2006-01-02", toDate, time.Local)
+		cli.ExitOnError(app.Eout, err, quiet)
+		// Include the whole day
+		stats.To = stats.To.Add((24 * time.Hour) - time.Nanosecond)
+	}
+
+	if len(args) == 0 {
+		err = stats.ReadAccessLog(os.Stdin)
+		cli.ExitOnError(app.Eout, err, quiet)
+	}
+	for _, fName := range args {
+		fp, err := os.Open(fName)
+		cli.ExitOnError(app.Eout, err, quiet)
+		err = stats.ReadAccessLog(fp)
+		fp.Close()
+		if err != nil {
+			cli.ExitOnError(app.Eout, fmt.Errorf("Reading %q, %s", fName, err), quiet)
+		}
+	}
+
+	report := stats.Report()
+	if jsonOutput {
+		src, err := json.MarshalIndent(report, "", "    ")
+		cli.ExitOnError(app.Eout, err, quiet)
+		fmt.Fprintf(app.Out, "%s\n", src)
+	} else {
+		fmt.Fprint(app.Out, report.Markdown())
+	}
+}
@@ -20,7 +20,6 @@ package main
 
 import (
 	"encoding/json"
-	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -42,6 +41,12 @@ that the directory for HTDOCS is is the base directory containing
 subdirectories in the form of /YYYY/MM/DD/ARTICLE_HTML where 
 YYYY/MM/DD (Year, Month, Day) corresponds to the publication date 
 of ARTICLE_HTML.
+
+If HTDOCS contains a blog.json (see blogit) the feed is built from
+it. Draft posts, posts dated in the future and posts past their
+expires date are left out unless -drafts or -future are set.
+Items include their creators as dc:creator and, for creators with
+an email, as the item's author.
 `
 
 	examples = `
@@ -81,6 +86,8 @@ articles in htdocs/myblog/YYYY/MM/DD.
 	bylineExp          string
 	titleExp           string
 	dateExp            string
+	showDrafts         bool
+	showFuture         bool
 )
 
 func main() {
@@ -120,6 +127,8 @@ func main() {
 	app.StringVar(&dateExp, "d,date-format", mkpage.DateExp, "set date regexp")
 	app.StringVar(&titleExp, "t,title", mkpage.TitleExp, "set title regexp")
 	app.StringVar(&bylineExp, "b,byline", mkpage.BylineExp, "set byline regexp")
+	app.BoolVar(&showDrafts, "drafts", false, "include draft posts from blog.json, e.g. to preview a feed")
+	app.BoolVar(&showFuture, "future", false, "include posts from blog.json dated in the future")
 
 	app.Parse()
 	args := app.Args()
@@ -221,10 +230,11 @@ func main() {
 		rssPath = args[1]
 	}
 	blogJSON := path.Join(htdocs, "blog.json")
+	var blog *mkpage.BlogMeta
 	if _, err := os.Stat(blogJSON); os.IsNotExist(err) {
 		err = mkpage.WalkRSS(feed, htdocs, excludeList, titleExp, bylineExp, dateExp)
 	} else {
-		blog := new(mkpage.BlogMeta)
+		blog = new(mkpage.BlogMeta)
 		if src, err := ioutil.ReadFile(blogJSON); err != nil {
 			fmt.Fprintf(app.Eout, "Reading %q, %s\n", blogJSON, err)
 			os.Exit(1)
@@ -234,6 +244,8 @@ func main() {
 				os.Exit(1)
 			}
 		}
+		blog.Drafts = showDrafts
+		blog.Future = showFuture
 		err = mkpage.BlogMetaToRSS(blog, feed)
 	}
 	if err != nil {
@@ -242,7 +254,11 @@ func main() {
 	}
 
 	// Marshal RSS2 and render output
-	src, err := xml.MarshalIndent(feed, "", "    ")
+	creators := map[string][]string{}
+	if blog != nil {
+		creators = blog.PostCreators()
+	}
+	src, err := mkpage.MarshalRSS(feed, creators)
 	if err != nil {
 		fmt.Fprintf(app.Eout, "%s\n", err)
 		os.Exit(1)
@@ -39,7 +39,13 @@ type locInfo struct {
 
 var (
 	description = `
-%s generates a sitemap for the website.
+%s generates a sitemap for the website. Dot paths (e.g. .git)
+are left out except those matching -allow-paths (default /.well-known),
+paths matching -deny-paths are also left out. These are the same
+rules ws uses when serving the site.
+
+Blogs managed with blogit (a directory with a blog.json) have
+their draft, pending and expired posts left out.
 `
 
 	examples = `
@@ -60,6 +66,8 @@ var (
 	siteURL      string
 	excludeList  string
 	sitemapFName string
+	allowPaths   string
+	denyPaths    string
 
 	changefreq string
 	locList    []*locInfo
@@ -103,6 +111,8 @@ func main() {
 	app.EnvStringVar(&htdocs, "MKPAGE_DOCROOT", "", "set the document root, defaults to current working directory")
 	app.EnvStringVar(&siteURL, "MKPAGE_SITEURL", "", "set the site url")
 	app.EnvStringVar(&sitemapFName, "MKPAGE_SITEMAP", "", "set the sitemap filename and path")
+	app.EnvStringVar(&allowPaths, "MKPAGE_ALLOW_PATHS", "", "set the dot path patterns to list, defaults to /.well-known")
+	app.EnvStringVar(&denyPaths, "MKPAGE_DENY_PATHS", "", "set the path patterns to leave out")
 
 	// Setup options
 	app.BoolVar(&showHelp, "h,help", false, "display help")
@@ -119,6 +129,8 @@ func main() {
 	app.StringVar(&sitemapFName, "sitemap", "", "set the sitemap filename and path")
 	app.StringVar(&changefreq, "update,update-frequency", "daily", "Set the change frequencely value, e.g. daily, weekly, monthly")
 	app.StringVar(&excludeList, "exclude", "", "A colon delimited list of path parts to exclude from sitemap")
+	app.StringVar(&allowPaths, "allow-paths", "", "A comma delimited list of dot path patterns to list, defaults to /.well-known")
+	app.StringVar(&denyPaths, "deny-paths", "", "A comma delimited list of path patterns to leave out, e.g. *.bak,/drafts")
 
 	// Setup IO
 	var err error
@@ -192,8 +204,56 @@ func main() {
 
 	excludeDirs := ExcludeList(strings.Split(excludeList, ":"))
 
+	// Apply the same dot path rules as ws
+	if allowPaths == "" {
+		allowPaths = app.Getenv("MKPAGE_ALLOW_PATHS")
+	}
+	if denyPaths == "" {
+		denyPaths = app.Getenv("MKPAGE_DENY_PATHS")
+	}
+	pathPolicy := &mkpage.PathPolicy{
+		Allow: mkpage.DefaultPathAllow,
+		Deny:  mkpage.ParsePathList(denyPaths),
+	}
+	if allowPaths != "" {
+		pathPolicy.Allow = mkpage.ParsePathList(allowPaths)
+	}
+
+	// Find the unpublished blog posts to leave out
+	hiddenPages := map[string]bool{}
+	filepath.Walk(htdocs, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || info.Name() != "blog.json" {
+			return nil
+		}
+		meta := new(mkpage.BlogMeta)
+		if err := mkpage.LoadBlogMeta(p, meta); err != nil {
+			log.Printf("Skipping %q, %s", p, err)
+			return nil
+		}
+		for _, page := range meta.HiddenPages(filepath.ToSlash(htdocs)) {
+			hiddenPages[page] = true
+		}
+		return nil
+	})
+
 	log.Printf("Starting map of %s\n", htdocs)
 	filepath.Walk(htdocs, func(p string, info os.FileInfo, err error) error {
+		rel, e := filepath.Rel(htdocs, p)
+		if e != nil {
+			rel = strings.TrimPrefix(p, htdocs)
+		}
+		rel = filepath.ToSlash(rel)
+		if err == nil && pathPolicy.IsDotPath(rel) {
+			log.Printf("Skipping %q", p)
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if hiddenPages[filepath.ToSlash(p)] {
+			log.Printf("Skipping unpublished %q", p)
+			return nil
+		}
 		if strings.HasSuffix(p, ".html") {
 			fname := path.Base(p)
 			//NOTE: You can skip the eror pages, and excluded directories in the sitemap
@@ -201,7 +261,7 @@ func main() {
 				finfo := new(locInfo)
 				//FIXME: should use the parsed URL and append to path
 				page, _ := url.Parse(site.String())
-				page.Path = path.Join(page.Path, strings.TrimPrefix(p, htdocs))
+				page.Path = path.Join(page.Path, rel)
 				finfo.Loc = page.String()
 				yr, mn, dy := info.ModTime().Date()
 				finfo.LastMod = fmt.Sprintf("%d-%0.2d-%0.2d", yr, mn, dy)
@@ -20,20 +20,22 @@ package main
 
 import (
 	"bytes"
-	"encoding/csv"
+	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"strings"
+	"syscall"
+	"time"
 
 	// Caltech Library packages
 	"github.com/caltechlibrary/cli"
 	"github.com/caltechlibrary/mkpage"
-	"github.com/caltechlibrary/wsfn"
 )
 
 // Flag options
@@ -56,6 +58,105 @@ Run web server using the content in the current directory
 Run web server using a specified directory
 
    %s /www/htdocs
+
+Serve precompressed .gz/.br siblings and compress other text
+responses on the fly
+
+   %s -serve-precompressed -compress /www/htdocs
+
+Write gzip siblings for a whole htdocs tree (e.g. as a build step)
+
+   %s -precompress /www/htdocs
+
+Add strong ETags, mark fingerprinted assets (e.g. app.3f2a9c1b.js)
+immutable and require revalidation of everything else
+
+   %s -etags -immutable -cache-control "no-cache" /www/htdocs
+
+Map extensions to MIME types and glob patterns to Cache-Control
+policies with a JSON file
+
+   %s -cache-config cache.json /www/htdocs
+
+Where cache.json looks like
+
+    {
+        "mime_types": { ".mjs": "text/javascript" },
+        "cache_control": [
+            { "pattern": "*.html", "cache_control": "no-cache" },
+            { "pattern": "/assets/*", "cache_control": "public, max-age=3600" }
+        ],
+        "etags": true,
+        "immutable": true
+    }
+
+Add the security headers preset (a five minute HSTS when serving
+https, X-Content-Type-Options, Referrer-Policy, Permissions-Policy) and
+try out a Content-Security-Policy in report only mode. Violations
+reported by the browser are logged by %s.
+
+   %s -security-headers -csp-report-only \
+      -csp "default-src 'self'; img-src 'self' data:" /www/htdocs
+
+Serve https without providing a key and cert. %s creates a local CA
+and a certificate for localhost, 127.0.0.1, the -vhost hostnames
+and any hostnames listed with -tls-hosts. Trust the CA (ca.pem in
+the -tls-cache directory) in your browser once. Plain http requests
+to port 8000 are redirected (temporarily) to https.
+
+   %s -u https://localhost:8443 -tls-hosts blog.localhost \
+      -redirect-http localhost:8000 /www/htdocs
+
+Forward requests under /api/ to a local JSON API service (e.g.
+/api/items is forwarded to http://localhost:9000/items). Other
+paths are served from the document root.
+
+   %s -proxy /api/=http://localhost:9000/ /www/htdocs
+
+Preview several sites and a shared asset tree together. Requests are
+routed by Host header then by the longest matching path prefix. Each
+mount or virtual host can have its own CORS origin and redirects CSV
+(whose paths include the mount prefix), separated by semicolons.
+-mount, -vhost and -proxy can be repeated.
+
+   %s -mount "/shared=./assets;cors-origin=*" -mount /docs=./manual \
+      -vhost "blog.localhost=./blog/htdocs;redirects-csv=blog-redirects.csv" \
+      -vhost wiki.localhost=./wiki/htdocs /www/htdocs
+
+Write a Combined Log Format access log to a file, rotating it every
+50 megabytes and keeping 10 old logs (access.log.1 ... access.log.10).
+Use -log-format json for one JSON object per line or -log-file - to
+write the log to stdout.
+
+   %s -log-format combined -log-file access.log \
+      -log-max-size 50 -log-max-backups 10 /www/htdocs
+
+Run as a preview server in a container. Health checks and Prometheus
+metrics are served on a separate admin address. On SIGINT or SIGTERM
+in-flight requests are given up to 20 seconds to finish.
+
+   %s -u http://0.0.0.0:8000 -admin 0.0.0.0:9090 \
+      -shutdown-timeout 20s /www/htdocs
+
+Capture a preview setup in a file committed with the site. Settings
+use the option names with underscores (e.g. cors_origin, redirects_csv,
+ssl_key, ssl_cert). Lists such as mounts, proxy and tls_hosts are
+arrays. Environment variables named MKPAGE_ followed by the setting in
+upper case (e.g. MKPAGE_DOCROOT, MKPAGE_CORS_ORIGIN) override the file
+and options on the command line override both. The url is set with
+MKPAGE_SITEURL, the same variable sitemapper uses. Use -dump-config to
+see the effective configuration.
+
+   %s -dump-config -u http://localhost:8000 -cors-origin "*" \
+      -redirects-csv redirects.csv htdocs >ws.yaml
+   %s -config ws.yaml
+
+Dot paths (e.g. /.git/config) are forbidden except /.well-known/.
+Serve /.well-known/ and /.nojekyll but refuse backup files and
+anything under /drafts/.
+
+   %s -allow-paths /.well-known,/.nojekyll \
+      -deny-paths "*.bak,/drafts" /www/htdocs
 `
 
 	// Standard options
@@ -74,8 +175,95 @@ Run web server using a specified directory
 	sslCert      string
 	CORSOrigin   string
 	redirectsCSV string
+
+	// compression options
+	compressOnTheFly   bool
+	servePrecompressed bool
+	compressMinSize    int
+	precompress        bool
+
+	// caching options
+	cacheConfigFName string
+	mimeTypes        string
+	cacheControl     string
+	useETags         bool
+	markImmutable    bool
+
+	// security header options
+	securityHeaders   bool
+	csp               string
+	cspReportOnly     bool
+	cspReportPath     string
+	referrerPolicy    string
+	permissionsPolicy string
+
+	// local TLS options
+	tlsCacheDir  string
+	tlsHosts     string
+	redirectHTTP string
+
+	// proxy options
+	proxyMounts listFlag
+
+	// mount and virtual host options
+	mounts listFlag
+	vhosts listFlag
+
+	// access log options
+	logFormat     string
+	logFile       string
+	logMaxSize    int
+	logMaxBackups int
+
+	// server options
+	adminAddr       string
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	idleTimeout     time.Duration
+	shutdownTimeout time.Duration
+
+	// path policy options
+	allowPaths string
+	denyPaths  string
+
+	// configuration options
+	configFName string
+	dumpConfig  bool
 )
 
+// listFlag is an option that can be repeated, each use adds to the
+// list. A comma delimited value adds each of its items.
+type listFlag []string
+
+// String returns the list as a comma delimited string
+func (list *listFlag) String() string {
+	return strings.Join(*list, ",")
+}
+
+// Set appends the comma delimited items in s to the list
+func (list *listFlag) Set(s string) error {
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*list = append(*list, item)
+		}
+	}
+	return nil
+}
+
+// listVar registers a repeatable option and documents it in app's help
+func listVar(app *cli.Cli, list *listFlag, name string, usage string) {
+	app.Options()["-"+name] = usage
+	flag.Var(list, name, usage)
+}
+
+// flagAliases maps short option names to the names used by WSSettings
+var flagAliases = map[string]string{
+	"d": "docs",
+	"u": "url",
+	"k": "key",
+	"c": "cert",
+}
+
 func logRequest(r *http.Request) {
 	log.Printf("Request: %s Path: %s RemoteAddr: %s UserAgent: %s\n", r.Method, r.URL.Path, r.RemoteAddr, r.UserAgent())
 }
@@ -97,7 +285,7 @@ func main() {
 	// Add Help Docs
 	app.AddHelp("license", []byte(fmt.Sprintf(mkpage.LicenseText, appName, mkpage.Version)))
 	app.AddHelp("description", []byte(fmt.Sprintf(description, appName)))
-	app.AddHelp("examples", []byte(fmt.Sprintf(examples, appName, appName)))
+	app.AddHelp("examples", []byte(fmt.Sprintf(examples, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName, appName)))
 
 	defaultDocRoot := "."
 	defaultURL := "http://localhost:8000"
@@ -114,12 +302,55 @@ func main() {
 	app.BoolVar(&quiet, "quiet", false, "suppress error messages")
 
 	// Application Options
+	app.StringVar(&configFName, "config", "", "Read settings from a YAML, TOML or JSON file")
+	app.BoolVar(&dumpConfig, "dump-config", false, "Display the effective configuration and exit")
 	app.StringVar(&docRoot, "d,docs", defaultDocRoot, "Set the htdocs path")
 	app.StringVar(&uri, "u,url", defaultURL, "The protocol and hostname listen for as a URL")
 	app.StringVar(&sslKey, "k,key", "", "Set the path for the SSL Key")
 	app.StringVar(&sslCert, "c,cert", "", "Set the path for the SSL Cert")
 	app.StringVar(&CORSOrigin, "cors-origin", "*", "Set the CORS Origin Policy to a specific host or *")
 	app.StringVar(&redirectsCSV, "redirects-csv", "", "Use target,destination replacement paths defined in CSV file")
+	app.BoolVar(&compressOnTheFly, "compress", false, "gzip text responses on the fly when the client accepts it")
+	app.BoolVar(&servePrecompressed, "serve-precompressed", false, "serve file.br and file.gz siblings when the client accepts them")
+	app.IntVar(&compressMinSize, "compress-min-size", mkpage.DefaultCompressMinSize, "Set the minimum response size in bytes to compress")
+	app.BoolVar(&precompress, "precompress", false, "write gzip siblings for compressible files in DOCROOT and exit")
+	app.StringVar(&cacheConfigFName, "cache-config", "", "Read MIME types and Cache-Control policies from a JSON file")
+	app.StringVar(&mimeTypes, "mime-types", "", "A comma delimited list of EXT=MIME_TYPE, e.g. .mjs=text/javascript")
+	app.StringVar(&cacheControl, "cache-control", "", "Set the default Cache-Control header value")
+	app.BoolVar(&useETags, "etags", false, "Set strong ETags based on file content")
+	app.BoolVar(&markImmutable, "immutable", false, "Mark fingerprinted assets (e.g. app.3f2a9c1b.js) as immutable")
+	app.BoolVar(&securityHeaders, "security-headers", false, "Add the security headers preset (HSTS, X-Content-Type-Options, Referrer-Policy, Permissions-Policy)")
+	app.StringVar(&csp, "csp", "", "Set the Content-Security-Policy")
+	app.BoolVar(&cspReportOnly, "csp-report-only", false, "Send the CSP as Content-Security-Policy-Report-Only and log violations")
+	app.StringVar(&cspReportPath, "csp-report-path", mkpage.DefaultCSPReportPath, "Set the path violation reports are posted to")
+	app.StringVar(&referrerPolicy, "referrer-policy", "", "Set the Referrer-Policy")
+	app.StringVar(&permissionsPolicy, "permissions-policy", "", "Set the Permissions-Policy")
+	app.StringVar(&tlsCacheDir, "tls-cache", "", "Set the directory for the generated local CA and certificate (default is your cache directory)")
+	app.StringVar(&tlsHosts, "tls-hosts", "", "A comma delimited list of additional hostnames for the generated certificate")
+	app.StringVar(&redirectHTTP, "redirect-http", "", "Listen on this address (e.g. localhost:8000) and redirect http to https")
+	listVar(app, &mounts, "mount", "Add a PREFIX=DIR document root mount, e.g. /shared=./assets (repeatable)")
+	listVar(app, &vhosts, "vhost", "Add a HOST=DIR virtual host, e.g. blog.localhost=./blog/htdocs (repeatable)")
+	listVar(app, &proxyMounts, "proxy", "Add a PREFIX=URL proxy mount, e.g. /api/=http://localhost:9000/ (repeatable)")
+	app.StringVar(&logFormat, "log-format", mkpage.LogFormatText, "Set the access log format, one of "+mkpage.AccessLogFormats())
+	app.StringVar(&logFile, "log-file", "", "Write the access log to a file (rotated by size), use - for stdout")
+	app.IntVar(&logMaxSize, "log-max-size", 10, "Rotate the access log file after this many megabytes")
+	app.IntVar(&logMaxBackups, "log-max-backups", 5, "Keep this many rotated access log files")
+	app.StringVar(&allowPaths, "allow-paths", strings.Join(mkpage.DefaultPathAllow, ","), "A comma delimited list of dot path patterns to serve, e.g. /.well-known")
+	app.StringVar(&denyPaths, "deny-paths", "", "A comma delimited list of path patterns to refuse, e.g. *.bak,/drafts")
+	app.StringVar(&adminAddr, "admin", "", "Serve /healthz and Prometheus /metrics on this address (e.g. localhost:9090)")
+	app.DurationVar(&readTimeout, "read-timeout", mkpage.DefaultReadTimeout, "Set the time allowed to read a request, 0 for none")
+	app.DurationVar(&writeTimeout, "write-timeout", mkpage.DefaultWriteTimeout, "Set the time allowed to write a response, 0 (the default) for none, proxied responses are exempt")
+	app.DurationVar(&idleTimeout, "idle-timeout", mkpage.DefaultIdleTimeout, "Set the time keep-alive connections may be idle, 0 for none")
+	app.DurationVar(&shutdownTimeout, "shutdown-timeout", mkpage.DefaultShutdownTimeout, "Set the time in-flight requests have to finish on SIGINT or SIGTERM")
+
+	// Document the MKPAGE_ environment variables from the options
+	// they set, they are applied with the configuration file below
+	for _, setting := range mkpage.WSSettings {
+		if f := flag.Lookup(setting.Flag); f != nil {
+			var envValue string
+			app.EnvStringVar(&envValue, mkpage.WSEnvName(setting.Key), "", f.Usage)
+		}
+	}
 
 	app.Parse()
 	args := app.Args()
@@ -155,11 +386,62 @@ func main() {
 		os.Exit(0)
 	}
 
+	// Apply settings from the configuration file then the environment,
+	// options given on the command line take precedence over both.
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		if name, ok := flagAliases[f.Name]; ok {
+			explicit[name] = true
+		} else {
+			explicit[f.Name] = true
+		}
+	})
+	settings := map[string]string{}
+	if configFName != "" {
+		cfg, err := mkpage.LoadWSConfig(configFName)
+		cli.ExitOnError(app.Eout, err, quiet)
+		for name, val := range cfg.FlagValues() {
+			settings[name] = val
+		}
+	}
+	for name, val := range mkpage.EnvFlagValues(os.Getenv) {
+		settings[name] = val
+	}
+	for name, val := range settings {
+		if explicit[name] == false {
+			if err := flag.Set(name, val); err != nil {
+				cli.ExitOnError(app.Eout, fmt.Errorf("Setting %s to %q, %s", name, val, err), quiet)
+			}
+		}
+	}
+
 	// setup from command line
 	if len(args) > 0 {
 		docRoot = args[0]
 	}
 
+	if dumpConfig {
+		cfg := mkpage.WSConfigFromFlags(func(name string) string {
+			if f := flag.Lookup(name); f != nil {
+				return f.Value.String()
+			}
+			return ""
+		})
+		cfg.DocRoot = docRoot
+		src, err := cfg.EncodeFor(configFName)
+		cli.ExitOnError(app.Eout, err, quiet)
+		fmt.Fprintf(app.Out, "%s\n", bytes.TrimSpace(src))
+		os.Exit(0)
+	}
+
+	// Handle the precompress build step, then exit
+	if precompress {
+		log.Printf("Precompressing %s", docRoot)
+		err = mkpage.Precompress(docRoot, compressMinSize, true)
+		cli.ExitOnError(app.Eout, err, quiet)
+		os.Exit(0)
+	}
+
 	log.Printf("DocRoot %s", docRoot)
 
 	u, err := url.Parse(uri)
@@ -167,71 +449,215 @@ func main() {
 		cli.ExitOnError(app.Eout, err, quiet)
 	}
 
+	// Setup the default site, mounts and virtual hosts
+	sites := []*mkpage.Site{
+		{
+			Prefix:       "/",
+			DocRoot:      docRoot,
+			CORSOrigin:   CORSOrigin,
+			RedirectsCSV: redirectsCSV,
+		},
+	}
+	for _, item := range []struct {
+		specs   listFlag
+		isVHost bool
+	}{{mounts, false}, {vhosts, true}} {
+		for _, spec := range item.specs {
+			site, err := mkpage.ParseSite(spec, item.isVHost)
+			if err != nil {
+				log.Fatal(err)
+			}
+			if site.CORSOrigin == "" {
+				site.CORSOrigin = CORSOrigin
+			}
+			sites = append(sites, site)
+		}
+	}
+
 	if u.Scheme == "https" {
+		if sslKey == "" && sslCert == "" {
+			if tlsCacheDir == "" {
+				tlsCacheDir = mkpage.DefaultTLSCacheDir()
+			}
+			hosts := append([]string{u.Hostname()}, strings.Split(tlsHosts, ",")...)
+			for _, site := range sites {
+				hosts = append(hosts, site.Host)
+			}
+			hostnames := mkpage.TLSHostnames(hosts...)
+			var fingerprint string
+			sslCert, sslKey, fingerprint, err = mkpage.EnsureLocalCert(tlsCacheDir, hostnames)
+			if err != nil {
+				log.Fatalf("Can't generate a local certificate, %s", err)
+			}
+			log.Printf("Local CA %s", path.Join(tlsCacheDir, mkpage.LocalCACert))
+			log.Printf("Certificate for %s", strings.Join(hostnames, ", "))
+			log.Printf("SHA-256 Fingerprint %s", fingerprint)
+		}
 		log.Printf("SSL Key %s", sslKey)
 		log.Printf("SSL Cert %s", sslCert)
+		if redirectHTTP != "" {
+			log.Printf("Redirecting http://%s to https", redirectHTTP)
+		}
 	}
 	log.Printf("Listening for %s", uri)
-	cors := wsfn.CORSPolicy{
-		Origin: CORSOrigin,
+	// Setup MIME types and caching policy
+	if err := mkpage.RegisterMimeTypes(mkpage.DefaultMimeTypes); err != nil {
+		log.Fatal(err)
 	}
-	// Setup redirects defined the redirects CSV
-	var rService *wsfn.RedirectService
-	if redirectsCSV != "" {
-		src, err := ioutil.ReadFile(redirectsCSV)
+	cacheCfg := new(mkpage.CacheConfig)
+	if cacheConfigFName != "" {
+		cacheCfg, err = mkpage.LoadCacheConfig(cacheConfigFName)
 		if err != nil {
-			log.Fatalf("Can't read %s, %s", redirectsCSV, err)
-		}
-		r := csv.NewReader(bytes.NewReader(src))
-		// Allow support for comment rows
-		r.Comment = '#'
-		// Make a redirect map[string]string
-		rmap := map[string]string{}
-		for {
-			row, err := r.Read()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				log.Fatalf("Can't read %s, %s", redirectsCSV, err)
-			}
-			if len(row) == 2 {
-				// Define direct here.
-				target := ""
-				destination := ""
-				if strings.HasPrefix(row[0], "/") {
-					target = row[0]
-				} else {
-					target = "/" + row[0]
-				}
-				if strings.HasPrefix(row[1], "/") {
-					destination = row[1]
-				} else {
-					destination = "/" + row[1]
-				}
-				rmap[target] = destination
+			log.Fatal(err)
+		}
+	}
+	cacheCfg.DocRoot = docRoot
+	if cacheCfg.MimeTypes == nil {
+		cacheCfg.MimeTypes = map[string]string{}
+	}
+	if mimeTypes != "" {
+		for _, item := range strings.Split(mimeTypes, ",") {
+			parts := strings.SplitN(strings.TrimSpace(item), "=", 2)
+			if len(parts) != 2 {
+				log.Fatalf("Can't parse MIME type %q, expected EXT=MIME_TYPE", item)
 			}
+			cacheCfg.MimeTypes[parts[0]] = parts[1]
 		}
-		rService, err = wsfn.MakeRedirectService(rmap)
+	}
+	if err := mkpage.RegisterMimeTypes(cacheCfg.MimeTypes); err != nil {
+		log.Fatal(err)
+	}
+	if cacheControl != "" {
+		cacheCfg.DefaultCacheControl = cacheControl
+	}
+	if useETags {
+		cacheCfg.ETags = true
+	}
+	if markImmutable {
+		cacheCfg.Immutable = true
+	}
+
+	// Setup which paths are served
+	mkpage.DefaultPathPolicy = &mkpage.PathPolicy{
+		Allow: mkpage.ParsePathList(allowPaths),
+		Deny:  mkpage.ParsePathList(denyPaths),
+	}
+
+	// Setup security headers
+	var secHeaders *mkpage.SecurityHeaders
+	if securityHeaders {
+		secHeaders = mkpage.DefaultSecurityHeaders()
+	}
+	if cspReportOnly && csp == "" {
+		cli.ExitOnError(app.Eout, fmt.Errorf("-csp-report-only requires a policy, set with -csp"), quiet)
+	}
+	if csp != "" || referrerPolicy != "" || permissionsPolicy != "" {
+		if secHeaders == nil {
+			secHeaders = new(mkpage.SecurityHeaders)
+		}
+		if csp != "" {
+			secHeaders.ContentSecurityPolicy = csp
+			secHeaders.CSPReportOnly = cspReportOnly
+			secHeaders.CSPReportPath = cspReportPath
+		}
+		if referrerPolicy != "" {
+			secHeaders.ReferrerPolicy = referrerPolicy
+		}
+		if permissionsPolicy != "" {
+			secHeaders.PermissionsPolicy = permissionsPolicy
+		}
+	}
+	if secHeaders != nil && secHeaders.CSPReportOnly {
+		log.Printf("Logging CSP violations posted to %s", secHeaders.CSPReportPath)
+	}
+
+	compression := &mkpage.Compression{
+		Precompressed: servePrecompressed,
+		OnTheFly:      compressOnTheFly,
+		MinSize:       compressMinSize,
+	}
+	// wrapFileServer applies caching and compression per document root
+	wrapFileServer := func(dName string, next http.Handler) http.Handler {
+		siteCompression := *compression
+		siteCompression.DocRoot = dName
+		return cacheCfg.ForDocRoot(dName).Handler(siteCompression.Handler(next))
+	}
+
+	siteRouter := new(mkpage.SiteRouter)
+	for _, site := range sites {
+		if err := siteRouter.AddSite(site, wrapFileServer); err != nil {
+			log.Fatal(err)
+		}
+		if site.Host != "" {
+			log.Printf("Virtual host %s serving %s", site.Host, site.DocRoot)
+		} else if site.Prefix != "/" {
+			log.Printf("Mount %s serving %s", site.Prefix, site.DocRoot)
+		}
+	}
+
+	// Setup proxy mounts, these are checked before StaticRouter so
+	// only local files are subject to the dot path checks.
+	pService := new(mkpage.ProxyService)
+	for _, mount := range proxyMounts {
+		prefix, target, err := mkpage.ParseProxyMount(mount)
 		if err != nil {
-			log.Fatalf("Can't make redirect service, %s", err)
+			log.Fatal(err)
+		}
+		if err := pService.AddProxyRoute(prefix, target); err != nil {
+			log.Fatalf("Can't add proxy mount, %s", err)
 		}
+		log.Printf("Proxy %s to %s", prefix, target)
+	}
+
+	// Setup our access log
+	var logOut io.Writer
+	switch logFile {
+	case "":
+		// use the standard logger
+	case "-":
+		logOut = os.Stdout
+	default:
+		rf, err := mkpage.OpenRotatingFile(logFile, int64(logMaxSize)*1024*1024, logMaxBackups)
+		cli.ExitOnError(app.Eout, err, quiet)
+		defer rf.Close()
+		logOut = rf
+		log.Printf("Access log %s (%s)", logFile, logFormat)
 	}
-	http.Handle("/", cors.Handler(http.FileServer(http.Dir(docRoot))))
+	accessLog, err := mkpage.NewAccessLogger(logFormat, logOut)
+	cli.ExitOnError(app.Eout, err, quiet)
 
+	// Assemble our handlers
+	handler := accessLog.Handler(pService.ProxyRouter(mkpage.PreflightRouter(mkpage.StaticRouter(secHeaders.Handler(siteRouter)))))
+
+	servers := []*mkpage.GracefulServer{}
+	if adminAddr != "" {
+		metrics := mkpage.NewMetrics()
+		handler = metrics.Handler(handler)
+		log.Printf("Admin http://%s/healthz and /metrics", adminAddr)
+		servers = append(servers, &mkpage.GracefulServer{
+			Server: mkpage.NewServer(adminAddr, mkpage.AdminHandler(metrics), readTimeout, writeTimeout, idleTimeout),
+		})
+	}
 	if u.Scheme == "https" {
-		if rService != nil {
-			err = http.ListenAndServeTLS(u.Host, sslCert, sslKey, wsfn.RequestLogger(wsfn.StaticRouter(rService.RedirectRouter(http.DefaultServeMux))))
-		} else {
-			err = http.ListenAndServeTLS(u.Host, sslCert, sslKey, wsfn.RequestLogger(wsfn.StaticRouter(http.DefaultServeMux)))
+		servers = append(servers, &mkpage.GracefulServer{
+			Server:   mkpage.NewServer(u.Host, handler, readTimeout, writeTimeout, idleTimeout),
+			CertFile: sslCert,
+			KeyFile:  sslKey,
+		})
+		if redirectHTTP != "" {
+			servers = append(servers, &mkpage.GracefulServer{
+				Server: mkpage.NewServer(redirectHTTP, mkpage.HTTPSRedirectHandler(u), readTimeout, writeTimeout, idleTimeout),
+			})
 		}
-		cli.ExitOnError(app.Eout, err, quiet)
 	} else {
-		if rService != nil {
-			err = http.ListenAndServe(u.Host, wsfn.RequestLogger(wsfn.StaticRouter(rService.RedirectRouter(http.DefaultServeMux))))
-		} else {
-			err = http.ListenAndServe(u.Host, wsfn.RequestLogger(wsfn.StaticRouter(http.DefaultServeMux)))
-		}
-		cli.ExitOnError(app.Eout, err, quiet)
+		servers = append(servers, &mkpage.GracefulServer{
+			Server: mkpage.NewServer(u.Host, handler, readTimeout, writeTimeout, idleTimeout),
+		})
 	}
+
+	// Shutdown gracefully on SIGINT and SIGTERM
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	err = mkpage.ServeGracefully(shutdownTimeout, stop, servers...)
+	cli.ExitOnError(app.Eout, err, quiet)
 }
@@ -0,0 +1,399 @@
+//
+// Package mkpage compress.go provides Accept-Encoding negotiation for ws.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultCompressMinSize is the smallest response body (in bytes)
+	// ws will compress on the fly.
+	DefaultCompressMinSize = 1024
+)
+
+var (
+	// CompressibleTypes lists the content type prefixes that are
+	// worth compressing. Images, audio and video are already compressed.
+	CompressibleTypes = []string{
+		"text/",
+		"application/javascript",
+		"application/json",
+		"application/ld+json",
+		"application/manifest+json",
+		"application/rss+xml",
+		"application/atom+xml",
+		"application/xml",
+		"application/wasm",
+		"image/svg+xml",
+	}
+
+	// precompressedEncodings maps a content coding to the sibling
+	// file extension in order of preference.
+	precompressedEncodings = []struct {
+		Coding string
+		Ext    string
+	}{
+		{"br", ".br"},
+		{"gzip", ".gz"},
+	}
+)
+
+// Compression holds the settings ws uses to negotiate Accept-Encoding.
+type Compression struct {
+	// DocRoot is where we look for precompressed siblings (e.g.
+	// index.html.gz, site.css.br)
+	DocRoot string `json:"docroot,omitempty"`
+	// Precompressed turns on serving file.br/file.gz siblings
+	Precompressed bool `json:"precompressed,omitempty"`
+	// OnTheFly turns on gzip compression of text responses
+	OnTheFly bool `json:"on_the_fly,omitempty"`
+	// MinSize is the threshold in bytes before compressing on the fly
+	MinSize int `json:"min_size,omitempty"`
+}
+
+// IsCompressibleType returns true if the content type is in
+// CompressibleTypes.
+func IsCompressibleType(contentType string) bool {
+	if i := strings.Index(contentType, ";"); i > -1 {
+		contentType = contentType[0:i]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	for _, prefix := range CompressibleTypes {
+		if strings.HasPrefix(contentType, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsEncoding checks an Accept-Encoding header for coding
+// honoring a q=0 refusal.
+func acceptsEncoding(header string, coding string) bool {
+	wildcard := false
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if val, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+					q = val
+				}
+			}
+		}
+		switch name {
+		case coding:
+			return q > 0
+		case "*":
+			wildcard = q > 0
+		}
+	}
+	return wildcard
+}
+
+// addVary adds Accept-Encoding to the Vary header if not present.
+func addVary(h http.Header) {
+	for _, val := range h.Values("Vary") {
+		for _, field := range strings.Split(val, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, "Accept-Encoding") {
+				return
+			}
+		}
+	}
+	h.Add("Vary", "Accept-Encoding")
+}
+
+// servePrecompressed looks for a .br or .gz sibling of the requested
+// file and serves it if the client accepts that content coding. The
+// file itself must exist, a sibling left behind isn't served. It
+// returns true if the request was handled.
+func (c *Compression) servePrecompressed(w http.ResponseWriter, r *http.Request) bool {
+	p := r.URL.Path
+	if strings.HasSuffix(p, "/index.html") {
+		// Let http.FileServer handle its index.html redirect
+		return false
+	}
+	if strings.HasSuffix(p, "/") {
+		p = p + "index.html"
+	}
+	fs := http.Dir(c.DocRoot)
+	fp, err := fs.Open(p)
+	if err != nil {
+		return false
+	}
+	info, err := fp.Stat()
+	fp.Close()
+	if err != nil || info.IsDir() {
+		return false
+	}
+	accept := r.Header.Get("Accept-Encoding")
+	for _, enc := range precompressedEncodings {
+		fp, err := fs.Open(p + enc.Ext)
+		if err != nil {
+			continue
+		}
+		info, err := fp.Stat()
+		if err != nil || info.IsDir() {
+			fp.Close()
+			continue
+		}
+		if acceptsEncoding(accept, enc.Coding) == false {
+			fp.Close()
+			continue
+		}
+		defer fp.Close()
+		contentType := mime.TypeByExtension(path.Ext(p))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h := w.Header()
+		h.Set("Content-Type", contentType)
+		h.Set("Content-Encoding", enc.Coding)
+		if etag := h.Get("ETag"); etag != "" {
+			// Each encoding is a distinct representation so needs
+			// its own ETag.
+			h.Set("ETag", strings.TrimSuffix(etag, `"`)+"-"+enc.Coding+`"`)
+		}
+		http.ServeContent(w, r, path.Base(p), info.ModTime(), fp)
+		return true
+	}
+	return false
+}
+
+// Handler accepts an http.Handler and returns a http.Handler. It
+// negotiates the Accept-Encoding of the request serving precompressed
+// siblings when available or compressing text responses on the fly.
+// Range requests are always passed through uncompressed.
+func (c *Compression) Handler(next http.Handler) http.Handler {
+	if c == nil || (c.Precompressed == false && c.OnTheFly == false) {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		// NOTE: the response varies on Accept-Encoding even when it
+		// is uncompressed, e.g. a range, a 304 or a HEAD.
+		addVary(w.Header())
+		if r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if c.Precompressed && c.servePrecompressed(w, r) {
+			return
+		}
+		if c.OnTheFly == false || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressResponseWriter{
+			ResponseWriter: w,
+			minSize:        c.MinSize,
+			gzipOK:         acceptsEncoding(r.Header.Get("Accept-Encoding"), "gzip"),
+		}
+		defer cw.Close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressResponseWriter buffers the start of a response until it
+// can decide if the body is worth compressing.
+type compressResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+	gzipOK  bool
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+// WriteHeader holds onto the status until we know the encoding
+func (cw *compressResponseWriter) WriteHeader(status int) {
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	cw.status = status
+	if status != http.StatusOK {
+		cw.decide(false)
+	}
+}
+
+// Write buffers until minSize is reached then decides on the encoding
+func (cw *compressResponseWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if cw.decided {
+		if cw.gz != nil {
+			return cw.gz.Write(p)
+		}
+		return cw.ResponseWriter.Write(p)
+	}
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= cw.minSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush forces a decision on the encoding and flushes the buffered
+// content to the client.
+func (cw *compressResponseWriter) Flush() {
+	if cw.decided == false {
+		cw.decide(true)
+	}
+	if cw.gz != nil {
+		cw.gz.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes any remaining buffered content and finishes the
+// gzip stream.
+func (cw *compressResponseWriter) Close() error {
+	if cw.decided == false {
+		if cw.status == 0 {
+			cw.status = http.StatusOK
+		}
+		cw.decide(false)
+	}
+	if cw.gz != nil {
+		return cw.gz.Close()
+	}
+	return nil
+}
+
+// decide writes the headers and the buffered content. If compress
+// is true and the content type is compressible the response is
+// gzipped.
+func (cw *compressResponseWriter) decide(compress bool) error {
+	cw.decided = true
+	h := cw.Header()
+	contentType := h.Get("Content-Type")
+	if contentType == "" && len(cw.buf) > 0 {
+		contentType = http.DetectContentType(cw.buf)
+		h.Set("Content-Type", contentType)
+	}
+	if cw.status == http.StatusOK && IsCompressibleType(contentType) &&
+		compress && cw.gzipOK && h.Get("Content-Encoding") == "" {
+		h.Del("Content-Length")
+		h.Del("Accept-Ranges")
+		h.Set("Content-Encoding", "gzip")
+		if etag := h.Get("ETag"); etag != "" && strings.HasPrefix(etag, "W/") == false {
+			h.Set("ETag", "W/"+etag)
+		}
+		cw.gz = gzip.NewWriter(cw.ResponseWriter)
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	if len(cw.buf) > 0 {
+		var err error
+		if cw.gz != nil {
+			_, err = cw.gz.Write(cw.buf)
+		} else {
+			_, err = cw.ResponseWriter.Write(cw.buf)
+		}
+		cw.buf = nil
+		return err
+	}
+	return nil
+}
+
+// Precompress walks htdocs writing a gzip sibling (e.g. index.html.gz)
+// for each compressible file of at least minSize bytes. Existing
+// siblings newer than their source are left alone. Dot paths are
+// skipped. Brotli (.br) siblings need to be generated with an
+// external tool, ws will serve them when present.
+func Precompress(htdocs string, minSize int, verbose bool) error {
+	return filepath.Walk(htdocs, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if IsDotPath(strings.TrimPrefix(p, htdocs)) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || info.Size() < int64(minSize) {
+			return nil
+		}
+		ext := filepath.Ext(p)
+		if ext == ".gz" || ext == ".br" || IsCompressibleType(mime.TypeByExtension(ext)) == false {
+			return nil
+		}
+		target := p + ".gz"
+		if gzInfo, err := os.Stat(target); err == nil && gzInfo.ModTime().After(info.ModTime()) {
+			return nil
+		}
+		if err := gzipFile(p, target); err != nil {
+			return err
+		}
+		if verbose {
+			log.Printf("Wrote %s", target)
+		}
+		return nil
+	})
+}
+
+// gzipFile compresses src into target
+func gzipFile(src string, target string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(target)
+	if err != nil {
+		return fmt.Errorf("Creating %q, %s", target, err)
+	}
+	gz, err := gzip.NewWriterLevel(out, gzip.BestCompression)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if _, err := io.Copy(gz, in); err != nil {
+		out.Close()
+		return fmt.Errorf("Compressing %q, %s", src, err)
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
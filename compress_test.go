@@ -0,0 +1,177 @@
+//
+// compress_test.go test routines for compress.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAcceptsEncoding(t *testing.T) {
+	boolTests := map[string]bool{
+		"":                   false,
+		"gzip":               true,
+		"gzip, deflate, br":  true,
+		"br;q=1.0, gzip;q=0": false,
+		"*":                  true,
+		"identity":           false,
+		"GZIP;q=0.5":         true,
+	}
+	for header, expected := range boolTests {
+		if r := acceptsEncoding(header, "gzip"); r != expected {
+			t.Errorf("expected %t, got %t for %q", expected, r, header)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	htdocs := path.Join("test", "htdocs")
+	os.MkdirAll(htdocs, 0777)
+	page := path.Join(htdocs, "page.html")
+	src := []byte("<!DOCTYPE html>\n<html><body>" + strings.Repeat("<p>Hello World!</p>\n", 200) + "</body></html>\n")
+	if err := ioutil.WriteFile(page, src, 0666); err != nil {
+		t.Errorf("Can't create %q, %s", page, err)
+		t.FailNow()
+	}
+	os.Remove(page + ".gz")
+	if err := Precompress(htdocs, DefaultCompressMinSize, false); err != nil {
+		t.Errorf("Precompress(%q) failed, %s", htdocs, err)
+		t.FailNow()
+	}
+	if _, err := os.Stat(page + ".gz"); err != nil {
+		t.Errorf("expected %q.gz, %s", page, err)
+	}
+
+	// Serve the precompressed sibling
+	c := &Compression{DocRoot: htdocs, Precompressed: true}
+	handler := c.Handler(http.FileServer(http.Dir(htdocs)))
+	req := httptest.NewRequest("GET", "/page.html", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if ce := rec.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Errorf("expected Content-Encoding gzip, got %q", ce)
+	}
+	if vary := rec.Header().Get("Vary"); vary != "Accept-Encoding" {
+		t.Errorf("expected Vary Accept-Encoding, got %q", vary)
+	}
+	if ct := rec.Header().Get("Content-Type"); strings.HasPrefix(ct, "text/html") == false {
+		t.Errorf("expected text/html, got %q", ct)
+	}
+
+	// Range requests are served uncompressed
+	req = httptest.NewRequest("GET", "/page.html", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=0-14")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent {
+		t.Errorf("expected 206, got %d", rec.Code)
+	}
+	if ce := rec.Header().Get("Content-Encoding"); ce != "" {
+		t.Errorf("expected no Content-Encoding for range request, got %q", ce)
+	}
+	if s := rec.Body.String(); s != "<!DOCTYPE html>" {
+		t.Errorf("expected range to return doctype, got %q", s)
+	}
+
+	// Compress on the fly
+	os.Remove(page + ".gz")
+	c = &Compression{DocRoot: htdocs, OnTheFly: true, MinSize: DefaultCompressMinSize}
+	handler = c.Handler(http.FileServer(http.Dir(htdocs)))
+	req = httptest.NewRequest("GET", "/page.html", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if ce := rec.Header().Get("Content-Encoding"); ce != "gzip" {
+		t.Errorf("expected Content-Encoding gzip, got %q", ce)
+		t.FailNow()
+	}
+	if cl := rec.Header().Get("Content-Length"); cl != "" {
+		t.Errorf("expected Content-Length to be removed, got %q", cl)
+	}
+	gz, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Errorf("expected gzip body, %s", err)
+		t.FailNow()
+	}
+	buf, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Errorf("expected to read gzip body, %s", err)
+	}
+	if string(buf) != string(src) {
+		t.Errorf("expected decompressed body to match source")
+	}
+
+	// Client refuses gzip, still gets Vary
+	req = httptest.NewRequest("GET", "/page.html", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if ce := rec.Header().Get("Content-Encoding"); ce != "" {
+		t.Errorf("expected no Content-Encoding, got %q", ce)
+	}
+	if vary := rec.Header().Get("Vary"); vary != "Accept-Encoding" {
+		t.Errorf("expected Vary Accept-Encoding, got %q", vary)
+	}
+	if rec.Body.Len() != len(src) {
+		t.Errorf("expected %d bytes, got %d", len(src), rec.Body.Len())
+	}
+
+	// HEAD and 304 responses vary too
+	req = httptest.NewRequest("HEAD", "/page.html", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if vary := rec.Header().Get("Vary"); vary != "Accept-Encoding" {
+		t.Errorf("expected Vary Accept-Encoding for HEAD, got %q", vary)
+	}
+	req = httptest.NewRequest("GET", "/page.html", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("expected 304, got %d", rec.Code)
+	}
+	if vary := rec.Header().Get("Vary"); vary != "Accept-Encoding" {
+		t.Errorf("expected Vary Accept-Encoding for 304, got %q", vary)
+	}
+
+	// Siblings of removed files aren't served
+	gone := path.Join(htdocs, "gone.css")
+	ioutil.WriteFile(gone, []byte(strings.Repeat("body { color: black; }\n", 100)), 0666)
+	os.Remove(gone + ".gz")
+	Precompress(htdocs, DefaultCompressMinSize, false)
+	os.Remove(gone)
+	c = &Compression{DocRoot: htdocs, Precompressed: true}
+	handler = c.Handler(http.FileServer(http.Dir(htdocs)))
+	req = httptest.NewRequest("GET", "/gone.css", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a removed file, got %d", rec.Code)
+	}
+}
@@ -26,49 +26,45 @@ import (
 	"strings"
 )
 
+// scanArgs splits a command line into the generator and its
+// parameters. Single and double quoted strings are one parameter
+// (without their quotes) and a backslash escapes the next character.
 func scanArgs(s string) (string, []string) {
 	var (
-		tok       string
 		generator string
 		params    []string
-		i, j      int
+		quote     rune
+		escaped   bool
+		inArg     bool
 	)
-	for i = 0; i < len(s) && (tok != " "); i++ {
-		tok = string(s[i])
-	}
-	generator = strings.TrimSpace(string(s[0:i]))
-	params = []string{}
-	j = len(generator) + 1
-	for ; i < len(s); i++ {
-		tok = string(s[i])
-		switch tok {
-		case "'":
-			for ; i < len(s) && tok != "'"; i++ {
-				// advance to next single quote.
-				tok = string(s[i])
-				if tok == "\\" {
-					i += 1
-					tok = string(s[i])
-				}
-			}
-		case `"`:
-			for ; i < len(s) && tok != `"`; i++ {
-				// advance to next double quote.
-				tok = string(s[i])
-				if tok == "\\" {
-					i += 1
-					tok = string(s[i])
-				}
+	arg := []rune{}
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case escaped:
+			arg, escaped = append(arg, r), false
+		case r == '\\':
+			escaped, inArg = true, true
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			arg = append(arg, r)
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				params = append(params, string(arg))
+				arg, inArg = []rune{}, false
 			}
-		case " ":
-			params = append(params, strings.TrimSpace(string(s[j:i])))
-			j = i
+		default:
+			arg, inArg = append(arg, r), true
 		}
 	}
-	if j < i {
-		params = append(params, strings.TrimSpace(string(s[j:i])))
+	if inArg {
+		params = append(params, string(arg))
+	}
+	if len(params) > 0 {
+		generator, params = params[0], params[1:]
 	}
-	//fmt.Fprintf(os.Stderr, "DEBUG generator %q\nDEBUG params %+v\n", generator, params)
 	return generator, params
 }
 
@@ -3,6 +3,7 @@ module github.com/caltechlibrary/mkpage
 go 1.20
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/caltechlibrary/cli v0.0.18
 	github.com/caltechlibrary/rss2 v0.0.6
 	github.com/caltechlibrary/wsfn v0.0.9
@@ -11,7 +12,6 @@ require (
 )
 
 require (
-	github.com/BurntSushi/toml v1.2.1 // indirect
 	golang.org/x/crypto v0.17.0 // indirect
 	golang.org/x/sys v0.15.0 // indirect
 )
@@ -0,0 +1,404 @@
+//
+// Package mkpage logstats.go provides page view, referrer and 404 reports
+// from ws and Combined Log Format access logs.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// UAClassBrowser is a person using a web browser
+	UAClassBrowser = "browser"
+	// UAClassBot is a crawler or other robot
+	UAClassBot = "bot"
+	// UAClassFeedReader is an RSS or Atom reader
+	UAClassFeedReader = "feed reader"
+	// UAClassTool is a command line tool or library (e.g. curl)
+	UAClassTool = "tool"
+	// UAClassOther is anything else, including no user agent
+	UAClassOther = "other"
+)
+
+var (
+	// clfRE matches Common and Combined Log Format lines
+	clfRE = regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "([^"\\]*(?:\\.[^"\\]*)*)" (\d{3}) (\S+)(?: "([^"\\]*(?:\\.[^"\\]*)*)" "([^"\\]*(?:\\.[^"\\]*)*)")?`)
+
+	// textLogRE matches ws' text log lines, older lines stop after
+	// the user agent
+	textLogRE = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) Request: (\S+) Path: (\S*) RemoteAddr: (\S*) UserAgent: (.*?)(?: Query: (\S*))?(?: Status: (\d+), .*? Bytes: (\d+) Duration: ([0-9.]+)ms)?(?: Referrer: (\S+))?$`)
+
+	botRE    = regexp.MustCompile(`(?i)bot|crawl|spider|slurp|archiver|facebookexternalhit|preview`)
+	feedRE   = regexp.MustCompile(`(?i)feed|rss|atom|newsblur|inoreader|miniflux|netnewswire`)
+	toolRE   = regexp.MustCompile(`(?i)^(curl|wget|python|go-http-client|java|libwww|httpie|okhttp|node-fetch|axios)`)
+	browseRE = regexp.MustCompile(`(?i)mozilla|opera`)
+)
+
+// unquoteCLF undoes the escaping of a quoted Common Log Format field
+func unquoteCLF(s string) string {
+	if strings.Contains(s, `\`) {
+		if u, err := strconv.Unquote(`"` + s + `"`); err == nil {
+			return u
+		}
+	}
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// ParseAccessLogLine parses a line written by ws (text or JSON) or in
+// Common or Combined Log Format.
+func ParseAccessLogLine(line string) (*AccessLogEntry, error) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil, fmt.Errorf("empty line")
+	}
+	if strings.HasPrefix(line, "{") {
+		e := new(AccessLogEntry)
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	if m := clfRE.FindStringSubmatch(line); m != nil {
+		tm, err := time.Parse(CLFTimeFmt, m[2])
+		if err != nil {
+			return nil, err
+		}
+		e := &AccessLogEntry{
+			Time:       tm,
+			RemoteAddr: m[1],
+			Referrer:   unquoteCLF(m[6]),
+			UserAgent:  unquoteCLF(m[7]),
+		}
+		// Request line is "METHOD URI PROTO"
+		parts := strings.SplitN(unquoteCLF(m[3]), " ", 3)
+		if len(parts) > 0 {
+			e.Method = parts[0]
+		}
+		if len(parts) > 1 {
+			if u, err := url.ParseRequestURI(parts[1]); err == nil {
+				e.Path, e.Query = u.Path, u.RawQuery
+			} else {
+				e.Path = parts[1]
+			}
+		}
+		if len(parts) > 2 {
+			e.Proto = parts[2]
+		}
+		e.Status, _ = strconv.Atoi(m[4])
+		e.Bytes, _ = strconv.ParseInt(m[5], 10, 64)
+		return e, nil
+	}
+	if m := textLogRE.FindStringSubmatch(line); m != nil {
+		tm, err := time.ParseInLocation("2006/01/02 15:04:05", m[1], time.Local)
+		if err != nil {
+			return nil, err
+		}
+		e := &AccessLogEntry{
+			Time:       tm,
+			Method:     m[2],
+			Path:       m[3],
+			RemoteAddr: m[4],
+			UserAgent:  m[5],
+			Query:      m[6],
+			Referrer:   m[10],
+		}
+		// Older ws logs didn't record the status, we count them as OK
+		e.Status = http.StatusOK
+		if m[7] != "" {
+			e.Status, _ = strconv.Atoi(m[7])
+			e.Bytes, _ = strconv.ParseInt(m[8], 10, 64)
+			e.Duration, _ = strconv.ParseFloat(m[9], 64)
+		}
+		return e, nil
+	}
+	return nil, fmt.Errorf("unrecognized log format")
+}
+
+// ClassifyUserAgent returns one of browser, bot, feed reader, tool
+// or other for a User-Agent string.
+func ClassifyUserAgent(ua string) string {
+	switch {
+	case ua == "":
+		return UAClassOther
+	case botRE.MatchString(ua):
+		return UAClassBot
+	case feedRE.MatchString(ua):
+		return UAClassFeedReader
+	case toolRE.MatchString(ua):
+		return UAClassTool
+	case browseRE.MatchString(ua):
+		return UAClassBrowser
+	}
+	return UAClassOther
+}
+
+// IsPagePath returns true if the path looks like a page rather than
+// an asset (e.g. "/", "/about/", "/howto.html")
+func IsPagePath(p string) bool {
+	switch strings.ToLower(path.Ext(p)) {
+	case "", ".html", ".htm", ".md":
+		return true
+	}
+	return false
+}
+
+// LogCount is a count for a path, referrer or user agent class
+type LogCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// BrokenLink is a link from another site that ends in a 404
+type BrokenLink struct {
+	Path     string `json:"path"`
+	Referrer string `json:"referrer"`
+	Count    int    `json:"count"`
+}
+
+// LogReport is the summary produced by LogStats
+type LogReport struct {
+	Start       time.Time     `json:"start"`
+	End         time.Time     `json:"end"`
+	Requests    int           `json:"requests"`
+	PageViews   []*LogCount   `json:"page_views"`
+	Referrers   []*LogCount   `json:"top_referrers"`
+	NotFound    []*LogCount   `json:"not_found"`
+	BrokenLinks []*BrokenLink `json:"broken_inbound_links"`
+	UserAgents  []*LogCount   `json:"user_agents"`
+	Skipped     int           `json:"skipped,omitempty"`
+}
+
+// LogStats accumulates counts from access log entries
+type LogStats struct {
+	// From and To limit the date range, zero values are open ended
+	From time.Time
+	To   time.Time
+	// SiteHosts are hostnames of our own site, referrers from them
+	// are internal and not counted as top referrers or inbound links
+	SiteHosts []string
+	// Top limits the length of each list in the report, zero is no limit
+	Top int
+
+	start, end  time.Time
+	requests    int
+	skipped     int
+	pageViews   map[string]int
+	referrers   map[string]int
+	notFound    map[string]int
+	brokenLinks map[[2]string]int
+	userAgents  map[string]int
+}
+
+// NewLogStats returns an empty *LogStats
+func NewLogStats() *LogStats {
+	return &LogStats{
+		pageViews:   map[string]int{},
+		referrers:   map[string]int{},
+		notFound:    map[string]int{},
+		brokenLinks: map[[2]string]int{},
+		userAgents:  map[string]int{},
+	}
+}
+
+// isExternal returns true if the referrer is from another site
+func (stats *LogStats) isExternal(referrer string, host string) bool {
+	if referrer == "" {
+		return false
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	refHost := strings.ToLower(u.Hostname())
+	if host != "" && refHost == strings.ToLower(normalizeHost(host)) {
+		return false
+	}
+	for _, h := range stats.SiteHosts {
+		if refHost == strings.ToLower(h) {
+			return false
+		}
+	}
+	return true
+}
+
+// Add counts an entry if it is in the date range
+func (stats *LogStats) Add(e *AccessLogEntry) {
+	if stats.From.IsZero() == false && e.Time.Before(stats.From) {
+		return
+	}
+	if stats.To.IsZero() == false && e.Time.After(stats.To) {
+		return
+	}
+	stats.requests++
+	if stats.start.IsZero() || e.Time.Before(stats.start) {
+		stats.start = e.Time
+	}
+	if e.Time.After(stats.end) {
+		stats.end = e.Time
+	}
+	class := ClassifyUserAgent(e.UserAgent)
+	stats.userAgents[class]++
+	external := stats.isExternal(e.Referrer, e.Host)
+	switch {
+	case e.Status == http.StatusNotFound:
+		stats.notFound[e.Path]++
+		if external {
+			stats.brokenLinks[[2]string{e.Path, e.Referrer}]++
+		}
+	case e.Method == "GET" && (e.Status == http.StatusOK || e.Status == http.StatusNotModified) && IsPagePath(e.Path):
+		if class != UAClassBot {
+			stats.pageViews[e.Path]++
+			if external {
+				stats.referrers[e.Referrer]++
+			}
+		}
+	}
+}
+
+// Skip counts a line that couldn't be parsed
+func (stats *LogStats) Skip() {
+	stats.skipped++
+}
+
+// ReadAccessLog reads log lines from an io.Reader adding each entry,
+// lines that can't be parsed are counted as skipped.
+func (stats *LogStats) ReadAccessLog(rd io.Reader) error {
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if e, err := ParseAccessLogLine(line); err == nil {
+			stats.Add(e)
+		} else {
+			stats.Skip()
+		}
+	}
+	return scanner.Err()
+}
+
+// sortedCounts returns a count map as a list ordered by count then name
+func sortedCounts(m map[string]int, top int) []*LogCount {
+	counts := []*LogCount{}
+	for name, count := range m {
+		counts = append(counts, &LogCount{Name: name, Count: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count == counts[j].Count {
+			return counts[i].Name < counts[j].Name
+		}
+		return counts[i].Count > counts[j].Count
+	})
+	if top > 0 && len(counts) > top {
+		counts = counts[0:top]
+	}
+	return counts
+}
+
+// Report returns a *LogReport of the entries added so far
+func (stats *LogStats) Report() *LogReport {
+	report := &LogReport{
+		Start:       stats.start,
+		End:         stats.end,
+		Requests:    stats.requests,
+		PageViews:   sortedCounts(stats.pageViews, stats.Top),
+		Referrers:   sortedCounts(stats.referrers, stats.Top),
+		NotFound:    sortedCounts(stats.notFound, stats.Top),
+		BrokenLinks: []*BrokenLink{},
+		UserAgents:  sortedCounts(stats.userAgents, 0),
+		Skipped:     stats.skipped,
+	}
+	for key, count := range stats.brokenLinks {
+		report.BrokenLinks = append(report.BrokenLinks, &BrokenLink{Path: key[0], Referrer: key[1], Count: count})
+	}
+	sort.Slice(report.BrokenLinks, func(i, j int) bool {
+		a, b := report.BrokenLinks[i], report.BrokenLinks[j]
+		if a.Count == b.Count {
+			return a.Path+a.Referrer < b.Path+b.Referrer
+		}
+		return a.Count > b.Count
+	})
+	if stats.Top > 0 && len(report.BrokenLinks) > stats.Top {
+		report.BrokenLinks = report.BrokenLinks[0:stats.Top]
+	}
+	return report
+}
+
+// markdownCell escapes pipes so a value fits in a Markdown table cell
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// Markdown renders the report as a Markdown document suitable for
+// processing with mkpage.
+func (report *LogReport) Markdown() string {
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "\n# Site statistics\n\n")
+	if report.Requests > 0 {
+		fmt.Fprintf(buf, "From %s to %s, %d requests.\n", report.Start.Format("2006-01-02 15:04:05"), report.End.Format("2006-01-02 15:04:05"), report.Requests)
+	} else {
+		fmt.Fprintf(buf, "No requests found.\n")
+	}
+	if report.Skipped > 0 {
+		fmt.Fprintf(buf, "\n%d log lines could not be read.\n", report.Skipped)
+	}
+	table := func(title string, heading string, counts []*LogCount) {
+		fmt.Fprintf(buf, "\n## %s\n\n", title)
+		if len(counts) == 0 {
+			fmt.Fprintf(buf, "None.\n")
+			return
+		}
+		fmt.Fprintf(buf, "| %s | Count |\n|---|---:|\n", heading)
+		for _, c := range counts {
+			fmt.Fprintf(buf, "| %s | %d |\n", markdownCell(c.Name), c.Count)
+		}
+	}
+	table("Page views", "Path", report.PageViews)
+	table("Top referrers", "Referrer", report.Referrers)
+	table("Not found", "Path", report.NotFound)
+	fmt.Fprintf(buf, "\n## Broken inbound links\n\n")
+	if len(report.BrokenLinks) == 0 {
+		fmt.Fprintf(buf, "None.\n")
+	} else {
+		fmt.Fprintf(buf, "| Path | Referrer | Count |\n|---|---|---:|\n")
+		for _, link := range report.BrokenLinks {
+			fmt.Fprintf(buf, "| %s | %s | %d |\n", markdownCell(link.Path), markdownCell(link.Referrer), link.Count)
+		}
+	}
+	table("User agents", "Class", report.UserAgents)
+	return buf.String()
+}
@@ -0,0 +1,117 @@
+//
+// logstats_test.go test routines for logstats.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseAccessLogLine(t *testing.T) {
+	lines := map[string]*AccessLogEntry{
+		`127.0.0.1 - frank [10/Oct/2021:13:55:36 -0700] "GET /howto/ HTTP/1.1" 200 2326 "https://search.example.com/?q=howto" "Mozilla/5.0 (X11; Linux x86_64)"`: &AccessLogEntry{
+			Method: "GET", Path: "/howto/", Status: 200, Bytes: 2326,
+			Referrer: "https://search.example.com/?q=howto", UserAgent: "Mozilla/5.0 (X11; Linux x86_64)",
+		},
+		`127.0.0.1 - - [10/Oct/2021:13:55:36 -0700] "GET /missing.html?x=1 HTTP/1.0" 404 -`: &AccessLogEntry{
+			Method: "GET", Path: "/missing.html", Query: "x=1", Status: 404,
+		},
+		`{"time":"2021-10-10T13:55:36-07:00","method":"GET","path":"/","proto":"HTTP/1.1","status":304,"bytes":0,"duration_ms":0.5,"user_agent":"curl/7.68.0"}`: &AccessLogEntry{
+			Method: "GET", Path: "/", Status: 304, UserAgent: "curl/7.68.0",
+		},
+		`2021/10/10 13:55:36 Request: GET Path: /about.html RemoteAddr: 127.0.0.1:5432 UserAgent: Mozilla/5.0 (Macintosh) Status: 200, OK Bytes: 512 Duration: 1.250ms Referrer: https://example.org/`: &AccessLogEntry{
+			Method: "GET", Path: "/about.html", Status: 200, Bytes: 512,
+			Referrer: "https://example.org/", UserAgent: "Mozilla/5.0 (Macintosh)",
+		},
+		`2021/10/10 13:55:36 Request: GET Path: /old.html RemoteAddr: 127.0.0.1:5432 UserAgent: Mozilla/5.0 (Macintosh)`: &AccessLogEntry{
+			Method: "GET", Path: "/old.html", Status: 200, UserAgent: "Mozilla/5.0 (Macintosh)",
+		},
+	}
+	for line, expected := range lines {
+		e, err := ParseAccessLogLine(line)
+		if err != nil {
+			t.Errorf("ParseAccessLogLine(%q) failed, %s", line, err)
+			continue
+		}
+		if e.Method != expected.Method || e.Path != expected.Path || e.Query != expected.Query ||
+			e.Status != expected.Status || e.Bytes != expected.Bytes ||
+			e.Referrer != expected.Referrer || e.UserAgent != expected.UserAgent {
+			t.Errorf("expected %+v, got %+v", expected, e)
+		}
+		if e.Time.IsZero() {
+			t.Errorf("expected a time for %q", line)
+		}
+	}
+	if _, err := ParseAccessLogLine("not a log line"); err == nil {
+		t.Errorf("expected an error for an unrecognized line")
+	}
+}
+
+func TestLogStats(t *testing.T) {
+	src := `127.0.0.1 - - [09/Oct/2021:10:00:00 -0700] "GET /howto/ HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+127.0.0.1 - - [10/Oct/2021:10:00:00 -0700] "GET /howto/ HTTP/1.1" 200 100 "https://search.example.com/" "Mozilla/5.0"
+127.0.0.1 - - [10/Oct/2021:10:01:00 -0700] "GET /howto/ HTTP/1.1" 200 100 "https://www.example.edu/" "Mozilla/5.0"
+127.0.0.1 - - [10/Oct/2021:10:02:00 -0700] "GET /howto/ HTTP/1.1" 200 100 "-" "Googlebot/2.1"
+127.0.0.1 - - [10/Oct/2021:10:03:00 -0700] "GET /css/site.css HTTP/1.1" 200 100 "-" "Mozilla/5.0"
+127.0.0.1 - - [10/Oct/2021:10:04:00 -0700] "GET /gone.html HTTP/1.1" 404 10 "https://forum.example.net/t/1" "Mozilla/5.0"
+127.0.0.1 - - [10/Oct/2021:10:05:00 -0700] "GET /rss.xml HTTP/1.1" 200 100 "-" "NetNewsWire"
+garbage
+`
+	stats := NewLogStats()
+	stats.SiteHosts = []string{"www.example.edu"}
+	stats.From, _ = time.Parse(time.RFC3339, "2021-10-10T00:00:00-07:00")
+	if err := stats.ReadAccessLog(strings.NewReader(src)); err != nil {
+		t.Errorf("ReadAccessLog() failed, %s", err)
+		t.FailNow()
+	}
+	report := stats.Report()
+	if report.Requests != 6 {
+		t.Errorf("expected 6 requests, got %d", report.Requests)
+	}
+	if report.Skipped != 1 {
+		t.Errorf("expected 1 skipped line, got %d", report.Skipped)
+	}
+	if len(report.PageViews) != 1 || report.PageViews[0].Name != "/howto/" || report.PageViews[0].Count != 2 {
+		t.Errorf("expected 2 page views of /howto/, got %+v", report.PageViews)
+	}
+	if len(report.Referrers) != 1 || report.Referrers[0].Name != "https://search.example.com/" {
+		t.Errorf("expected one external referrer, got %+v", report.Referrers)
+	}
+	if len(report.NotFound) != 1 || report.NotFound[0].Name != "/gone.html" {
+		t.Errorf("expected /gone.html not found, got %+v", report.NotFound)
+	}
+	if len(report.BrokenLinks) != 1 || report.BrokenLinks[0].Referrer != "https://forum.example.net/t/1" {
+		t.Errorf("expected a broken inbound link, got %+v", report.BrokenLinks)
+	}
+	classes := map[string]int{}
+	for _, c := range report.UserAgents {
+		classes[c.Name] = c.Count
+	}
+	if classes[UAClassBrowser] != 4 || classes[UAClassBot] != 1 || classes[UAClassFeedReader] != 1 {
+		t.Errorf("unexpected user agent classes %+v", classes)
+	}
+	md := report.Markdown()
+	for _, s := range []string{"## Page views", "| /howto/ | 2 |", "## Broken inbound links"} {
+		if strings.Contains(md, s) == false {
+			t.Errorf("expected %q in markdown report", s)
+		}
+	}
+}
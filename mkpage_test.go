@@ -22,12 +22,21 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"os/exec"
 	"path"
 	"strings"
 	"testing"
 )
 
+// needsPandoc skips a test when Pandoc isn't installed
+func needsPandoc(t *testing.T) {
+	if _, err := exec.LookPath("pandoc"); err != nil {
+		t.Skip("pandoc not found, skipping")
+	}
+}
+
 func TestResolveData(t *testing.T) {
+	needsPandoc(t)
 	checkMap := func(ky string, expected string, m map[string]interface{}) error {
 		if val, ok := m[ky]; ok == true {
 			switch vv := val.(type) {
@@ -99,6 +108,7 @@ func TestResolveData(t *testing.T) {
 }
 
 func TestMakePage(t *testing.T) {
+	needsPandoc(t)
 	checkForString := func(src, target string) bool {
 		if strings.Contains(src, target) == false {
 			t.Errorf("expected %q in %s", target, src)
@@ -154,6 +164,7 @@ It was some New Years day...
 }
 
 func TestCRLFHandling(t *testing.T) {
+	needsPandoc(t)
 	srcRaw := []byte(`
 
 # Title 
@@ -258,5 +269,4 @@ func TestScanArgs2(t *testing.T) {
 			t.Errorf("expected param(%d) %q, got %q from %+v", i, val, params[i], params)
 		}
 	}
-	t.Errorf("DEBUG param[2] -> %q", params[2])
 }
@@ -1,6 +1,7 @@
 package mkpage
 
 import (
+	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"net/url"
@@ -51,9 +52,16 @@ func BlogMetaToRSS(blog *BlogMeta, feed *rss2.RSS2) error {
 			for _, days := range months.Days {
 				dy := days.Day
 				for _, post := range days.Posts {
-					pubDate, err := time.Parse("2006-01-02", fmt.Sprintf("%s-%s-%s", yr, mn, dy))
-					if err != nil {
-						return err
+					if blog.IsPublished(post) == false {
+						continue
+					}
+					// NOTE: Use the post's timestamp when it has one
+					pubDate, err := ParsePostDate(post.Created)
+					if err != nil || pubDate.Format("2006-01-02") != fmt.Sprintf("%s-%s-%s", yr, mn, dy) {
+						pubDate, err = time.Parse("2006-01-02", fmt.Sprintf("%s-%s-%s", yr, mn, dy))
+						if err != nil {
+							return err
+						}
 					}
 					// NOTE: We only want to process Markdown documents.
 					// We look for Markdown related file extensions.
@@ -65,9 +73,10 @@ func BlogMetaToRSS(blog *BlogMeta, feed *rss2.RSS2) error {
 					}
 					item := new(rss2.Item)
 					item.Title = post.Title
-					item.Link = strings.Join([]string{blog.BaseURL, post.Document}, "/")
+					item.Link = blog.PostURL(post)
 					item.GUID = item.Link
 					item.PubDate = pubDate.Format(time.RFC1123)
+					item.Author = rssAuthor(post.Creators)
 					if len(post.Description) == 0 && len(post.Document) > 0 {
 						// Read the article, extract a description
 						buf, err := ioutil.ReadFile(post.Document)
@@ -107,6 +116,74 @@ func BlogMetaToRSS(blog *BlogMeta, feed *rss2.RSS2) error {
 	return nil
 }
 
+// rssAuthor returns an item's author, RSS expects an email so it is
+// the first creator with one, e.g. "jdoe@example.edu (Jane Doe)".
+func rssAuthor(creators []CreatorObj) string {
+	for _, creator := range creators {
+		if creator.Email != "" {
+			if creator.Name != "" {
+				return fmt.Sprintf("%s (%s)", creator.Email, creator.Name)
+			}
+			return creator.Email
+		}
+	}
+	return ""
+}
+
+// PostCreators returns the names of the creators of the published
+// posts by the post's URL (see PostURL), e.g. for MarshalRSS.
+func (meta *BlogMeta) PostCreators() map[string][]string {
+	creators := map[string][]string{}
+	for _, yr := range meta.Years {
+		for _, mn := range yr.Months {
+			for _, dy := range mn.Days {
+				for _, post := range dy.Posts {
+					if meta.IsPublished(post) == false {
+						continue
+					}
+					for _, creator := range post.Creators {
+						if creator.Name != "" {
+							link := meta.PostURL(post)
+							creators[link] = append(creators[link], creator.Name)
+						}
+					}
+				}
+			}
+		}
+	}
+	return creators
+}
+
+// dcItem is an RSS item with its creators as Dublin Core dc:creator
+// elements
+type dcItem struct {
+	rss2.Item
+	DCCreator []string `xml:"dc:creator,omitempty"`
+}
+
+// dcRSS is an RSS feed declaring the Dublin Core namespace for its
+// items' dc:creator elements
+type dcRSS struct {
+	rss2.RSS2
+	XMLNSDC  string   `xml:"xmlns:dc,attr,omitempty"`
+	ItemList []dcItem `xml:"channel>item,omitempty"`
+}
+
+// MarshalRSS returns feed as indented XML with a dc:creator element
+// for each creator of an item (by its link, see PostCreators). The
+// Dublin Core namespace is declared if any are added.
+func MarshalRSS(feed *rss2.RSS2, creators map[string][]string) ([]byte, error) {
+	out := &dcRSS{RSS2: *feed}
+	for _, item := range feed.ItemList {
+		names := creators[item.Link]
+		if len(names) > 0 {
+			out.XMLNSDC = "http://purl.org/dc/elements/1.1/"
+		}
+		out.ItemList = append(out.ItemList, dcItem{Item: item, DCCreator: names})
+	}
+	return xml.MarshalIndent(out, "", "    ")
+}
+
 // Generate a Feed by walking the file system.
 func WalkRSS(feed *rss2.RSS2, htdocs string, excludeList string, titleExp string, bylineExp string, dateExp string) error {
 	// Required
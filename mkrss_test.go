@@ -56,4 +56,5 @@ func TestMain(m *testing.M) {
 	os.MkdirAll(prefix, 0777)
 	blogJSON = path.Join(prefix, "blog.json")
 	fName = "README.md"
+	os.Exit(m.Run())
 }
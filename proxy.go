@@ -0,0 +1,153 @@
+//
+// Package mkpage proxy.go provides reverse proxy mounts for ws so
+// static sites can call local API services during preview.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ProxyService holds our proxy mounts, a URL path prefix mapped to
+// the service the request is forwarded to.
+type ProxyService struct {
+	// Our map of path prefix to target service
+	routes map[string]*url.URL
+	// prefixes holds the route keys longest first
+	prefixes []string
+	// proxies holds a reverse proxy for each prefix
+	proxies map[string]*httputil.ReverseProxy
+}
+
+// ParseProxyMount takes a mount string in the form PREFIX=URL
+// (e.g. "/api/=http://localhost:9000/") and returns the prefix and
+// target.
+func ParseProxyMount(s string) (string, string, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("Can't parse proxy mount %q, expected PREFIX=URL", s)
+	}
+	return parts[0], parts[1], nil
+}
+
+// MakeProxyService takes a map[string]string of prefixes to target
+// URLs and returns a new *ProxyService and error
+func MakeProxyService(m map[string]string) (*ProxyService, error) {
+	ps := new(ProxyService)
+	for prefix, target := range m {
+		if err := ps.AddProxyRoute(prefix, target); err != nil {
+			return ps, err
+		}
+	}
+	return ps, nil
+}
+
+// HasProxyRoutes returns true if proxy mounts have been defined
+func (ps *ProxyService) HasProxyRoutes() bool {
+	return ps != nil && len(ps.routes) > 0
+}
+
+// AddProxyRoute takes a path prefix and a target URL and adds a
+// reverse proxy mount. Requests matching the prefix have it replaced
+// by the target's path before being forwarded.
+func (ps *ProxyService) AddProxyRoute(prefix string, target string) error {
+	if ps.routes == nil {
+		ps.routes = make(map[string]*url.URL)
+		ps.proxies = make(map[string]*httputil.ReverseProxy)
+	}
+	if strings.HasPrefix(prefix, "/") == false {
+		prefix = "/" + prefix
+	}
+	if strings.HasSuffix(prefix, "/") == false {
+		prefix = prefix + "/"
+	}
+	if _, ok := ps.routes[prefix]; ok {
+		return fmt.Errorf("proxy prefix %q already defined", prefix)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("proxy target %q, %s", target, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("proxy target %q must be an http or https URL", target)
+	}
+	ps.routes[prefix] = u
+	ps.proxies[prefix] = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			p := "/"
+			if strings.HasPrefix(pr.In.URL.Path, prefix) {
+				p += strings.TrimPrefix(pr.In.URL.Path, prefix)
+			}
+			pr.Out.URL.Path = p
+			pr.Out.URL.RawPath = ""
+			pr.SetURL(u)
+			pr.SetXForwarded()
+		},
+		// Flush immediately so streamed responses (e.g. server sent
+		// events) reach the browser as they are written.
+		FlushInterval: -1,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			// NOTE: the access log records the 502, the reason is
+			// logged here
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			log.Printf("Bad gateway for %s, %s", r.URL.Path, err)
+		},
+	}
+	ps.prefixes = append(ps.prefixes, prefix)
+	sort.Slice(ps.prefixes, func(i, j int) bool {
+		return len(ps.prefixes[i]) > len(ps.prefixes[j])
+	})
+	return nil
+}
+
+// Route takes a request path and returns the matching prefix and true
+// or an empty string and false.
+func (ps *ProxyService) Route(p string) (string, bool) {
+	for _, prefix := range ps.prefixes {
+		if strings.HasPrefix(p, prefix) || p == strings.TrimSuffix(prefix, "/") {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+// ProxyRouter forwards requests matching a proxy prefix, including
+// their headers, bodies and WebSocket upgrades, otherwise it passes
+// the request on to the next handler.
+func (ps *ProxyService) ProxyRouter(next http.Handler) http.Handler {
+	if ps.HasProxyRoutes() == false {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if prefix, ok := ps.Route(r.URL.Path); ok {
+			// Streamed responses can outlast a server's write timeout
+			http.NewResponseController(w).SetWriteDeadline(time.Time{})
+			ps.proxies[prefix].ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
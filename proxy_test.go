@@ -0,0 +1,154 @@
+//
+// proxy_test.go test routines for proxy.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseProxyMount(t *testing.T) {
+	prefix, target, err := ParseProxyMount("/api/=http://localhost:9000/")
+	if err != nil {
+		t.Errorf("unexpected error, %s", err)
+	}
+	if prefix != "/api/" || target != "http://localhost:9000/" {
+		t.Errorf("expected /api/ and http://localhost:9000/, got %q and %q", prefix, target)
+	}
+	if _, _, err := ParseProxyMount("/api/"); err == nil {
+		t.Errorf("expected an error for a mount without a target")
+	}
+	ps := new(ProxyService)
+	if err := ps.AddProxyRoute("/api/", "localhost:9000"); err == nil {
+		t.Errorf("expected an error for a target without a scheme")
+	}
+}
+
+func TestProxyRouter(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") == "websocket" {
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+			rw.Flush()
+			line, _ := rw.ReadString('\n')
+			rw.WriteString("echo " + line)
+			rw.Flush()
+			return
+		}
+		if r.URL.Path == "/v1/stream" {
+			fmt.Fprintf(w, "start ")
+			w.(http.Flusher).Flush()
+			time.Sleep(300 * time.Millisecond)
+			fmt.Fprintf(w, "end")
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %s %s %s", r.Method, r.URL.Path, r.Header.Get("X-Test"), body)
+	}))
+	defer backend.Close()
+
+	ps, err := MakeProxyService(map[string]string{"/api/": backend.URL + "/v1/"})
+	if err != nil {
+		t.Errorf("MakeProxyService() failed, %s", err)
+		t.FailNow()
+	}
+	local := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "local %s", r.URL.Path)
+	})
+	server := httptest.NewUnstartedServer(ps.ProxyRouter(local))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL+"/api/items", strings.NewReader("Hello World!"))
+	req.Header.Set("X-Test", "passed")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Errorf("proxy request failed, %s", err)
+		t.FailNow()
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	expected := "POST /v1/items passed Hello World!"
+	if string(body) != expected {
+		t.Errorf("expected %q, got %q", expected, body)
+	}
+
+	// Streamed responses outlast the write timeout
+	res, err = http.Get(server.URL + "/api/stream")
+	if err != nil {
+		t.Errorf("stream request failed, %s", err)
+		t.FailNow()
+	}
+	body, err = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil || string(body) != "start end" {
+		t.Errorf("expected the whole stream, got %q, %v", body, err)
+	}
+
+	res, err = http.Get(server.URL + "/index.html")
+	if err != nil {
+		t.Errorf("local request failed, %s", err)
+		t.FailNow()
+	}
+	body, _ = ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "local /index.html" {
+		t.Errorf("expected local file handler, got %q", body)
+	}
+
+	// WebSocket upgrades are passed through
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Errorf("dial failed, %s", err)
+		t.FailNow()
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "GET /api/ws HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	rd := bufio.NewReader(conn)
+	status, _ := rd.ReadString('\n')
+	if strings.Contains(status, "101") == false {
+		t.Errorf("expected 101 Switching Protocols, got %q", status)
+		t.FailNow()
+	}
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil || line == "\r\n" {
+			break
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+	fmt.Fprintf(conn, "ping\n")
+	line, _ := rd.ReadString('\n')
+	if line != "echo ping\n" {
+		t.Errorf("expected echo ping, got %q", line)
+	}
+}
@@ -0,0 +1,111 @@
+//
+// Package mkpage redirects.go reads and writes the redirects CSV
+// files used by ws.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// normalizeRedirectPath makes sure a redirect path starts with a slash
+func normalizeRedirectPath(p string) string {
+	p = strings.TrimSpace(p)
+	if strings.HasPrefix(p, "/") {
+		return p
+	}
+	return "/" + p
+}
+
+// ReadRedirectsCSV reads a CSV file of target,destination rows
+// (lines starting with '#' are comments) and returns a map of target
+// to destination paths.
+func ReadRedirectsCSV(fName string) (map[string]string, error) {
+	src, err := ioutil.ReadFile(fName)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read %s, %s", fName, err)
+	}
+	r := csv.NewReader(bytes.NewReader(src))
+	// Allow support for comment rows
+	r.Comment = '#'
+	// Make a redirect map[string]string
+	rmap := map[string]string{}
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Can't read %s, %s", fName, err)
+		}
+		if len(row) == 2 {
+			rmap[normalizeRedirectPath(row[0])] = normalizeRedirectPath(row[1])
+		}
+	}
+	return rmap, nil
+}
+
+// AppendRedirectsCSV appends target,destination rows to a redirects
+// CSV file (as read by ReadRedirectsCSV), creating it if needed.
+func AppendRedirectsCSV(fName string, redirects [][]string) error {
+	fp, err := os.OpenFile(fName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("Can't open %s, %s", fName, err)
+	}
+	defer fp.Close()
+	w := csv.NewWriter(fp)
+	for _, row := range redirects {
+		if len(row) != 2 {
+			return fmt.Errorf("Can't write %s, expected target,destination got %q", fName, row)
+		}
+		w.Write([]string{normalizeRedirectPath(row[0]), normalizeRedirectPath(row[1])})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("Can't write %s, %s", fName, err)
+	}
+	return nil
+}
+
+// RedirectStub returns a HTML page that redirects to href with a meta
+// refresh, for hosts where ws (or other redirect support) isn't
+// available.
+func RedirectStub(href string) []byte {
+	s := html.EscapeString(href)
+	return []byte(fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Moved</title>
+<link rel="canonical" href="%s">
+<meta http-equiv="refresh" content="0; url=%s">
+</head>
+<body>
+<p>This page has moved to <a href="%s">%s</a>.</p>
+</body>
+</html>
+`, s, s, s, s))
+}
@@ -0,0 +1,197 @@
+//
+// Package mkpage security.go provides security header presets and
+// Content-Security-Policy reporting for ws.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const (
+	// DefaultCSPReportPath is where ws listens for CSP violation reports
+	DefaultCSPReportPath = "/_csp-report"
+	// DefaultHSTSMaxAge is the preset's Strict-Transport-Security
+	// max-age, kept short so a local preview doesn't pin a host to https
+	DefaultHSTSMaxAge = 300
+	// maxCSPReportSize limits the size of a violation report we'll read
+	maxCSPReportSize = 64 * 1024
+)
+
+// SecurityHeaders holds the security related response headers ws
+// can add to each response.
+type SecurityHeaders struct {
+	// HSTSMaxAge is the Strict-Transport-Security max-age in seconds,
+	// it is only sent when serving https. Zero disables HSTS.
+	HSTSMaxAge int `json:"hsts_max_age,omitempty"`
+	// HSTSIncludeSubDomains adds includeSubDomains to HSTS
+	HSTSIncludeSubDomains bool `json:"hsts_include_subdomains,omitempty"`
+	// ContentTypeOptions is the X-Content-Type-Options value
+	ContentTypeOptions string `json:"content_type_options,omitempty"`
+	// FrameOptions is the X-Frame-Options value
+	FrameOptions string `json:"frame_options,omitempty"`
+	// ReferrerPolicy is the Referrer-Policy value
+	ReferrerPolicy string `json:"referrer_policy,omitempty"`
+	// PermissionsPolicy is the Permissions-Policy value
+	PermissionsPolicy string `json:"permissions_policy,omitempty"`
+	// ContentSecurityPolicy is the Content-Security-Policy value
+	ContentSecurityPolicy string `json:"content_security_policy,omitempty"`
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only
+	// and logs the violations posted back to CSPReportPath
+	CSPReportOnly bool `json:"csp_report_only,omitempty"`
+	// CSPReportPath is the local endpoint for violation reports
+	CSPReportPath string `json:"csp_report_path,omitempty"`
+}
+
+// DefaultSecurityHeaders returns the security headers preset
+func DefaultSecurityHeaders() *SecurityHeaders {
+	return &SecurityHeaders{
+		HSTSMaxAge:         DefaultHSTSMaxAge,
+		ContentTypeOptions: "nosniff",
+		FrameOptions:       "SAMEORIGIN",
+		ReferrerPolicy:     "strict-origin-when-cross-origin",
+		PermissionsPolicy:  "camera=(), microphone=(), geolocation=(), interest-cohort=()",
+		CSPReportPath:      DefaultCSPReportPath,
+	}
+}
+
+// cspReport is the body of a report-uri violation report
+type cspReport struct {
+	Report map[string]interface{} `json:"csp-report"`
+}
+
+// reportingAPIReport is the body of a Reporting API report
+type reportingAPIReport struct {
+	Type string                 `json:"type"`
+	URL  string                 `json:"url"`
+	Body map[string]interface{} `json:"body"`
+}
+
+// logCSPViolation writes a single violation to the log
+func logCSPViolation(report map[string]interface{}) {
+	field := func(keys ...string) string {
+		for _, key := range keys {
+			if val, ok := report[key]; ok {
+				return fmt.Sprintf("%v", val)
+			}
+		}
+		return ""
+	}
+	log.Printf("CSP violation: Document: %s Directive: %s Blocked: %s Source: %s Line: %s",
+		field("document-uri", "documentURL"),
+		field("violated-directive", "effectiveDirective", "effective-directive"),
+		field("blocked-uri", "blockedURL"),
+		field("source-file", "sourceFile"),
+		field("line-number", "lineNumber"))
+}
+
+// CSPReportHandler logs the Content-Security-Policy violations posted by
+// the browser. It accepts both the report-uri (application/csp-report)
+// and Reporting API (application/reports+json) formats.
+func CSPReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	src, err := ioutil.ReadAll(io.LimitReader(r.Body, maxCSPReportSize))
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		log.Printf("Bad CSP report, %s", err)
+		return
+	}
+	src = []byte(strings.TrimSpace(string(src)))
+	if strings.HasPrefix(string(src), "[") {
+		reports := []reportingAPIReport{}
+		if err := json.Unmarshal(src, &reports); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			log.Printf("Bad CSP report, %s", err)
+			return
+		}
+		for _, report := range reports {
+			if report.Body != nil {
+				logCSPViolation(report.Body)
+			}
+		}
+	} else {
+		report := cspReport{}
+		if err := json.Unmarshal(src, &report); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			log.Printf("Bad CSP report, %s", err)
+			return
+		}
+		if report.Report != nil {
+			logCSPViolation(report.Report)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Handler accepts an http.Handler and returns a http.Handler. It adds
+// the configured security headers to the response and, in report only
+// mode, answers the CSP report endpoint.
+func (sh *SecurityHeaders) Handler(next http.Handler) http.Handler {
+	if sh == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if sh.CSPReportOnly && sh.CSPReportPath != "" && r.URL.Path == sh.CSPReportPath {
+			CSPReportHandler(w, r)
+			return
+		}
+		h := w.Header()
+		if sh.HSTSMaxAge > 0 && r.TLS != nil {
+			hsts := fmt.Sprintf("max-age=%d", sh.HSTSMaxAge)
+			if sh.HSTSIncludeSubDomains {
+				hsts += "; includeSubDomains"
+			}
+			h.Set("Strict-Transport-Security", hsts)
+		}
+		if sh.ContentTypeOptions != "" {
+			h.Set("X-Content-Type-Options", sh.ContentTypeOptions)
+		}
+		if sh.FrameOptions != "" {
+			h.Set("X-Frame-Options", sh.FrameOptions)
+		}
+		if sh.ReferrerPolicy != "" {
+			h.Set("Referrer-Policy", sh.ReferrerPolicy)
+		}
+		if sh.PermissionsPolicy != "" {
+			h.Set("Permissions-Policy", sh.PermissionsPolicy)
+		}
+		if sh.ContentSecurityPolicy != "" {
+			if sh.CSPReportOnly {
+				policy := sh.ContentSecurityPolicy
+				if sh.CSPReportPath != "" && strings.Contains(policy, "report-uri") == false {
+					policy = strings.TrimSuffix(strings.TrimSpace(policy), ";") + "; report-uri " + sh.CSPReportPath
+				}
+				h.Set("Content-Security-Policy-Report-Only", policy)
+			} else {
+				h.Set("Content-Security-Policy", sh.ContentSecurityPolicy)
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,76 @@
+//
+// security_test.go test routines for security.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSecurityHeaders(t *testing.T) {
+	sh := DefaultSecurityHeaders()
+	sh.ContentSecurityPolicy = "default-src 'self'"
+	sh.CSPReportOnly = true
+	handler := sh.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello World!"))
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if val := rec.Header().Get("X-Content-Type-Options"); val != "nosniff" {
+		t.Errorf("expected nosniff, got %q", val)
+	}
+	if val := rec.Header().Get("Strict-Transport-Security"); val != "" {
+		t.Errorf("expected no HSTS over http, got %q", val)
+	}
+	if val := rec.Header().Get("Content-Security-Policy"); val != "" {
+		t.Errorf("expected no enforced CSP in report only mode, got %q", val)
+	}
+	expected := "default-src 'self'; report-uri " + DefaultCSPReportPath
+	if val := rec.Header().Get("Content-Security-Policy-Report-Only"); val != expected {
+		t.Errorf("expected %q, got %q", expected, val)
+	}
+
+	req = httptest.NewRequest("GET", "https://localhost/", nil)
+	req.TLS = &tls.ConnectionState{}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if val := rec.Header().Get("Strict-Transport-Security"); val != "max-age=300" {
+		t.Errorf("expected a short HSTS without includeSubDomains over https, got %q", val)
+	}
+
+	report := `{"csp-report":{"document-uri":"http://localhost:8000/","violated-directive":"img-src","blocked-uri":"https://example.org/a.png"}}`
+	req = httptest.NewRequest("POST", DefaultCSPReportPath, strings.NewReader(report))
+	req.Header.Set("Content-Type", "application/csp-report")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected 204 for violation report, got %d", rec.Code)
+	}
+	req = httptest.NewRequest("POST", DefaultCSPReportPath, strings.NewReader("not json"))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad report, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,268 @@
+//
+// Package mkpage server.go provides graceful shutdown, health checks and
+// Prometheus metrics for ws.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultReadTimeout limits reading a request including the body
+	DefaultReadTimeout = 30 * time.Second
+	// DefaultWriteTimeout limits writing a response, zero means none
+	// so large downloads and streamed proxy responses aren't cut off
+	DefaultWriteTimeout = time.Duration(0)
+	// DefaultIdleTimeout limits how long keep-alive connections wait
+	DefaultIdleTimeout = 120 * time.Second
+	// DefaultShutdownTimeout is how long in-flight requests are given
+	// to finish after SIGINT or SIGTERM
+	DefaultShutdownTimeout = 10 * time.Second
+)
+
+var (
+	// DurationBuckets are the upper bounds in seconds of the request
+	// duration histogram
+	DurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+	// metricMethods are the methods counted by name, others are
+	// counted as OTHER to keep the number of series small
+	metricMethods = map[string]bool{
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodPost:    true,
+		http.MethodPut:     true,
+		http.MethodPatch:   true,
+		http.MethodDelete:  true,
+		http.MethodOptions: true,
+	}
+)
+
+// GracefulServer is an *http.Server with the TLS key and cert to use
+// when it is started by ServeGracefully.
+type GracefulServer struct {
+	Server   *http.Server
+	CertFile string
+	KeyFile  string
+}
+
+// NewServer returns an *http.Server with read, write and idle timeouts
+// set. A zero timeout means no timeout.
+func NewServer(addr string, handler http.Handler, readTimeout, writeTimeout, idleTimeout time.Duration) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       readTimeout,
+		ReadHeaderTimeout: readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12},
+	}
+}
+
+// listenAndServe starts the server using TLS if a cert and key are set
+func (gs *GracefulServer) listenAndServe() error {
+	if gs.CertFile != "" || gs.KeyFile != "" {
+		return gs.Server.ListenAndServeTLS(gs.CertFile, gs.KeyFile)
+	}
+	return gs.Server.ListenAndServe()
+}
+
+// ServeGracefully starts the servers and waits for a signal on stop
+// (e.g. from signal.Notify for SIGINT and SIGTERM). It then stops
+// accepting connections and gives in-flight requests up to drain to
+// finish before closing them. If a server fails to start the others
+// are shutdown and the error returned.
+func ServeGracefully(drain time.Duration, stop <-chan os.Signal, servers ...*GracefulServer) error {
+	errCh := make(chan error, len(servers))
+	for _, gs := range servers {
+		go func(gs *GracefulServer) {
+			if err := gs.listenAndServe(); err != nil && err != http.ErrServerClosed {
+				errCh <- fmt.Errorf("%s, %s", gs.Server.Addr, err)
+			}
+		}(gs)
+	}
+	var err error
+	select {
+	case sig := <-stop:
+		log.Printf("Received %s, shutting down (waiting up to %s)", sig, drain)
+	case err = <-errCh:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), drain)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, gs := range servers {
+		wg.Add(1)
+		go func(srv *http.Server) {
+			defer wg.Done()
+			if e := srv.Shutdown(ctx); e != nil {
+				log.Printf("Shutdown of %s, %s, closing connections", srv.Addr, e)
+				srv.Close()
+			}
+		}(gs.Server)
+	}
+	wg.Wait()
+	return err
+}
+
+// HealthHandler answers health checks (e.g. /healthz) with 200 OK
+func HealthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// metricKey identifies a request counter series
+type metricKey struct {
+	Method string
+	Code   string
+}
+
+// Metrics counts requests, bytes, status classes and latencies and
+// reports them in the Prometheus text exposition format.
+type Metrics struct {
+	mu       sync.Mutex
+	requests map[metricKey]int64
+	bytes    int64
+	inFlight int64
+	buckets  []int64
+	count    int64
+	sum      float64
+}
+
+// NewMetrics returns an empty *Metrics
+func NewMetrics() *Metrics {
+	return &Metrics{
+		requests: map[metricKey]int64{},
+		buckets:  make([]int64, len(DurationBuckets)),
+	}
+}
+
+// Observe records a completed request
+func (m *Metrics) Observe(method string, status int, bytes int64, d time.Duration) {
+	if metricMethods[method] == false {
+		method = "OTHER"
+	}
+	code := fmt.Sprintf("%dxx", status/100)
+	seconds := d.Seconds()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[metricKey{Method: method, Code: code}]++
+	m.bytes += bytes
+	m.count++
+	m.sum += seconds
+	for i, le := range DurationBuckets {
+		if seconds <= le {
+			m.buckets[i]++
+		}
+	}
+}
+
+// Handler accepts an http.Handler and returns a http.Handler that
+// records metrics for each response.
+func (m *Metrics) Handler(next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		m.mu.Lock()
+		m.inFlight++
+		m.mu.Unlock()
+		rec := &responseRecorder{ResponseWriter: w}
+		defer func() {
+			m.mu.Lock()
+			m.inFlight--
+			m.mu.Unlock()
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			m.Observe(r.Method, rec.status, rec.bytes, time.Since(start))
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
+// ServeHTTP writes the metrics in Prometheus text format (e.g. for /metrics)
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	fmt.Fprint(w, m.String())
+}
+
+// String returns the metrics in Prometheus text format
+func (m *Metrics) String() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var sb strings.Builder
+	keys := []metricKey{}
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Method == keys[j].Method {
+			return keys[i].Code < keys[j].Code
+		}
+		return keys[i].Method < keys[j].Method
+	})
+	fmt.Fprintf(&sb, "# HELP ws_requests_total Total HTTP requests by method and status class.\n")
+	fmt.Fprintf(&sb, "# TYPE ws_requests_total counter\n")
+	for _, key := range keys {
+		fmt.Fprintf(&sb, "ws_requests_total{method=%q,code=%q} %d\n", key.Method, key.Code, m.requests[key])
+	}
+	fmt.Fprintf(&sb, "# HELP ws_response_bytes_total Total bytes written in response bodies.\n")
+	fmt.Fprintf(&sb, "# TYPE ws_response_bytes_total counter\n")
+	fmt.Fprintf(&sb, "ws_response_bytes_total %d\n", m.bytes)
+	fmt.Fprintf(&sb, "# HELP ws_requests_in_flight Requests currently being served.\n")
+	fmt.Fprintf(&sb, "# TYPE ws_requests_in_flight gauge\n")
+	fmt.Fprintf(&sb, "ws_requests_in_flight %d\n", m.inFlight)
+	fmt.Fprintf(&sb, "# HELP ws_request_duration_seconds Time taken to serve requests.\n")
+	fmt.Fprintf(&sb, "# TYPE ws_request_duration_seconds histogram\n")
+	for i, le := range DurationBuckets {
+		fmt.Fprintf(&sb, "ws_request_duration_seconds_bucket{le=\"%g\"} %d\n", le, m.buckets[i])
+	}
+	fmt.Fprintf(&sb, "ws_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.count)
+	fmt.Fprintf(&sb, "ws_request_duration_seconds_sum %g\n", m.sum)
+	fmt.Fprintf(&sb, "ws_request_duration_seconds_count %d\n", m.count)
+	return sb.String()
+}
+
+// AdminHandler returns a handler for the admin address serving
+// /healthz and /metrics (if metrics is not nil).
+func AdminHandler(metrics *Metrics) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", HealthHandler)
+	if metrics != nil {
+		mux.Handle("/metrics", metrics)
+	}
+	return mux
+}
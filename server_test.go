@@ -0,0 +1,123 @@
+//
+// server_test.go test routines for server.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	handler := metrics.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("Hello World!"))
+	}))
+	for _, p := range []string{"/", "/index.html", "/missing"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", p, nil))
+	}
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("BREW", "/", nil))
+
+	rec := httptest.NewRecorder()
+	AdminHandler(metrics).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	src := rec.Body.String()
+	for _, s := range []string{
+		`ws_requests_total{method="GET",code="2xx"} 2`,
+		`ws_requests_total{method="GET",code="4xx"} 1`,
+		`ws_requests_total{method="OTHER",code="2xx"} 1`,
+		`ws_request_duration_seconds_bucket{le="+Inf"} 4`,
+		`ws_request_duration_seconds_count 4`,
+		`ws_requests_in_flight 0`,
+		"# TYPE ws_request_duration_seconds histogram",
+	} {
+		if strings.Contains(src, s) == false {
+			t.Errorf("expected %q in metrics\n%s", s, src)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	AdminHandler(metrics).ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != "ok" {
+		t.Errorf("expected healthz ok, got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestServeGracefully(t *testing.T) {
+	// Find a free port
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Errorf("Can't find a free port, %s", err)
+		t.FailNow()
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	started := make(chan bool, 1)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- true
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+	srv := NewServer(addr, handler, DefaultReadTimeout, DefaultWriteTimeout, DefaultIdleTimeout)
+	stop := make(chan os.Signal, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeGracefully(5*time.Second, stop, &GracefulServer{Server: srv})
+	}()
+
+	// Wait for the server to start
+	for i := 0; i < 50; i++ {
+		if conn, err := net.Dial("tcp", addr); err == nil {
+			conn.Close()
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	body := make(chan string, 1)
+	go func() {
+		res, err := http.Get("http://" + addr + "/")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer res.Body.Close()
+		src, _ := ioutil.ReadAll(res.Body)
+		body <- string(src)
+	}()
+	<-started
+	stop <- syscall.SIGTERM
+	if s := <-body; s != "done" {
+		t.Errorf("expected in-flight request to finish, got %q", s)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("expected clean shutdown, %s", err)
+	}
+}
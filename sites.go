@@ -0,0 +1,219 @@
+//
+// Package mkpage sites.go provides multiple document root mounts
+// and virtual hosts for ws.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+
+	// Caltech Library packages
+	"github.com/caltechlibrary/wsfn"
+)
+
+// Site is a document root mounted at a URL path prefix, optionally
+// for a specific host, with its own CORS and redirect configuration.
+type Site struct {
+	// Host is the virtual host name, empty for the default host
+	Host string `json:"host,omitempty"`
+	// Prefix is the URL path the document root is mounted at
+	Prefix string `json:"prefix,omitempty"`
+	// DocRoot is the directory served
+	DocRoot string `json:"docroot"`
+	// CORSOrigin sets the Access-Control-Allow-Origin for the site
+	CORSOrigin string `json:"cors_origin,omitempty"`
+	// RedirectsCSV holds the target,destination redirects for the site.
+	// Paths are the full URL path including the mount prefix.
+	RedirectsCSV string `json:"redirects_csv,omitempty"`
+}
+
+// siteHandler pairs a site with its assembled http.Handler
+type siteHandler struct {
+	site    *Site
+	handler http.Handler
+}
+
+// SiteRouter routes requests to a site by Host header and the
+// longest matching path prefix.
+type SiteRouter struct {
+	// hosts maps a lower case host name to its sites, longest prefix
+	// first. The empty string holds the default host's sites.
+	hosts map[string][]*siteHandler
+}
+
+// ParseSite takes a mount specification in the form
+// KEY=DIR[;cors-origin=ORIGIN][;redirects-csv=FILE] and returns
+// a *Site. If isVHost is true KEY is a host name mounted at "/",
+// otherwise it is the path prefix for the default host.
+func ParseSite(spec string, isVHost bool) (*Site, error) {
+	fields := strings.Split(strings.TrimSpace(spec), ";")
+	parts := strings.SplitN(fields[0], "=", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("Can't parse %q, expected KEY=DIR", spec)
+	}
+	site := new(Site)
+	if isVHost {
+		site.Host, site.Prefix = parts[0], "/"
+	} else {
+		site.Prefix = parts[0]
+	}
+	site.DocRoot = parts[1]
+	for _, field := range fields[1:] {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Can't parse %q in %q, expected OPTION=VALUE", field, spec)
+		}
+		switch kv[0] {
+		case "cors-origin":
+			site.CORSOrigin = kv[1]
+		case "redirects-csv":
+			site.RedirectsCSV = kv[1]
+		default:
+			return nil, fmt.Errorf("Unknown mount option %q in %q", kv[0], spec)
+		}
+	}
+	return site, nil
+}
+
+// normalizeHost lower cases a host name and removes any port
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// normalizePrefix makes sure a prefix starts and ends with a slash
+func normalizePrefix(prefix string) string {
+	if strings.HasPrefix(prefix, "/") == false {
+		prefix = "/" + prefix
+	}
+	if strings.HasSuffix(prefix, "/") == false {
+		prefix = prefix + "/"
+	}
+	return prefix
+}
+
+// Handler assembles the http.Handler for a site. The wrap function
+// (if not nil) is applied to the site's http.FileServer so settings
+// like caching and compression can be set per document root.
+func (site *Site) Handler(wrap func(docRoot string, next http.Handler) http.Handler) (http.Handler, error) {
+	var handler http.Handler = http.FileServer(http.Dir(site.DocRoot))
+	if wrap != nil {
+		handler = wrap(site.DocRoot, handler)
+	}
+	if site.CORSOrigin != "" {
+		cors := &wsfn.CORSPolicy{
+			Origin: site.CORSOrigin,
+		}
+		handler = cors.Handler(handler)
+	}
+	prefix := normalizePrefix(site.Prefix)
+	if prefix != "/" {
+		handler = http.StripPrefix(strings.TrimSuffix(prefix, "/"), handler)
+	}
+	if site.RedirectsCSV != "" {
+		rmap, err := ReadRedirectsCSV(site.RedirectsCSV)
+		if err != nil {
+			return nil, err
+		}
+		rService, err := wsfn.MakeRedirectService(rmap)
+		if err != nil {
+			return nil, fmt.Errorf("Can't make redirect service, %s", err)
+		}
+		handler = rService.RedirectRouter(handler)
+	}
+	return StaticRouter(handler), nil
+}
+
+// AddSite adds a site to the router
+func (sr *SiteRouter) AddSite(site *Site, wrap func(docRoot string, next http.Handler) http.Handler) error {
+	if sr.hosts == nil {
+		sr.hosts = make(map[string][]*siteHandler)
+	}
+	host := normalizeHost(site.Host)
+	site.Prefix = normalizePrefix(site.Prefix)
+	for _, sh := range sr.hosts[host] {
+		if sh.site.Prefix == site.Prefix {
+			return fmt.Errorf("%q is already mounted at %q%s", sh.site.DocRoot, host, site.Prefix)
+		}
+	}
+	handler, err := site.Handler(wrap)
+	if err != nil {
+		return err
+	}
+	sites := append(sr.hosts[host], &siteHandler{site: site, handler: handler})
+	sort.Slice(sites, func(i, j int) bool {
+		return len(sites[i].site.Prefix) > len(sites[j].site.Prefix)
+	})
+	sr.hosts[host] = sites
+	return nil
+}
+
+// Sites returns the sites known to the router
+func (sr *SiteRouter) Sites() []*Site {
+	sites := []*Site{}
+	hosts := []string{}
+	for host := range sr.hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		for _, sh := range sr.hosts[host] {
+			sites = append(sites, sh.site)
+		}
+	}
+	return sites
+}
+
+// route finds the site handler for a request, it returns nil if no
+// site matches.
+func (sr *SiteRouter) route(r *http.Request) *siteHandler {
+	sites, ok := sr.hosts[normalizeHost(r.Host)]
+	if ok == false {
+		sites = sr.hosts[""]
+	}
+	for _, sh := range sites {
+		if strings.HasPrefix(r.URL.Path, sh.site.Prefix) || r.URL.Path == strings.TrimSuffix(sh.site.Prefix, "/") {
+			return sh
+		}
+	}
+	return nil
+}
+
+// ServeHTTP routes the request to the matching site
+func (sr *SiteRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sh := sr.route(r)
+	if sh == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.URL.Path == strings.TrimSuffix(sh.site.Prefix, "/") {
+		// Make relative links work by redirecting to the mount's slash
+		u := *r.URL
+		u.Path = sh.site.Prefix
+		http.Redirect(w, r, u.String(), http.StatusMovedPermanently)
+		return
+	}
+	sh.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,105 @@
+//
+// sites_test.go test routines for sites.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSiteRouter(t *testing.T) {
+	docs := map[string]string{
+		path.Join("test", "sites", "main", "index.html"):         "main",
+		path.Join("test", "sites", "shared", "site.css"):         "shared",
+		path.Join("test", "sites", "shared", ".git", "config"):   "secret",
+		path.Join("test", "sites", "blog", "index.html"):         "blog",
+		path.Join("test", "sites", "blog", "shared", "site.css"): "blog shared",
+	}
+	for fName, src := range docs {
+		os.MkdirAll(path.Dir(fName), 0777)
+		if err := ioutil.WriteFile(fName, []byte(src), 0666); err != nil {
+			t.Errorf("Can't create %q, %s", fName, err)
+			t.FailNow()
+		}
+	}
+	site, err := ParseSite("/shared=test/sites/shared;cors-origin=https://example.org", false)
+	if err != nil {
+		t.Errorf("ParseSite() failed, %s", err)
+		t.FailNow()
+	}
+	if site.Prefix != "/shared" || site.DocRoot != "test/sites/shared" || site.CORSOrigin != "https://example.org" {
+		t.Errorf("unexpected site %+v", site)
+	}
+	if _, err := ParseSite("/shared=test/sites/shared;unknown=1", false); err == nil {
+		t.Errorf("expected an error for an unknown option")
+	}
+	vhost, err := ParseSite("Blog.localhost=test/sites/blog", true)
+	if err != nil {
+		t.Errorf("ParseSite() failed, %s", err)
+		t.FailNow()
+	}
+
+	sr := new(SiteRouter)
+	for _, s := range []*Site{{Prefix: "/", DocRoot: "test/sites/main"}, site, vhost} {
+		if err := sr.AddSite(s, nil); err != nil {
+			t.Errorf("AddSite(%+v) failed, %s", s, err)
+			t.FailNow()
+		}
+	}
+	if err := sr.AddSite(&Site{Prefix: "/shared/", DocRoot: "test/sites/main"}, nil); err == nil {
+		t.Errorf("expected an error mounting /shared/ twice")
+	}
+
+	for _, test := range []struct {
+		host, p  string
+		status   int
+		body     string
+		location string
+	}{
+		{"localhost:8000", "/", 200, "main", ""},
+		{"localhost:8000", "/shared/site.css", 200, "shared", ""},
+		{"localhost:8000", "/shared", 301, "", "/shared/"},
+		{"localhost:8000", "/shared/.git/config", 403, "", ""},
+		{"blog.localhost:8000", "/", 200, "blog", ""},
+		{"BLOG.localhost", "/shared/site.css", 200, "blog shared", ""},
+	} {
+		req := httptest.NewRequest("GET", test.p, nil)
+		req.Host = test.host
+		rec := httptest.NewRecorder()
+		sr.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Errorf("expected %d for %s%s, got %d", test.status, test.host, test.p, rec.Code)
+			continue
+		}
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("expected %q for %s%s, got %q", test.body, test.host, test.p, rec.Body.String())
+		}
+		if test.location != "" && rec.Header().Get("Location") != test.location {
+			t.Errorf("expected Location %q, got %q", test.location, rec.Header().Get("Location"))
+		}
+		if test.p == "/shared/site.css" && test.host == "localhost:8000" {
+			if origin := rec.Header().Get("Access-Control-Allow-Origin"); origin != "https://example.org" {
+				t.Errorf("expected the mount's CORS origin, got %q", origin)
+			}
+		}
+	}
+}
@@ -0,0 +1,286 @@
+//
+// Package mkpage tls.go generates a local CA and certificates so
+// ws can serve https without hand made key and cert files.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	// LocalCACert is the file name of the local CA certificate
+	LocalCACert = "ca.pem"
+	// LocalCAKey is the file name of the local CA key
+	LocalCAKey = "ca-key.pem"
+	// LocalCert is the file name of the leaf certificate used by ws
+	LocalCert = "cert.pem"
+	// LocalKey is the file name of the leaf certificate key used by ws
+	LocalKey = "key.pem"
+)
+
+// DefaultTLSCacheDir returns the directory ws uses to cache its
+// local CA and certificates.
+func DefaultTLSCacheDir() string {
+	dName, err := os.UserCacheDir()
+	if err != nil {
+		dName = os.TempDir()
+	}
+	return path.Join(dName, "mkpage", "ws")
+}
+
+// TLSHostnames returns the hostnames a local certificate should cover,
+// localhost, 127.0.0.1 and ::1 are always included.
+func TLSHostnames(hosts ...string) []string {
+	names := []string{"localhost", "127.0.0.1", "::1"}
+	for _, host := range hosts {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		found := false
+		for _, name := range names {
+			if strings.EqualFold(name, host) {
+				found = true
+				break
+			}
+		}
+		if found == false {
+			names = append(names, host)
+		}
+	}
+	return names
+}
+
+// CertFingerprint returns the SHA-256 fingerprint of a DER encoded
+// certificate in the colon delimited form used by browsers.
+func CertFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := []string{}
+	for _, b := range sum {
+		parts = append(parts, fmt.Sprintf("%02X", b))
+	}
+	return strings.Join(parts, ":")
+}
+
+// writePEM writes a PEM block to fName with the given permissions
+func writePEM(fName string, blockType string, der []byte, perm os.FileMode) error {
+	src := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := ioutil.WriteFile(fName, src, perm); err != nil {
+		return fmt.Errorf("Writing %q, %s", fName, err)
+	}
+	return nil
+}
+
+// readCert reads a PEM encoded certificate
+func readCert(fName string) (*x509.Certificate, error) {
+	src, err := ioutil.ReadFile(fName)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(src)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%q is not a PEM encoded certificate", fName)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// readKey reads a PEM encoded EC private key
+func readKey(fName string) (*ecdsa.PrivateKey, error) {
+	src, err := ioutil.ReadFile(fName)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(src)
+	if block == nil {
+		return nil, fmt.Errorf("%q is not a PEM encoded key", fName)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// serialNumber returns a random certificate serial number
+func serialNumber() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
+
+// ensureLocalCA loads the local CA from dName creating it if needed
+func ensureLocalCA(dName string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	caCertName, caKeyName := path.Join(dName, LocalCACert), path.Join(dName, LocalCAKey)
+	if caCert, err := readCert(caCertName); err == nil && time.Now().Before(caCert.NotAfter) {
+		if caKey, err := readKey(caKeyName); err == nil {
+			return caCert, caKey, nil
+		}
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return nil, nil, err
+	}
+	hostname, _ := os.Hostname()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"mkpage ws development CA"},
+			CommonName:   fmt.Sprintf("mkpage ws local CA (%s)", hostname),
+		},
+		NotBefore:             time.Now().Add(-1 * time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(caKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writePEM(caKeyName, "EC PRIVATE KEY", keyDER, 0600); err != nil {
+		return nil, nil, err
+	}
+	if err := writePEM(caCertName, "CERTIFICATE", der, 0644); err != nil {
+		return nil, nil, err
+	}
+	caCert, err := x509.ParseCertificate(der)
+	return caCert, caKey, err
+}
+
+// certCovers checks if cert is current, signed by caCert and valid
+// for all the hostnames.
+func certCovers(cert *x509.Certificate, caCert *x509.Certificate, hostnames []string) bool {
+	if time.Now().After(cert.NotAfter.Add(-24*time.Hour)) || cert.CheckSignatureFrom(caCert) != nil {
+		return false
+	}
+	for _, host := range hostnames {
+		if err := cert.VerifyHostname(host); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// EnsureLocalCert makes sure dName holds a local CA and a leaf
+// certificate signed by it covering hostnames. The CA is reused
+// between runs so it only needs to be trusted once, the leaf
+// certificate is regenerated when hostnames change or it is about
+// to expire. It returns the cert and key file names along with the
+// leaf certificate's SHA-256 fingerprint.
+func EnsureLocalCert(dName string, hostnames []string) (string, string, string, error) {
+	if err := os.MkdirAll(dName, 0700); err != nil {
+		return "", "", "", err
+	}
+	caCert, caKey, err := ensureLocalCA(dName)
+	if err != nil {
+		return "", "", "", fmt.Errorf("Local CA, %s", err)
+	}
+	certName, keyName := path.Join(dName, LocalCert), path.Join(dName, LocalKey)
+	if cert, err := readCert(certName); err == nil && certCovers(cert, caCert, hostnames) {
+		if _, err := readKey(keyName); err == nil {
+			return certName, keyName, CertFingerprint(cert.Raw), nil
+		}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", "", err
+	}
+	serial, err := serialNumber()
+	if err != nil {
+		return "", "", "", err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"mkpage ws development certificate"},
+			CommonName:   hostnames[0],
+		},
+		NotBefore:   time.Now().Add(-1 * time.Hour),
+		NotAfter:    time.Now().AddDate(1, 0, 0),
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, host := range hostnames {
+		if ip := net.ParseIP(host); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, caCert, &key.PublicKey, caKey)
+	if err != nil {
+		return "", "", "", err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", "", err
+	}
+	if err := writePEM(keyName, "EC PRIVATE KEY", keyDER, 0600); err != nil {
+		return "", "", "", err
+	}
+	if err := writePEM(certName, "CERTIFICATE", der, 0644); err != nil {
+		return "", "", "", err
+	}
+	return certName, keyName, CertFingerprint(der), nil
+}
+
+// HTTPSRedirectHandler returns a http.Handler that redirects requests
+// to the same host, path and query on the port of the https URL. The
+// redirect is temporary so browsers don't cache it for the port.
+func HTTPSRedirectHandler(httpsURL *url.URL) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if host == "" {
+			host = httpsURL.Hostname()
+		}
+		if port := httpsURL.Port(); port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			// Bare IPv6 addresses need their brackets back
+			host = "[" + host + "]"
+		}
+		u := *r.URL
+		u.Scheme = "https"
+		u.Host = host
+		http.Redirect(w, r, u.String(), http.StatusTemporaryRedirect)
+	})
+}
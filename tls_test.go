@@ -0,0 +1,88 @@
+//
+// tls_test.go test routines for tls.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestEnsureLocalCert(t *testing.T) {
+	dName := path.Join("test", "tls")
+	os.RemoveAll(dName)
+	hostnames := TLSHostnames("blog.localhost", "localhost")
+	if len(hostnames) != 4 {
+		t.Errorf("expected four hostnames, got %+v", hostnames)
+	}
+	certName, keyName, fingerprint, err := EnsureLocalCert(dName, hostnames)
+	if err != nil {
+		t.Errorf("EnsureLocalCert(%q, %+v) failed, %s", dName, hostnames, err)
+		t.FailNow()
+	}
+	if _, err := tls.LoadX509KeyPair(certName, keyName); err != nil {
+		t.Errorf("expected a usable key pair, %s", err)
+	}
+	cert, err := readCert(certName)
+	if err != nil {
+		t.Errorf("expected to read %q, %s", certName, err)
+		t.FailNow()
+	}
+	for _, host := range hostnames {
+		if err := cert.VerifyHostname(host); err != nil {
+			t.Errorf("expected cert to cover %q, %s", host, err)
+		}
+	}
+	// A second call should reuse the certificate
+	_, _, fingerprint2, err := EnsureLocalCert(dName, hostnames)
+	if err != nil {
+		t.Errorf("EnsureLocalCert(%q, %+v) failed, %s", dName, hostnames, err)
+	}
+	if fingerprint != fingerprint2 {
+		t.Errorf("expected reused certificate %q, got %q", fingerprint, fingerprint2)
+	}
+	// Adding a hostname should issue a new certificate from the same CA
+	_, _, fingerprint3, err := EnsureLocalCert(dName, TLSHostnames("example.localhost"))
+	if err != nil {
+		t.Errorf("EnsureLocalCert() failed, %s", err)
+	}
+	if fingerprint == fingerprint3 {
+		t.Errorf("expected a new certificate for new hostnames")
+	}
+}
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	u, _ := url.Parse("https://localhost:8443")
+	handler := HTTPSRedirectHandler(u)
+	req := httptest.NewRequest("GET", "http://blog.localhost:8000/about.html?q=1", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusTemporaryRedirect {
+		t.Errorf("expected 307, got %d", rec.Code)
+	}
+	expected := "https://blog.localhost:8443/about.html?q=1"
+	if loc := rec.Header().Get("Location"); loc != expected {
+		t.Errorf("expected %q, got %q", expected, loc)
+	}
+}
@@ -20,23 +20,115 @@
 package mkpage
 
 import (
-	"fmt"
 	"log"
 	"net/http"
 	"path"
 	"strings"
 )
 
-// IsDotPath checks to see if a path is requested with a dot file (e.g. docs/.git/* or docs/.htaccess)
-func IsDotPath(p string) bool {
-	for _, part := range strings.Split(path.Clean(p), "/") {
-		if strings.HasPrefix(part, "..") == false && strings.HasPrefix(part, ".") == true && len(part) > 1 {
+// PathPolicy holds allow and deny lists of path patterns used when
+// deciding if a path should be served (or listed in a sitemap). Dot
+// paths (e.g. docs/.git/* or docs/.htaccess) are hidden unless they
+// match the Allow list, anything matching the Deny list is hidden.
+//
+// Patterns starting with a slash are matched with path.Match against
+// the path from the document root (e.g. "/.well-known",
+// "/drafts/*"), other patterns are matched against each path segment
+// (e.g. ".git", "*.bak"). A denied pattern also hides everything below it.
+type PathPolicy struct {
+	Allow []string `json:"allow,omitempty"`
+	Deny  []string `json:"deny,omitempty"`
+}
+
+var (
+	// DefaultPathAllow lists the dot paths served by default
+	DefaultPathAllow = []string{"/.well-known"}
+
+	// DefaultPathPolicy is used by IsDotPath and StaticRouter
+	DefaultPathPolicy = &PathPolicy{Allow: DefaultPathAllow}
+)
+
+// ParsePathList splits a comma delimited list of path patterns
+func ParsePathList(s string) []string {
+	patterns := []string{}
+	for _, pattern := range strings.Split(s, ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// matchPathPattern checks a pattern against a path prefix (e.g.
+// "/docs/.git") and its last segment (e.g. ".git")
+func matchPathPattern(pattern string, prefix string, segment string) bool {
+	target := segment
+	if strings.HasPrefix(pattern, "/") {
+		target = prefix
+		if len(pattern) > 1 {
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+	}
+	ok, _ := path.Match(pattern, target)
+	return ok
+}
+
+// matchAny returns true if any of the patterns match
+func matchAny(patterns []string, prefix string, segment string) bool {
+	for _, pattern := range patterns {
+		if matchPathPattern(pattern, prefix, segment) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDotPath checks to see if a path should be hidden, either because it
+// has a dot segment that isn't allowed or because it is denied.
+func (pp *PathPolicy) IsDotPath(p string) bool {
+	if pp == nil {
+		pp = new(PathPolicy)
+	}
+	// Cleaning a rooted path resolves any ".." segments
+	p = path.Clean("/" + p)
+	if p == "/" {
+		return false
+	}
+	prefix := ""
+	for _, part := range strings.Split(strings.TrimPrefix(p, "/"), "/") {
+		prefix += "/" + part
+		if matchAny(pp.Deny, prefix, part) {
+			return true
+		}
+		if strings.HasPrefix(part, ".") && len(part) > 1 && matchAny(pp.Allow, prefix, part) == false {
 			return true
 		}
 	}
 	return false
 }
 
+// StaticRouter returns a handler that sends forbidden for paths the
+// policy hides, otherwise the request is passed on.
+func (pp *PathPolicy) StaticRouter(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// If given a dot file path, send forbidden
+		if pp.IsDotPath(r.URL.Path) == true {
+			// NOTE: the access log records the 403
+			http.Error(w, "Forbidden", 403)
+			return
+		}
+		// If we make it this far, fall back to the default handler
+		next.ServeHTTP(w, r)
+	})
+}
+
+// IsDotPath checks to see if a path is requested with a dot file (e.g.
+// docs/.git/* or docs/.htaccess) using DefaultPathPolicy, so
+// /.well-known/ is allowed by default.
+func IsDotPath(p string) bool {
+	return DefaultPathPolicy.IsDotPath(p)
+}
+
 // RequestLogger logs the request based on the request object passed into it.
 func RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -62,14 +154,35 @@ func ResponseLogger(r *http.Request, status int, err error) {
 
 // StaticRouter scans the request object to either add a .html extension or prevent serving a dot file path
 func StaticRouter(next http.Handler) http.Handler {
+	return DefaultPathPolicy.StaticRouter(next)
+}
+
+// PreflightRouter reflects the request's Origin, answers preflighted
+// OPTIONS requests and sets the Content-Type or Content-Encoding for
+// .wasm, .mjs, .js, .json.gz and .js.gz. It is wsfn.StaticRouter without
+// the dot path check, that is left to StaticRouter and DefaultPathPolicy.
+func PreflightRouter(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// If given a dot file path, send forbidden
-		if IsDotPath(r.URL.Path) == true {
-			http.Error(w, "Forbidden", 403)
-			ResponseLogger(r, 403, fmt.Errorf("Forbidden, requested a dot path"))
+		if origin := r.Header.Get("Origin"); origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Allow-Methods", "GET")
+			w.Header().Set("Access-Control-Allow-Headers",
+				"Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		}
+		// Stop here if its Preflighted OPTIONS request
+		if r.Method == "OPTIONS" {
 			return
 		}
-		// If we make it this far, fall back to the default handler
+		// Check if we have a gzipped JSON file
+		if strings.HasSuffix(r.URL.Path, ".json.gz") || strings.HasSuffix(r.URL.Path, ".js.gz") {
+			w.Header().Set("Content-Encoding", "gzip")
+		}
+		switch path.Ext(r.URL.Path) {
+		case ".wasm":
+			w.Header().Set("Content-Type", "application/wasm")
+		case ".mjs", ".js":
+			w.Header().Set("Content-Type", "text/javascript")
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -19,6 +19,8 @@
 package mkpage
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -45,3 +47,57 @@ func TestIsDotPath(t *testing.T) {
 		}
 	}
 }
+
+func TestPathPolicy(t *testing.T) {
+	// The default policy allows .well-known
+	boolTests := map[string]bool{
+		"/.well-known/security.txt":          false,
+		"/.well-known/acme-challenge/abc123": false,
+		"/docs/.well-known/security.txt":     true,
+		"/.well-known/.secret":               true,
+		"/.git/config":                       true,
+		"/../.well-known/ai-plugin.json":     false,
+		"/.well-known/../.htaccess":          true,
+		"/index.html":                        false,
+		"/":                                  false,
+	}
+	for p, expected := range boolTests {
+		if r := IsDotPath(p); r != expected {
+			t.Errorf("expected %t, got %t for %s", expected, r, p)
+		}
+	}
+
+	pp := &PathPolicy{
+		Allow: ParsePathList("/.well-known, .nojekyll"),
+		Deny:  ParsePathList("*.bak,/drafts,/.well-known/private"),
+	}
+	boolTests = map[string]bool{
+		"/.well-known/security.txt":    false,
+		"/.well-known/private/key.txt": true,
+		"/blog/.nojekyll":              false,
+		"/index.html.bak":              true,
+		"/drafts/post.html":            true,
+		"/drafts":                      true,
+		"/published/drafts.html":       false,
+		"/.git/config":                 true,
+	}
+	for p, expected := range boolTests {
+		if r := pp.IsDotPath(p); r != expected {
+			t.Errorf("expected %t, got %t for %s", expected, r, p)
+		}
+	}
+
+	handler := pp.StaticRouter(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	for p, expected := range map[string]int{
+		"/.well-known/security.txt": http.StatusOK,
+		"/drafts/post.html":         http.StatusForbidden,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", p, nil))
+		if rec.Code != expected {
+			t.Errorf("expected %d, got %d for %s", expected, rec.Code, p)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+//
+// Package mkpage wsconfig.go provides YAML, TOML and JSON configuration files
+// for ws.
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech.
+//
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	// 3rd Party packages
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// WSEnvPrefix starts the environment variable names that override
+	// ws configuration settings, e.g. MKPAGE_DOCROOT
+	WSEnvPrefix = "MKPAGE_"
+)
+
+// WSConfig holds the settings for ws. It can be read from a YAML, TOML
+// or JSON file. Keys match the option names with underscores, durations
+// are strings like "30s" and lists are arrays.
+type WSConfig struct {
+	DocRoot            string            `json:"docroot,omitempty" yaml:"docroot,omitempty" toml:"docroot,omitempty"`
+	URL                string            `json:"url,omitempty" yaml:"url,omitempty" toml:"url,omitempty"`
+	SSLKey             string            `json:"ssl_key,omitempty" yaml:"ssl_key,omitempty" toml:"ssl_key,omitempty"`
+	SSLCert            string            `json:"ssl_cert,omitempty" yaml:"ssl_cert,omitempty" toml:"ssl_cert,omitempty"`
+	CORSOrigin         string            `json:"cors_origin,omitempty" yaml:"cors_origin,omitempty" toml:"cors_origin,omitempty"`
+	RedirectsCSV       string            `json:"redirects_csv,omitempty" yaml:"redirects_csv,omitempty" toml:"redirects_csv,omitempty"`
+	Compress           bool              `json:"compress,omitempty" yaml:"compress,omitempty" toml:"compress,omitempty"`
+	ServePrecompressed bool              `json:"serve_precompressed,omitempty" yaml:"serve_precompressed,omitempty" toml:"serve_precompressed,omitempty"`
+	CompressMinSize    int               `json:"compress_min_size,omitempty" yaml:"compress_min_size,omitempty" toml:"compress_min_size,omitempty"`
+	CacheConfig        string            `json:"cache_config,omitempty" yaml:"cache_config,omitempty" toml:"cache_config,omitempty"`
+	MimeTypes          map[string]string `json:"mime_types,omitempty" yaml:"mime_types,omitempty" toml:"mime_types,omitempty"`
+	CacheControl       string            `json:"cache_control,omitempty" yaml:"cache_control,omitempty" toml:"cache_control,omitempty"`
+	ETags              bool              `json:"etags,omitempty" yaml:"etags,omitempty" toml:"etags,omitempty"`
+	Immutable          bool              `json:"immutable,omitempty" yaml:"immutable,omitempty" toml:"immutable,omitempty"`
+	SecurityHeaders    bool              `json:"security_headers,omitempty" yaml:"security_headers,omitempty" toml:"security_headers,omitempty"`
+	CSP                string            `json:"csp,omitempty" yaml:"csp,omitempty" toml:"csp,omitempty"`
+	CSPReportOnly      bool              `json:"csp_report_only,omitempty" yaml:"csp_report_only,omitempty" toml:"csp_report_only,omitempty"`
+	CSPReportPath      string            `json:"csp_report_path,omitempty" yaml:"csp_report_path,omitempty" toml:"csp_report_path,omitempty"`
+	ReferrerPolicy     string            `json:"referrer_policy,omitempty" yaml:"referrer_policy,omitempty" toml:"referrer_policy,omitempty"`
+	PermissionsPolicy  string            `json:"permissions_policy,omitempty" yaml:"permissions_policy,omitempty" toml:"permissions_policy,omitempty"`
+	TLSCache           string            `json:"tls_cache,omitempty" yaml:"tls_cache,omitempty" toml:"tls_cache,omitempty"`
+	TLSHosts           []string          `json:"tls_hosts,omitempty" yaml:"tls_hosts,omitempty" toml:"tls_hosts,omitempty"`
+	RedirectHTTP       string            `json:"redirect_http,omitempty" yaml:"redirect_http,omitempty" toml:"redirect_http,omitempty"`
+	Proxy              []string          `json:"proxy,omitempty" yaml:"proxy,omitempty" toml:"proxy,omitempty"`
+	Mounts             []string          `json:"mounts,omitempty" yaml:"mounts,omitempty" toml:"mounts,omitempty"`
+	VHosts             []string          `json:"vhosts,omitempty" yaml:"vhosts,omitempty" toml:"vhosts,omitempty"`
+	LogFormat          string            `json:"log_format,omitempty" yaml:"log_format,omitempty" toml:"log_format,omitempty"`
+	LogFile            string            `json:"log_file,omitempty" yaml:"log_file,omitempty" toml:"log_file,omitempty"`
+	LogMaxSize         int               `json:"log_max_size,omitempty" yaml:"log_max_size,omitempty" toml:"log_max_size,omitempty"`
+	LogMaxBackups      int               `json:"log_max_backups,omitempty" yaml:"log_max_backups,omitempty" toml:"log_max_backups,omitempty"`
+	AllowPaths         []string          `json:"allow_paths,omitempty" yaml:"allow_paths,omitempty" toml:"allow_paths,omitempty"`
+	DenyPaths          []string          `json:"deny_paths,omitempty" yaml:"deny_paths,omitempty" toml:"deny_paths,omitempty"`
+	Admin              string            `json:"admin,omitempty" yaml:"admin,omitempty" toml:"admin,omitempty"`
+	ReadTimeout        string            `json:"read_timeout,omitempty" yaml:"read_timeout,omitempty" toml:"read_timeout,omitempty"`
+	WriteTimeout       string            `json:"write_timeout,omitempty" yaml:"write_timeout,omitempty" toml:"write_timeout,omitempty"`
+	IdleTimeout        string            `json:"idle_timeout,omitempty" yaml:"idle_timeout,omitempty" toml:"idle_timeout,omitempty"`
+	ShutdownTimeout    string            `json:"shutdown_timeout,omitempty" yaml:"shutdown_timeout,omitempty" toml:"shutdown_timeout,omitempty"`
+}
+
+// WSSetting maps a configuration key to its ws option name
+type WSSetting struct {
+	Key  string
+	Flag string
+}
+
+// WSSettings lists the configuration keys and their ws options
+var WSSettings = []WSSetting{
+	{"docroot", "docs"},
+	{"url", "url"},
+	{"ssl_key", "key"},
+	{"ssl_cert", "cert"},
+	{"cors_origin", "cors-origin"},
+	{"redirects_csv", "redirects-csv"},
+	{"compress", "compress"},
+	{"serve_precompressed", "serve-precompressed"},
+	{"compress_min_size", "compress-min-size"},
+	{"cache_config", "cache-config"},
+	{"mime_types", "mime-types"},
+	{"cache_control", "cache-control"},
+	{"etags", "etags"},
+	{"immutable", "immutable"},
+	{"security_headers", "security-headers"},
+	{"csp", "csp"},
+	{"csp_report_only", "csp-report-only"},
+	{"csp_report_path", "csp-report-path"},
+	{"referrer_policy", "referrer-policy"},
+	{"permissions_policy", "permissions-policy"},
+	{"tls_cache", "tls-cache"},
+	{"tls_hosts", "tls-hosts"},
+	{"redirect_http", "redirect-http"},
+	{"proxy", "proxy"},
+	{"mounts", "mount"},
+	{"vhosts", "vhost"},
+	{"log_format", "log-format"},
+	{"log_file", "log-file"},
+	{"log_max_size", "log-max-size"},
+	{"log_max_backups", "log-max-backups"},
+	{"allow_paths", "allow-paths"},
+	{"deny_paths", "deny-paths"},
+	{"admin", "admin"},
+	{"read_timeout", "read-timeout"},
+	{"write_timeout", "write-timeout"},
+	{"idle_timeout", "idle-timeout"},
+	{"shutdown_timeout", "shutdown-timeout"},
+}
+
+// wsEnvNames are the environment variables not named for their key,
+// the site URL is MKPAGE_SITEURL as for sitemapper.
+var wsEnvNames = map[string]string{
+	"url": "MKPAGE_SITEURL",
+}
+
+// WSEnvName returns the environment variable name for a configuration
+// key, e.g. "cors_origin" becomes "MKPAGE_CORS_ORIGIN".
+func WSEnvName(key string) string {
+	if name, ok := wsEnvNames[key]; ok {
+		return name
+	}
+	return WSEnvPrefix + strings.ToUpper(key)
+}
+
+// configFormat returns yaml, toml or json based on the file extension
+func configFormat(fName string) (string, error) {
+	switch strings.ToLower(path.Ext(fName)) {
+	case ".yaml", ".yml":
+		return "yaml", nil
+	case ".toml":
+		return "toml", nil
+	case ".json":
+		return "json", nil
+	}
+	return "", fmt.Errorf("Unsupported configuration format %q, expected .yaml, .toml or .json", fName)
+}
+
+// LoadWSConfig reads a YAML, TOML or JSON file (based on its extension)
+// and returns a *WSConfig
+func LoadWSConfig(fName string) (*WSConfig, error) {
+	format, err := configFormat(fName)
+	if err != nil {
+		return nil, err
+	}
+	src, err := ioutil.ReadFile(fName)
+	if err != nil {
+		return nil, fmt.Errorf("Reading %q, %s", fName, err)
+	}
+	cfg := new(WSConfig)
+	switch format {
+	case "yaml":
+		err = yaml.Unmarshal(src, cfg)
+	case "toml":
+		err = toml.Unmarshal(src, cfg)
+	default:
+		err = json.Unmarshal(src, cfg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unmarshing %q, %s", fName, err)
+	}
+	return cfg, nil
+}
+
+// Encode renders the configuration as yaml, toml or json
+func (cfg *WSConfig) Encode(format string) ([]byte, error) {
+	switch format {
+	case "toml":
+		buf := new(bytes.Buffer)
+		if err := toml.NewEncoder(buf).Encode(cfg); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "json":
+		return json.MarshalIndent(cfg, "", "    ")
+	}
+	return yaml.Marshal(cfg)
+}
+
+// EncodeFor renders the configuration in the format of fName's extension,
+// YAML is used if fName is empty.
+func (cfg *WSConfig) EncodeFor(fName string) ([]byte, error) {
+	if fName == "" {
+		return cfg.Encode("yaml")
+	}
+	format, err := configFormat(fName)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.Encode(format)
+}
+
+// joinMap renders a map as a comma delimited list of KEY=VALUE
+func joinMap(m map[string]string) string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, k := range keys {
+		parts = append(parts, k+"="+m[k])
+	}
+	return strings.Join(parts, ",")
+}
+
+// FlagValues returns the settings which are set as a map of ws option
+// name to option value, lists are comma delimited.
+func (cfg *WSConfig) FlagValues() map[string]string {
+	values := map[string]string{}
+	setString := func(name, val string) {
+		if val != "" {
+			values[name] = val
+		}
+	}
+	setBool := func(name string, val bool) {
+		if val {
+			values[name] = "true"
+		}
+	}
+	setInt := func(name string, val int) {
+		if val != 0 {
+			values[name] = strconv.Itoa(val)
+		}
+	}
+	setString("docs", cfg.DocRoot)
+	setString("url", cfg.URL)
+	setString("key", cfg.SSLKey)
+	setString("cert", cfg.SSLCert)
+	setString("cors-origin", cfg.CORSOrigin)
+	setString("redirects-csv", cfg.RedirectsCSV)
+	setBool("compress", cfg.Compress)
+	setBool("serve-precompressed", cfg.ServePrecompressed)
+	setInt("compress-min-size", cfg.CompressMinSize)
+	setString("cache-config", cfg.CacheConfig)
+	setString("mime-types", joinMap(cfg.MimeTypes))
+	setString("cache-control", cfg.CacheControl)
+	setBool("etags", cfg.ETags)
+	setBool("immutable", cfg.Immutable)
+	setBool("security-headers", cfg.SecurityHeaders)
+	setString("csp", cfg.CSP)
+	setBool("csp-report-only", cfg.CSPReportOnly)
+	setString("csp-report-path", cfg.CSPReportPath)
+	setString("referrer-policy", cfg.ReferrerPolicy)
+	setString("permissions-policy", cfg.PermissionsPolicy)
+	setString("tls-cache", cfg.TLSCache)
+	setString("tls-hosts", strings.Join(cfg.TLSHosts, ","))
+	setString("redirect-http", cfg.RedirectHTTP)
+	setString("proxy", strings.Join(cfg.Proxy, ","))
+	setString("mount", strings.Join(cfg.Mounts, ","))
+	setString("vhost", strings.Join(cfg.VHosts, ","))
+	setString("log-format", cfg.LogFormat)
+	setString("log-file", cfg.LogFile)
+	setInt("log-max-size", cfg.LogMaxSize)
+	setInt("log-max-backups", cfg.LogMaxBackups)
+	setString("allow-paths", strings.Join(cfg.AllowPaths, ","))
+	setString("deny-paths", strings.Join(cfg.DenyPaths, ","))
+	setString("admin", cfg.Admin)
+	setString("read-timeout", cfg.ReadTimeout)
+	setString("write-timeout", cfg.WriteTimeout)
+	setString("idle-timeout", cfg.IdleTimeout)
+	setString("shutdown-timeout", cfg.ShutdownTimeout)
+	return values
+}
+
+// EnvFlagValues returns a map of ws option name to value for each
+// MKPAGE_ environment variable that is set (e.g. MKPAGE_DOCROOT sets
+// -docs). getenv is normally os.Getenv.
+func EnvFlagValues(getenv func(string) string) map[string]string {
+	values := map[string]string{}
+	for _, setting := range WSSettings {
+		if val := strings.TrimSpace(getenv(WSEnvName(setting.Key))); val != "" {
+			values[setting.Flag] = val
+		}
+	}
+	return values
+}
+
+// splitList splits a comma delimited list dropping empty items
+func splitList(s string) []string {
+	items := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// WSConfigFromFlags returns the effective configuration given a lookup
+// function returning the current value of a ws option (e.g. using
+// flag.Lookup).
+func WSConfigFromFlags(lookup func(name string) string) *WSConfig {
+	atoi := func(name string) int {
+		i, _ := strconv.Atoi(lookup(name))
+		return i
+	}
+	isTrue := func(name string) bool {
+		b, _ := strconv.ParseBool(lookup(name))
+		return b
+	}
+	cfg := &WSConfig{
+		DocRoot:            lookup("docs"),
+		URL:                lookup("url"),
+		SSLKey:             lookup("key"),
+		SSLCert:            lookup("cert"),
+		CORSOrigin:         lookup("cors-origin"),
+		RedirectsCSV:       lookup("redirects-csv"),
+		Compress:           isTrue("compress"),
+		ServePrecompressed: isTrue("serve-precompressed"),
+		CompressMinSize:    atoi("compress-min-size"),
+		CacheConfig:        lookup("cache-config"),
+		CacheControl:       lookup("cache-control"),
+		ETags:              isTrue("etags"),
+		Immutable:          isTrue("immutable"),
+		SecurityHeaders:    isTrue("security-headers"),
+		CSP:                lookup("csp"),
+		CSPReportOnly:      isTrue("csp-report-only"),
+		CSPReportPath:      lookup("csp-report-path"),
+		ReferrerPolicy:     lookup("referrer-policy"),
+		PermissionsPolicy:  lookup("permissions-policy"),
+		TLSCache:           lookup("tls-cache"),
+		TLSHosts:           splitList(lookup("tls-hosts")),
+		RedirectHTTP:       lookup("redirect-http"),
+		Proxy:              splitList(lookup("proxy")),
+		Mounts:             splitList(lookup("mount")),
+		VHosts:             splitList(lookup("vhost")),
+		LogFormat:          lookup("log-format"),
+		LogFile:            lookup("log-file"),
+		LogMaxSize:         atoi("log-max-size"),
+		LogMaxBackups:      atoi("log-max-backups"),
+		AllowPaths:         splitList(lookup("allow-paths")),
+		DenyPaths:          splitList(lookup("deny-paths")),
+		Admin:              lookup("admin"),
+		ReadTimeout:        lookup("read-timeout"),
+		WriteTimeout:       lookup("write-timeout"),
+		IdleTimeout:        lookup("idle-timeout"),
+		ShutdownTimeout:    lookup("shutdown-timeout"),
+	}
+	if mimeTypes := splitList(lookup("mime-types")); len(mimeTypes) > 0 {
+		cfg.MimeTypes = map[string]string{}
+		for _, item := range mimeTypes {
+			if parts := strings.SplitN(item, "=", 2); len(parts) == 2 {
+				cfg.MimeTypes[parts[0]] = parts[1]
+			}
+		}
+	}
+	return cfg
+}
@@ -0,0 +1,129 @@
+//
+// wsconfig_test.go test routines for wsconfig.go
+//
+// @author R. S. Doiel, <rsdoiel@caltech.edu>
+//
+// Copyright (c) 2021, Caltech
+// All rights not granted herein are expressly reserved by Caltech
+//
+// Redistribution and use in source and binary forms, with or without modification, are permitted provided that the following conditions are met:
+//
+// 1. Redistributions of source code must retain the above copyright notice, this list of conditions and the following disclaimer.
+//
+// 2. Redistributions in binary form must reproduce the above copyright notice, this list of conditions and the following disclaimer in the documentation and/or other materials provided with the distribution.
+//
+// 3. Neither the name of the copyright holder nor the names of its contributors may be used to endorse or promote products derived from this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT HOLDER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL, SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE, DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+//
+package mkpage
+
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestLoadWSConfig(t *testing.T) {
+	dName := path.Join("test", "wsconfig")
+	os.MkdirAll(dName, 0777)
+	configs := map[string]string{
+		"ws.yaml": `docroot: htdocs
+url: http://localhost:8001
+cors_origin: "*"
+redirects_csv: redirects.csv
+mounts:
+  - /shared=./assets
+  - /docs=./docs
+read_timeout: 5s
+etags: true
+`,
+		"ws.toml": `docroot = "htdocs"
+url = "http://localhost:8001"
+cors_origin = "*"
+redirects_csv = "redirects.csv"
+mounts = [ "/shared=./assets", "/docs=./docs" ]
+read_timeout = "5s"
+etags = true
+`,
+		"ws.json": `{
+    "docroot": "htdocs",
+    "url": "http://localhost:8001",
+    "cors_origin": "*",
+    "redirects_csv": "redirects.csv",
+    "mounts": [ "/shared=./assets", "/docs=./docs" ],
+    "read_timeout": "5s",
+    "etags": true
+}`,
+	}
+	expected := map[string]string{
+		"docs":          "htdocs",
+		"url":           "http://localhost:8001",
+		"cors-origin":   "*",
+		"redirects-csv": "redirects.csv",
+		"mount":         "/shared=./assets,/docs=./docs",
+		"read-timeout":  "5s",
+		"etags":         "true",
+	}
+	for name, src := range configs {
+		fName := path.Join(dName, name)
+		if err := ioutil.WriteFile(fName, []byte(src), 0666); err != nil {
+			t.Errorf("Can't create %q, %s", fName, err)
+			t.FailNow()
+		}
+		cfg, err := LoadWSConfig(fName)
+		if err != nil {
+			t.Errorf("LoadWSConfig(%q) failed, %s", fName, err)
+			continue
+		}
+		values := cfg.FlagValues()
+		if len(values) != len(expected) {
+			t.Errorf("expected %d settings from %q, got %+v", len(expected), fName, values)
+		}
+		for flagName, val := range expected {
+			if values[flagName] != val {
+				t.Errorf("expected %s = %q from %q, got %q", flagName, val, fName, values[flagName])
+			}
+		}
+
+		// Round trip through the effective configuration
+		cfg2 := WSConfigFromFlags(func(name string) string { return values[name] })
+		src2, err := cfg2.EncodeFor(fName)
+		if err != nil {
+			t.Errorf("EncodeFor(%q) failed, %s", fName, err)
+			continue
+		}
+		fName2 := path.Join(dName, "dump-"+name)
+		ioutil.WriteFile(fName2, src2, 0666)
+		cfg3, err := LoadWSConfig(fName2)
+		if err != nil {
+			t.Errorf("LoadWSConfig(%q) failed, %s", fName2, err)
+			continue
+		}
+		if len(cfg3.Mounts) != 2 || cfg3.DocRoot != "htdocs" || cfg3.ETags == false {
+			t.Errorf("expected dumped config to match %q, got %+v", fName, cfg3)
+		}
+	}
+	if _, err := LoadWSConfig(path.Join(dName, "ws.ini")); err == nil {
+		t.Errorf("expected an error for an unsupported configuration format")
+	}
+}
+
+func TestEnvFlagValues(t *testing.T) {
+	env := map[string]string{
+		"MKPAGE_DOCROOT":     "/srv/htdocs",
+		"MKPAGE_CORS_ORIGIN": "https://example.edu",
+		"MKPAGE_SITEMAP":     "sitemap.xml",
+		"MKPAGE_SITEURL":     "http://localhost:8001",
+		"MKPAGE_URL":         "http://localhost:8002",
+	}
+	values := EnvFlagValues(func(key string) string { return env[key] })
+	if len(values) != 3 {
+		t.Errorf("expected 3 settings, got %+v", values)
+	}
+	if values["docs"] != "/srv/htdocs" || values["cors-origin"] != "https://example.edu" || values["url"] != "http://localhost:8001" {
+		t.Errorf("unexpected settings %+v", values)
+	}
+}